@@ -0,0 +1,345 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/google/uuid"
+	"github.com/wordflowlab/agentsdk/pkg/agent"
+	"github.com/wordflowlab/agentsdk/pkg/types"
+)
+
+// 审批超时的默认值
+const defaultApprovalTimeout = 5 * time.Minute
+
+// pendingApproval 等待决定的审批请求
+type pendingApproval struct {
+	request models.ApprovalRequest
+	done    chan struct{} // 决定后关闭
+}
+
+// ToolGuard 工具调用前置检查，返回错误时直接拒绝调用
+type ToolGuard func(agentID, tool string, input interface{}) error
+
+// ApprovalManager 工具调用审批管理器
+// 监听 Agent 的权限请求，按策略自动放行、拒绝，或挂起等待用户决定
+type ApprovalManager struct {
+	policies *storage.ApprovalPolicyStore
+	guards   []ToolGuard
+
+	mu           sync.Mutex
+	pending      map[string]*pendingApproval
+	listeners    map[int]func(models.ApprovalRequest)
+	nextListener int
+}
+
+// NewApprovalManager 创建审批管理器
+func NewApprovalManager(policies *storage.ApprovalPolicyStore) *ApprovalManager {
+	return &ApprovalManager{
+		policies:  policies,
+		pending:   make(map[string]*pendingApproval),
+		listeners: make(map[int]func(models.ApprovalRequest)),
+	}
+}
+
+// AddGuard 添加前置检查，在策略之前执行（需在创建 Agent 之前调用）
+func (am *ApprovalManager) AddGuard(guard ToolGuard) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	am.guards = append(am.guards, guard)
+}
+
+// ValidatePolicy 校验审批策略，并补全默认值；返回每条规则编译后的 arg_pattern（未设置时为 nil），
+// 与策略一起保存到 ApprovalPolicyStore，Evaluate 不再重复编译
+func ValidatePolicy(policy *models.ApprovalPolicy) ([]*regexp.Regexp, error) {
+	validAction := func(action string) bool {
+		switch action {
+		case models.ApprovalActionAllow, models.ApprovalActionRequire, models.ApprovalActionDeny:
+			return true
+		}
+		return false
+	}
+
+	patterns := make([]*regexp.Regexp, len(policy.Rules))
+	for i, rule := range policy.Rules {
+		if rule.Tool == "" {
+			return nil, fmt.Errorf("rule %d: tool must not be empty", i)
+		}
+		if !validAction(rule.Action) {
+			return nil, fmt.Errorf("rule %d: invalid action %q", i, rule.Action)
+		}
+		switch rule.Context {
+		case "", models.ApprovalContextSession, models.ApprovalContextWorkflow:
+		default:
+			return nil, fmt.Errorf("rule %d: invalid context %q", i, rule.Context)
+		}
+		if rule.ArgPattern != "" {
+			re, err := regexp.Compile(rule.ArgPattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid arg_pattern: %w", i, err)
+			}
+			patterns[i] = re
+		}
+	}
+
+	if policy.DefaultAction == "" {
+		policy.DefaultAction = models.ApprovalActionAllow
+	}
+	if !validAction(policy.DefaultAction) {
+		return nil, fmt.Errorf("invalid default_action %q", policy.DefaultAction)
+	}
+	if policy.TimeoutSeconds < 0 {
+		return nil, fmt.Errorf("timeout_seconds must not be negative")
+	}
+	return patterns, nil
+}
+
+// Evaluate 按策略判断工具调用的处理方式，返回动作和命中的规则说明
+// workflowID 为空表示会话 Agent，只匹配适用范围为空或与之相符的规则
+func (am *ApprovalManager) Evaluate(workflowID, tool, arguments string) (string, string) {
+	scope := models.ApprovalContextSession
+	if workflowID != "" {
+		scope = models.ApprovalContextWorkflow
+	}
+
+	policy, patterns := am.policies.GetCompiled()
+	for i, rule := range policy.Rules {
+		if rule.Tool != "*" && rule.Tool != tool {
+			continue
+		}
+		if rule.Context != "" && rule.Context != scope {
+			continue
+		}
+		if re := patterns[i]; re != nil && !re.MatchString(arguments) {
+			continue
+		}
+		return rule.Action, fmt.Sprintf("rule #%d (%s %s)", i, rule.Tool, rule.ArgPattern)
+	}
+	return policy.DefaultAction, "default"
+}
+
+// Watch 监听 Agent 的权限请求，workflowID 为空表示会话 Agent
+func (am *ApprovalManager) Watch(ag *agent.Agent, agentID, workflowID string) {
+	eventCh := ag.Subscribe([]types.AgentChannel{types.ChannelControl}, nil)
+	go func() {
+		for envelope := range eventCh {
+			evt, ok := envelope.Event.(*types.ControlPermissionRequiredEvent)
+			if !ok {
+				continue
+			}
+			go am.handlePermission(evt, agentID, workflowID)
+		}
+	}()
+}
+
+// handlePermission 处理一次权限请求
+func (am *ApprovalManager) handlePermission(evt *types.ControlPermissionRequiredEvent, agentID, workflowID string) {
+	arguments := ""
+	if evt.Call.InputPreview != nil {
+		if data, err := json.Marshal(evt.Call.InputPreview); err == nil {
+			arguments = string(data)
+		} else {
+			arguments = fmt.Sprintf("%v", evt.Call.InputPreview)
+		}
+	}
+
+	am.mu.Lock()
+	guards := am.guards
+	am.mu.Unlock()
+	for _, guard := range guards {
+		if err := guard(agentID, evt.Call.Name, evt.Call.InputPreview); err != nil {
+			log.Printf("[Approval] Agent %s tool %s rejected: %v", agentID, evt.Call.Name, err)
+			if err := evt.Respond("deny", err.Error()); err != nil {
+				log.Printf("[Approval] Failed to respond to permission request for %s: %v", evt.Call.Name, err)
+			}
+			return
+		}
+	}
+
+	action, rule := am.Evaluate(workflowID, evt.Call.Name, arguments)
+	log.Printf("[Approval] Agent %s tool %s -> %s (%s)", agentID, evt.Call.Name, action, rule)
+
+	decision, note := "deny", "denied by policy: "+rule
+	switch action {
+	case models.ApprovalActionAllow:
+		decision, note = "allow", "allowed by policy: "+rule
+	case models.ApprovalActionRequire:
+		request := am.open(agentID, workflowID, evt.Call.Name, arguments, rule)
+		resolved := am.wait(request.ID)
+		note = resolved.Note
+		if resolved.Status == models.ApprovalStatusAllowed {
+			decision = "allow"
+		}
+	}
+
+	if err := evt.Respond(decision, note); err != nil {
+		log.Printf("[Approval] Failed to respond to permission request for %s: %v", evt.Call.Name, err)
+	}
+}
+
+// open 创建待审批请求并通知监听者
+func (am *ApprovalManager) open(agentID, workflowID, tool, arguments, rule string) models.ApprovalRequest {
+	timeout := defaultApprovalTimeout
+	if seconds := am.policies.Get().TimeoutSeconds; seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	now := time.Now()
+	request := models.ApprovalRequest{
+		ID:         uuid.New().String(),
+		AgentID:    agentID,
+		WorkflowID: workflowID,
+		Tool:       tool,
+		Arguments:  arguments,
+		Rule:       rule,
+		Status:     models.ApprovalStatusPending,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(timeout),
+	}
+
+	am.mu.Lock()
+	am.pending[request.ID] = &pendingApproval{
+		request: request,
+		done:    make(chan struct{}),
+	}
+	am.mu.Unlock()
+
+	am.notify(request)
+	return request
+}
+
+// wait 等待用户决定，超时视为拒绝
+func (am *ApprovalManager) wait(requestID string) models.ApprovalRequest {
+	am.mu.Lock()
+	p := am.pending[requestID]
+	am.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(p.request.ExpiresAt))
+	defer timer.Stop()
+
+	select {
+	case <-p.done:
+	case <-timer.C:
+		am.resolve(requestID, models.ApprovalStatusTimeout, "approval timed out")
+	}
+
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	request := p.request
+	delete(am.pending, requestID)
+	return request
+}
+
+// Decide 用户对审批请求做出决定
+func (am *ApprovalManager) Decide(requestID, decision, note string) error {
+	var status string
+	switch decision {
+	case "allow":
+		status = models.ApprovalStatusAllowed
+	case "deny":
+		status = models.ApprovalStatusDenied
+	default:
+		return fmt.Errorf("invalid decision %q, expected allow or deny", decision)
+	}
+
+	if !am.resolve(requestID, status, note) {
+		return fmt.Errorf("no pending approval request: %s", requestID)
+	}
+	return nil
+}
+
+// resolve 结束审批请求，请求不存在或已结束时返回 false
+func (am *ApprovalManager) resolve(requestID, status, note string) bool {
+	am.mu.Lock()
+	p, ok := am.pending[requestID]
+	if !ok || p.request.Status != models.ApprovalStatusPending {
+		am.mu.Unlock()
+		return false
+	}
+
+	now := time.Now()
+	p.request.Status = status
+	p.request.Note = note
+	p.request.DecidedAt = &now
+	request := p.request
+	close(p.done)
+	am.mu.Unlock()
+
+	am.notify(request)
+	return true
+}
+
+// Get 获取待审批请求
+func (am *ApprovalManager) Get(requestID string) (models.ApprovalRequest, bool) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	p, ok := am.pending[requestID]
+	if !ok {
+		return models.ApprovalRequest{}, false
+	}
+	return p.request, true
+}
+
+// Pending 列出待审批请求，agentID / workflowID 为空时不过滤
+func (am *ApprovalManager) Pending(agentID, workflowID string) []models.ApprovalRequest {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	requests := make([]models.ApprovalRequest, 0)
+	for _, p := range am.pending {
+		if p.request.Status != models.ApprovalStatusPending {
+			continue
+		}
+		if agentID != "" && p.request.AgentID != agentID {
+			continue
+		}
+		if workflowID != "" && p.request.WorkflowID != workflowID {
+			continue
+		}
+		requests = append(requests, p.request)
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	return requests
+}
+
+// Listen 注册监听函数，在审批请求创建和结束时调用；返回取消注册的函数
+func (am *ApprovalManager) Listen(fn func(models.ApprovalRequest)) func() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	id := am.nextListener
+	am.nextListener++
+	am.listeners[id] = fn
+
+	return func() {
+		am.mu.Lock()
+		defer am.mu.Unlock()
+		delete(am.listeners, id)
+	}
+}
+
+// notify 通知所有监听者
+func (am *ApprovalManager) notify(request models.ApprovalRequest) {
+	am.mu.Lock()
+	listeners := make([]func(models.ApprovalRequest), 0, len(am.listeners))
+	for _, fn := range am.listeners {
+		listeners = append(listeners, fn)
+	}
+	am.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(request)
+	}
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"os"
+	"testing"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/wordflowlab/agentsdk/pkg/types"
+)
+
+// newDefaultApprovalManager 在没有策略文件的临时目录中创建审批管理器（使用默认策略）
+func newDefaultApprovalManager(t *testing.T) *ApprovalManager {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	policies, err := storage.NewApprovalPolicyStore(ValidatePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewApprovalManager(policies)
+}
+
+// TestDefaultPolicyLetsWorkflowStagesFinish 默认策略下工作流各阶段的工具调用都自动放行，不会挂起等待审批
+func TestDefaultPolicyLetsWorkflowStagesFinish(t *testing.T) {
+	am := newDefaultApprovalManager(t)
+
+	stages := []struct {
+		def      *types.AgentTemplateDefinition
+		artifact string
+	}{
+		{GetResearcherTemplate(), "outline.md"},
+		{GetWriterTemplate(), "draft.md"},
+		{GetEditorTemplate(), "final.md"},
+	}
+	for _, stage := range stages {
+		tools, _ := stage.def.Tools.([]interface{})
+		if len(tools) == 0 {
+			t.Fatalf("template %s has no tools", stage.def.ID)
+		}
+		for _, tool := range tools {
+			name := tool.(string)
+			arguments := `{"path":"` + stage.artifact + `","content":"..."}`
+			action, rule := am.Evaluate("wf-1", name, arguments)
+			if action != models.ApprovalActionAllow {
+				t.Errorf("%s: workflow tool %s -> %s (%s), want %s", stage.def.ID, name, action, rule, models.ApprovalActionAllow)
+			}
+		}
+	}
+}
+
+// TestDefaultPolicyRequiresApprovalForSessions 默认策略下会话 Agent 执行命令和写文件仍需审批
+func TestDefaultPolicyRequiresApprovalForSessions(t *testing.T) {
+	am := newDefaultApprovalManager(t)
+
+	for _, tool := range []string{"bash_run", "fs_write"} {
+		if action, _ := am.Evaluate("", tool, "{}"); action != models.ApprovalActionRequire {
+			t.Errorf("session tool %s -> %s, want %s", tool, action, models.ApprovalActionRequire)
+		}
+	}
+	if action, _ := am.Evaluate("", "fs_read", "{}"); action != models.ApprovalActionAllow {
+		t.Errorf("session tool fs_read -> %s, want %s", action, models.ApprovalActionAllow)
+	}
+}
@@ -0,0 +1,298 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/wordflowlab/agentsdk/pkg/agent"
+	"github.com/wordflowlab/agentsdk/pkg/types"
+)
+
+// 派生模板 ID 的分隔符，自定义模板 ID 中不允许出现
+const derivedTemplateSeparator = "+guide-"
+
+// catalogEntry 模板目录条目
+type catalogEntry struct {
+	def         *types.AgentTemplateDefinition
+	name        string
+	description string
+	suitability []string
+	builtin     bool
+}
+
+// TemplateCatalog 模板目录
+// 在 SDK 的 TemplateRegistry 之外保留一份模板定义，用于查询和派生模板
+type TemplateCatalog struct {
+	mu        sync.RWMutex
+	registry  *agent.TemplateRegistry
+	templates map[string]*catalogEntry
+	derived   map[string]*types.AgentTemplateDefinition // 派生模板（不对外列出）
+}
+
+// NewTemplateCatalog 创建模板目录
+func NewTemplateCatalog(registry *agent.TemplateRegistry) *TemplateCatalog {
+	return &TemplateCatalog{
+		registry:  registry,
+		templates: make(map[string]*catalogEntry),
+		derived:   make(map[string]*types.AgentTemplateDefinition),
+	}
+}
+
+// Register 注册内置模板（只读）
+func (c *TemplateCatalog) Register(def *types.AgentTemplateDefinition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	meta, ok := builtinTemplateMeta[def.ID]
+	if !ok {
+		meta = templateMeta{Name: def.ID, Suitability: []string{models.SuitabilityChat}}
+	}
+
+	c.templates[def.ID] = &catalogEntry{
+		def:         def,
+		name:        meta.Name,
+		description: meta.Description,
+		suitability: meta.Suitability,
+		builtin:     true,
+	}
+	requireApproval(def)
+	c.registry.Register(def)
+}
+
+// RegisterCustom 注册或更新自定义模板
+func (c *TemplateCatalog) RegisterCustom(t *models.CustomTemplate) error {
+	if strings.Contains(t.ID, derivedTemplateSeparator) {
+		return fmt.Errorf("invalid template id: %s", t.ID)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, ok := c.templates[t.ID]; ok && existing.builtin {
+		return fmt.Errorf("template %s is built-in and read-only", t.ID)
+	}
+
+	tools := make([]interface{}, 0, len(t.Tools))
+	for _, tool := range t.Tools {
+		tools = append(tools, tool)
+	}
+	def := &types.AgentTemplateDefinition{
+		ID:           t.ID,
+		Model:        t.Model,
+		SystemPrompt: t.SystemPrompt,
+		Tools:        tools,
+	}
+
+	name := t.Name
+	if name == "" {
+		name = t.ID
+	}
+	suitability := t.Suitability
+	if len(suitability) == 0 {
+		suitability = []string{models.SuitabilityChat}
+	}
+	c.templates[t.ID] = &catalogEntry{
+		def:         def,
+		name:        name,
+		description: t.Description,
+		suitability: suitability,
+	}
+	requireApproval(def)
+	c.registry.Register(def)
+	c.dropDerived(t.ID)
+
+	return nil
+}
+
+// Unregister 移除自定义模板
+// SDK 的 TemplateRegistry 不支持注销，已注册的定义仍保留在其中，
+// 但目录中不再可见，新的会话无法再选择该模板
+func (c *TemplateCatalog) Unregister(templateID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.templates[templateID]
+	if !ok {
+		return fmt.Errorf("template not found: %s", templateID)
+	}
+	if entry.builtin {
+		return fmt.Errorf("template %s is built-in and read-only", templateID)
+	}
+
+	delete(c.templates, templateID)
+	c.dropDerived(templateID)
+	return nil
+}
+
+// Get 获取模板定义
+func (c *TemplateCatalog) Get(templateID string) (*types.AgentTemplateDefinition, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.templates[templateID]
+	if !ok {
+		return nil, false
+	}
+	return entry.def, true
+}
+
+// CheckChat 检查模板是否存在且可作为会话的 agent_type（适用场景包含 chat）
+func (c *TemplateCatalog) CheckChat(templateID string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.templates[templateID]
+	if !ok {
+		return fmt.Errorf("unknown agent_type %q, see GET /api/templates", templateID)
+	}
+	if !entry.suits(models.SuitabilityChat) {
+		return fmt.Errorf("agent_type %q is not a chat template, see GET /api/templates?suitability=chat", templateID)
+	}
+	return nil
+}
+
+// IsBuiltin 是否为内置模板
+func (c *TemplateCatalog) IsBuiltin(templateID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.templates[templateID]
+	return ok && entry.builtin
+}
+
+// Info 获取模板信息
+func (c *TemplateCatalog) Info(templateID string) (models.TemplateInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.templates[templateID]
+	if !ok {
+		return models.TemplateInfo{}, false
+	}
+	return entry.info(), true
+}
+
+// List 列出模板（内置模板在前），suitability 非空时只返回适用于该场景的模板
+func (c *TemplateCatalog) List(suitability string) []models.TemplateInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	infos := make([]models.TemplateInfo, 0, len(c.templates))
+	for _, entry := range c.templates {
+		if suitability != "" && !entry.suits(suitability) {
+			continue
+		}
+		infos = append(infos, entry.info())
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Builtin != infos[j].Builtin {
+			return infos[i].Builtin
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// WithGuidance 基于已有模板派生一个附加了规范说明的模板，返回派生模板 ID
+// 派生模板 ID 只取决于基础模板、术语表和风格指南的 ID：规范更新版本后复用同一个 ID 并覆盖注册的定义，
+// 注册表中的派生模板数量不会随版本增长
+func (c *TemplateCatalog) WithGuidance(baseID string, guidance *Guidance) (string, error) {
+	prompt := guidance.Prompt()
+	if prompt == "" {
+		return baseID, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.templates[baseID]
+	if !ok {
+		return "", fmt.Errorf("template not found: %s", baseID)
+	}
+	base := entry.def
+
+	sum := sha256.Sum256([]byte(guidance.key()))
+	derivedID := baseID + derivedTemplateSeparator + hex.EncodeToString(sum[:6])
+	systemPrompt := base.SystemPrompt + "\n\n" + prompt
+	if existing, exists := c.derived[derivedID]; exists && existing.SystemPrompt == systemPrompt {
+		return derivedID, nil
+	}
+
+	def := *base
+	def.ID = derivedID
+	def.SystemPrompt = systemPrompt
+	c.derived[derivedID] = &def
+	c.registry.Register(&def)
+
+	return derivedID, nil
+}
+
+// definition 获取模板定义（包括派生模板）
+func (c *TemplateCatalog) definition(templateID string) (*types.AgentTemplateDefinition, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if entry, ok := c.templates[templateID]; ok {
+		return entry.def, true
+	}
+	def, ok := c.derived[templateID]
+	return def, ok
+}
+
+// dropDerived 清除某个基础模板的派生模板缓存（调用方需持有写锁）
+func (c *TemplateCatalog) dropDerived(baseID string) {
+	for id := range c.derived {
+		if strings.HasPrefix(id, baseID+derivedTemplateSeparator) {
+			delete(c.derived, id)
+		}
+	}
+}
+
+// requireApproval 带工具的模板以审批模式运行，工具调用前由 ApprovalManager 按策略决定是否放行
+func requireApproval(def *types.AgentTemplateDefinition) {
+	var raw interface{} = def.Tools
+	if list, ok := raw.([]interface{}); ok && len(list) == 0 {
+		return
+	}
+	def.Permission = &types.PermissionConfig{Mode: types.PermissionModeApproval}
+}
+
+// suits 是否适用于指定场景
+func (e *catalogEntry) suits(suitability string) bool {
+	for _, s := range e.suitability {
+		if s == suitability {
+			return true
+		}
+	}
+	return false
+}
+
+// info 转换为模板信息
+func (e *catalogEntry) info() models.TemplateInfo {
+	tools := make([]string, 0)
+	var raw interface{} = e.def.Tools
+	if list, ok := raw.([]interface{}); ok {
+		for _, tool := range list {
+			if name, ok := tool.(string); ok {
+				tools = append(tools, name)
+			}
+		}
+	}
+
+	return models.TemplateInfo{
+		ID:           e.def.ID,
+		Name:         e.name,
+		Description:  e.description,
+		SystemPrompt: e.def.SystemPrompt,
+		Tools:        tools,
+		Model:        e.def.Model,
+		Suitability:  e.suitability,
+		Builtin:      e.builtin,
+	}
+}
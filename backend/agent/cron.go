@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchYears 查找下一次运行时间的最大范围（如 2 月 30 日这类永远不会到来的表达式）
+const cronSearchYears = 5
+
+// cronMacros 常用表达式的简写
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// CronSchedule 解析后的 cron 表达式（分 时 日 月 周）
+// 每个字段支持 *、数字、范围 a-b、列表 a,b 和步长 */n、a-b/n；周字段 0 和 7 都表示周日。
+// 日和周同时受限（没有覆盖全部取值）时满足其一即可（与 Vixie cron 一致）
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64 // 位图
+	domAny, dowAny                bool
+}
+
+// ParseCron 解析 5 字段的 cron 表达式或 @daily、@weekly 等简写
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+
+	var s CronSchedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 与 0 都是周日
+	}
+	// 按解析结果判断字段是否受限，*/1、1-31 等覆盖全部取值的写法与 * 相同
+	s.domAny = s.dom == cronFieldAll(1, 31)
+	s.dowAny = s.dow&cronFieldAll(0, 6) == cronFieldAll(0, 6)
+	return &s, nil
+}
+
+// Next 返回 after 之后（不含）的下一次运行时间，按 after 所在的时区计算；找不到时返回零值
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Year() + cronSearchYears
+
+	for t.Year() <= limit {
+		var next time.Time
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			// 按绝对时间前进到下一个整点，夏令时切换时 time.Date 可能把不存在的时刻归一化到之前
+			next = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+		if !next.After(t) {
+			next = t.Add(time.Hour)
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+// dayMatches 日期是否匹配日和周字段
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// cronFieldAll 取值范围 min-max 全部置位的位图
+func cronFieldAll(min, max int) uint64 {
+	var bits uint64
+	for v := min; v <= max; v++ {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+// parseCronField 解析一个字段为位图
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max // a/n 表示从 a 开始每隔 n
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
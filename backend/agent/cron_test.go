@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCronFullRangeFieldIsUnrestricted */1、1-31 覆盖全部取值，与 * 一样不触发日和周的“或”语义
+func TestCronFullRangeFieldIsUnrestricted(t *testing.T) {
+	for _, expr := range []string{"0 9 */1 * 1", "0 9 1-31 * 1", "0 9 * * 1"} {
+		s, err := ParseCron(expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", expr, err)
+		}
+
+		// 2026-06-02 为周二，之后的运行时间都应是周一 9:00
+		next := time.Date(2026, 6, 2, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < 5; i++ {
+			next = s.Next(next)
+			if next.Weekday() != time.Monday || next.Hour() != 9 || next.Minute() != 0 {
+				t.Fatalf("%q: run %d at %s, want Monday 09:00", expr, i, next.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// TestCronDayOrWeekday 日和周都受限时满足其一即运行
+func TestCronDayOrWeekday(t *testing.T) {
+	s, err := ParseCron("0 9 1 * 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2026-06-01 为周一；之后依次是 6/8、6/15、6/22、6/29（周一）和 7/1（1 日）
+	want := []int{1, 8, 15, 22, 29, 1}
+	next := time.Date(2026, 5, 31, 0, 0, 0, 0, time.UTC)
+	for i, day := range want {
+		next = s.Next(next)
+		if next.Day() != day {
+			t.Fatalf("run %d at %s, want day %d", i, next.Format(time.RFC3339), day)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coso/agentdemo/backend/models"
+)
+
+// Guidance 写作规范：术语表与风格指南
+// 为 nil 时表示没有附加任何规范
+type Guidance struct {
+	Glossary   *models.Glossary
+	StyleGuide *models.StyleGuide
+}
+
+// Prompt 生成注入到系统提示词中的规范说明
+func (g *Guidance) Prompt() string {
+	if g == nil || (g.Glossary == nil && g.StyleGuide == nil) {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("## 术语与风格规范（必须严格遵守）\n")
+
+	if g.Glossary != nil && len(g.Glossary.Terms) > 0 {
+		var preferred, banned, products []string
+		for _, term := range g.Glossary.Terms {
+			switch term.Type {
+			case models.TermTypeBanned:
+				line := "- " + term.Term
+				if term.Preferred != "" {
+					line += " → 改用「" + term.Preferred + "」"
+				}
+				banned = append(banned, line)
+			case models.TermTypeProduct:
+				products = append(products, "- "+term.Term)
+			default:
+				line := "- " + term.Term
+				if term.Note != "" {
+					line += "（" + term.Note + "）"
+				}
+				preferred = append(preferred, line)
+			}
+		}
+
+		b.WriteString(fmt.Sprintf("\n### 术语表：%s（v%d）\n", g.Glossary.Name, g.Glossary.Version))
+		if len(preferred) > 0 {
+			b.WriteString("推荐用语：\n" + strings.Join(preferred, "\n") + "\n")
+		}
+		if len(banned) > 0 {
+			b.WriteString("禁用词（输出中不得出现）：\n" + strings.Join(banned, "\n") + "\n")
+		}
+		if len(products) > 0 {
+			b.WriteString("产品名称（必须保持以下写法，不得翻译或改变大小写）：\n" + strings.Join(products, "\n") + "\n")
+		}
+	}
+
+	if g.StyleGuide != nil && strings.TrimSpace(g.StyleGuide.Content) != "" {
+		b.WriteString(fmt.Sprintf("\n### 风格指南：%s（v%d）\n", g.StyleGuide.Name, g.StyleGuide.Version))
+		b.WriteString(strings.TrimSpace(g.StyleGuide.Content) + "\n")
+	}
+
+	return b.String()
+}
+
+// key 规范的标识（术语表与风格指南的 ID，不含版本），用于派生模板 ID
+func (g *Guidance) key() string {
+	var glossaryID, styleGuideID string
+	if g.Glossary != nil {
+		glossaryID = g.Glossary.ID
+	}
+	if g.StyleGuide != nil {
+		styleGuideID = g.StyleGuide.ID
+	}
+	return glossaryID + "\x00" + styleGuideID
+}
+
+// Check 检查输出中仍然出现的禁用词（不区分大小写）
+func (g *Guidance) Check(text string) []models.GuideViolation {
+	if g == nil || g.Glossary == nil || text == "" {
+		return nil
+	}
+
+	lower := strings.ToLower(text)
+	var violations []models.GuideViolation
+	for _, term := range g.Glossary.Terms {
+		if term.Type != models.TermTypeBanned {
+			continue
+		}
+		if count := strings.Count(lower, strings.ToLower(term.Term)); count > 0 {
+			violations = append(violations, models.GuideViolation{
+				Term:      term.Term,
+				Preferred: term.Preferred,
+				Count:     count,
+			})
+		}
+	}
+	return violations
+}
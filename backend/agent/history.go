@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"log"
+
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/wordflowlab/agentsdk/pkg/agent"
+	"github.com/wordflowlab/agentsdk/pkg/types"
+)
+
+// RecordHistory 监听会话 Agent，在消息写入后及时同步消息历史，
+// 使每条消息记录的时间戳接近其实际写入时间（而不是第一次被读取的时间）
+func RecordHistory(manager *Manager, history *storage.HistoryStore) {
+	manager.OnSessionAgentCreated(func(ag *agent.Agent, sessionID string) {
+		agentID := ag.ID()
+		eventCh := ag.Subscribe([]types.AgentChannel{types.ChannelProgress}, nil)
+		go func() {
+			for envelope := range eventCh {
+				switch envelope.Event.(type) {
+				case *types.ProgressTextChunkStartEvent, *types.ProgressToolEndEvent, *types.ProgressDoneEvent:
+					if _, err := history.Sync(agentID); err != nil {
+						log.Printf("[History] Failed to sync history of session %s: %v", sessionID, err)
+					}
+				}
+			}
+		}()
+	})
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
 	"github.com/wordflowlab/agentsdk/pkg/agent"
 	"github.com/wordflowlab/agentsdk/pkg/provider"
 	"github.com/wordflowlab/agentsdk/pkg/sandbox"
@@ -21,10 +24,16 @@ type Manager struct {
 	agents           map[string]*agent.Agent
 	deps             *agent.Dependencies
 	templateRegistry *agent.TemplateRegistry
+	templates        *TemplateCatalog
+	guideStore       *storage.GuideStore
+	approvals        *ApprovalManager
+	workspaces       *storage.WorkspaceStore
+	agentSessions    map[string]string // agentID -> sessionID，用于工作区配额检查
+	sessionHooks     []func(ag *agent.Agent, sessionID string)
 }
 
 // NewManager 创建 Agent 管理器
-func NewManager() (*Manager, error) {
+func NewManager(guideStore *storage.GuideStore, templateStore *storage.TemplateStore, approvals *ApprovalManager, workspaces *storage.WorkspaceStore) (*Manager, error) {
 	// 检查 API Key (yunwu.ai 可以使用任意 key)
 	apiKey := os.Getenv("ANTHROPIC_API_KEY")
 	if apiKey == "" {
@@ -57,19 +66,27 @@ func NewManager() (*Manager, error) {
 	// 创建模板注册表
 	templateRegistry := agent.NewTemplateRegistry()
 
+	templates := NewTemplateCatalog(templateRegistry)
+
 	// 注册所有模板（包括新的协作模板）
-	// RegisterAllTemplates 在 templates.go 中定义
-	// 这里直接注册模板
-	templateRegistry.Register(GetSimpleChatTemplate())      // 简单对话（支持 Skills 和 Commands）
-	templateRegistry.Register(GetResearcherTemplate())
-	templateRegistry.Register(GetWriterTemplate())
-	templateRegistry.Register(GetEditorTemplate())
-	templateRegistry.Register(GetWritingAssistantTemplate())
-	templateRegistry.Register(GetPolishTemplate())
-	templateRegistry.Register(GetRewriteTemplate())
-	templateRegistry.Register(GetExpandTemplate())
-	templateRegistry.Register(GetSummarizeTemplate())
-	templateRegistry.Register(GetTranslateTemplate("英文"))
+	templates.Register(GetSimpleChatTemplate()) // 简单对话（支持 Skills 和 Commands）
+	templates.Register(GetResearcherTemplate())
+	templates.Register(GetWriterTemplate())
+	templates.Register(GetEditorTemplate())
+	templates.Register(GetWritingAssistantTemplate())
+	templates.Register(GetPolishTemplate())
+	templates.Register(GetRewriteTemplate())
+	templates.Register(GetExpandTemplate())
+	templates.Register(GetSummarizeTemplate())
+	templates.Register(GetTranslateTemplate())
+	templates.Register(GetTitleGeneratorTemplate())
+
+	// 注册持久化的自定义模板
+	for _, t := range templateStore.List() {
+		if err := templates.RegisterCustom(t); err != nil {
+			return nil, fmt.Errorf("register custom template %s: %w", t.ID, err)
+		}
+	}
 
 	// 创建依赖
 	deps := &agent.Dependencies{
@@ -80,21 +97,117 @@ func NewManager() (*Manager, error) {
 		TemplateRegistry: templateRegistry,
 	}
 
-	return &Manager{
+	m := &Manager{
 		agents:           make(map[string]*agent.Agent),
 		deps:             deps,
 		templateRegistry: templateRegistry,
-	}, nil
+		templates:        templates,
+		guideStore:       guideStore,
+		approvals:        approvals,
+		workspaces:       workspaces,
+		agentSessions:    make(map[string]string),
+	}
+	approvals.AddGuard(m.checkWorkspaceQuota)
+
+	return m, nil
+}
+
+// Templates 获取模板目录
+func (m *Manager) Templates() *TemplateCatalog {
+	return m.templates
+}
+
+// Approvals 获取工具审批管理器
+func (m *Manager) Approvals() *ApprovalManager {
+	return m.approvals
+}
+
+// OnSessionAgentCreated 注册会话 Agent 创建后的回调（需在处理请求之前调用）
+func (m *Manager) OnSessionAgentCreated(fn func(ag *agent.Agent, sessionID string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessionHooks = append(m.sessionHooks, fn)
+}
+
+// LoadGuidance 根据引用加载术语表与风格指南，未引用任何规范时返回 nil
+func (m *Manager) LoadGuidance(refs models.GuideRefs) (*Guidance, error) {
+	if refs.GlossaryID == "" && refs.StyleGuideID == "" {
+		return nil, nil
+	}
+
+	guidance := &Guidance{}
+	if refs.GlossaryID != "" {
+		glossary, err := m.guideStore.GetGlossary(refs.GlossaryID, 0)
+		if err != nil {
+			return nil, err
+		}
+		guidance.Glossary = glossary
+	}
+	if refs.StyleGuideID != "" {
+		styleGuide, err := m.guideStore.GetStyleGuide(refs.StyleGuideID, 0)
+		if err != nil {
+			return nil, err
+		}
+		guidance.StyleGuide = styleGuide
+	}
+	return guidance, nil
+}
+
+// GetOrCreateSessionAgent 获取或创建会话的 Agent
+// 会话附加了术语表或风格指南时，使用注入规范后的派生模板
+func (m *Manager) GetOrCreateSessionAgent(ctx context.Context, session *models.Session) (*agent.Agent, error) {
+	if _, ok := m.templates.Get(session.AgentType); !ok {
+		return nil, fmt.Errorf("template not found: %s", session.AgentType)
+	}
+
+	guidance, err := m.LoadGuidance(session.GuideRefs)
+	if err != nil {
+		return nil, fmt.Errorf("load guidance: %w", err)
+	}
+
+	templateID, err := m.templates.WithGuidance(session.AgentType, guidance)
+	if err != nil {
+		return nil, err
+	}
+
+	workDir, err := m.workspaces.SessionDir(session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.agentSessions[session.AgentID] = session.ID
+	hooks := m.sessionHooks
+	m.mu.Unlock()
+
+	ag, created, err := m.getOrCreateAgent(ctx, session.AgentID, templateID, session.Model, workDir)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		for _, hook := range hooks {
+			hook(ag, session.ID)
+		}
+	}
+	return ag, nil
+}
+
+// GetOrCreateAgent 获取或创建 Agent，workDir 为 Agent 的沙箱工作目录
+func (m *Manager) GetOrCreateAgent(ctx context.Context, agentID string, templateID string, workDir string) (*agent.Agent, error) {
+	ag, _, err := m.getOrCreateAgent(ctx, agentID, templateID, "", workDir)
+	return ag, err
 }
 
-// GetOrCreateAgent 获取或创建 Agent
-func (m *Manager) GetOrCreateAgent(ctx context.Context, agentID string, templateID string) (*agent.Agent, error) {
+// getOrCreateAgent 获取或创建 Agent，created 表示是否为新创建
+// modelOverride 不为空时优先于模板和环境变量中的模型（仅在新建 Agent 时生效）
+func (m *Manager) getOrCreateAgent(ctx context.Context, agentID string, templateID string, modelOverride string, workDir string) (*agent.Agent, bool, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// 如果 Agent 已存在，直接返回
 	if ag, ok := m.agents[agentID]; ok {
-		return ag, nil
+		return ag, false, nil
 	}
 
 	// 创建新 Agent
@@ -116,16 +229,7 @@ func (m *Manager) GetOrCreateAgent(ctx context.Context, agentID string, template
 	}
 
 	// 获取模型配置
-	model := os.Getenv("MODEL")
-	if model == "" {
-		if providerType == "glm" {
-			model = "glm-4" // GLM 默认模型
-		} else if providerType == "deepseek" {
-			model = "deepseek-chat" // Deepseek 默认模型
-		} else {
-			model = "claude-3-haiku-20240307" // Anthropic 默认模型
-		}
-	}
+	model := m.resolveModel(providerType, templateID, modelOverride)
 
 	baseURL := os.Getenv("BASE_URL")
 	if baseURL == "" {
@@ -141,7 +245,7 @@ func (m *Manager) GetOrCreateAgent(ctx context.Context, agentID string, template
 	// 获取当前工作目录的绝对路径
 	currentDir, err := os.Getwd()
 	if err != nil {
-		return nil, fmt.Errorf("get current directory: %w", err)
+		return nil, false, fmt.Errorf("get current directory: %w", err)
 	}
 
 	config := &types.AgentConfig{
@@ -155,7 +259,7 @@ func (m *Manager) GetOrCreateAgent(ctx context.Context, agentID string, template
 		},
 		Sandbox: &types.SandboxConfig{
 			Kind:    types.SandboxKindLocal,
-			WorkDir: currentDir + "/workspace",
+			WorkDir: workDir,
 		},
 		SkillsPackage: &types.SkillsPackageConfig{
 			Source:          "local",
@@ -171,11 +275,63 @@ func (m *Manager) GetOrCreateAgent(ctx context.Context, agentID string, template
 
 	ag, err := agent.Create(ctx, config, m.deps)
 	if err != nil {
-		return nil, fmt.Errorf("create agent: %w", err)
+		return nil, false, fmt.Errorf("create agent: %w", err)
 	}
+	m.approvals.Watch(ag, agentID, "")
 
 	m.agents[agentID] = ag
-	return ag, nil
+	return ag, true, nil
+}
+
+// SwitchSessionTemplate 将会话切换到另一个模板
+// 关闭当前 Agent 并修改 session.AgentType，调用方负责持久化会话；
+// Agent ID 不变，重建时历史消息由 Store 按 Agent ID 加载
+func (m *Manager) SwitchSessionTemplate(session *models.Session, templateID string) error {
+	if err := m.templates.CheckChat(templateID); err != nil {
+		return err
+	}
+	if session.AgentType == templateID {
+		return nil
+	}
+
+	if err := m.RemoveAgent(session.AgentID); err != nil {
+		return err
+	}
+	session.AgentType = templateID
+	return nil
+}
+
+// SessionModel 会话 Agent 使用的模型
+func (m *Manager) SessionModel(session *models.Session) string {
+	providerType := os.Getenv("PROVIDER")
+	if providerType == "" {
+		providerType = "anthropic"
+	}
+	return m.resolveModel(providerType, session.AgentType, session.Model)
+}
+
+// resolveModel 确定 Agent 使用的模型：override > 模板默认模型 > MODEL 环境变量 > Provider 默认模型
+func (m *Manager) resolveModel(providerType, templateID, override string) string {
+	if override != "" {
+		return override
+	}
+
+	// 模板指定了默认模型时优先使用
+	if def, ok := m.templates.definition(templateID); ok && def.Model != "" {
+		return def.Model
+	}
+
+	model := os.Getenv("MODEL")
+	if model == "" {
+		if providerType == "glm" {
+			model = "glm-4" // GLM 默认模型
+		} else if providerType == "deepseek" {
+			model = "deepseek-chat" // Deepseek 默认模型
+		} else {
+			model = "claude-3-haiku-20240307" // Anthropic 默认模型
+		}
+	}
+	return model
 }
 
 // GetAgent 获取 Agent
@@ -187,8 +343,10 @@ func (m *Manager) GetAgent(agentID string) (*agent.Agent, bool) {
 	return ag, ok
 }
 
-// CreateTemporaryAgent 创建临时 Agent（用于写作工具）
-func (m *Manager) CreateTemporaryAgent(ctx context.Context, templateID string) (*agent.Agent, error) {
+// CreateTemporaryAgent 创建临时 Agent（用于写作工具、OpenAI 兼容接口等一次性调用）
+// modelOverride 不为空时优先于模板和环境变量中的模型；
+// 每个临时 Agent 使用独立的工作目录，调用方用完后调用返回的 release 关闭 Agent 并清理目录
+func (m *Manager) CreateTemporaryAgent(ctx context.Context, templateID string, modelOverride string) (*agent.Agent, func(), error) {
 	// 根据环境变量选择 Provider
 	providerType := os.Getenv("PROVIDER")
 	if providerType == "" {
@@ -207,16 +365,7 @@ func (m *Manager) CreateTemporaryAgent(ctx context.Context, templateID string) (
 	}
 
 	// 获取模型配置
-	model := os.Getenv("MODEL")
-	if model == "" {
-		if providerType == "glm" {
-			model = "glm-4" // GLM 默认模型
-		} else if providerType == "deepseek" {
-			model = "deepseek-chat" // Deepseek 默认模型
-		} else {
-			model = "claude-3-haiku-20240307" // Anthropic 默认模型
-		}
-	}
+	model := m.resolveModel(providerType, templateID, modelOverride)
 
 	baseURL := os.Getenv("BASE_URL")
 	if baseURL == "" {
@@ -232,7 +381,12 @@ func (m *Manager) CreateTemporaryAgent(ctx context.Context, templateID string) (
 	// 获取当前工作目录的绝对路径
 	currentDir, err := os.Getwd()
 	if err != nil {
-		return nil, fmt.Errorf("get current directory: %w", err)
+		return nil, nil, fmt.Errorf("get current directory: %w", err)
+	}
+
+	workDir, cleanup, err := m.workspaces.TempDir()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	config := &types.AgentConfig{
@@ -245,7 +399,7 @@ func (m *Manager) CreateTemporaryAgent(ctx context.Context, templateID string) (
 		},
 		Sandbox: &types.SandboxConfig{
 			Kind:    types.SandboxKindLocal,
-			WorkDir: currentDir + "/workspace",
+			WorkDir: workDir,
 		},
 		SkillsPackage: &types.SkillsPackageConfig{
 			Source:          "local",
@@ -261,10 +415,16 @@ func (m *Manager) CreateTemporaryAgent(ctx context.Context, templateID string) (
 
 	ag, err := agent.Create(ctx, config, m.deps)
 	if err != nil {
-		return nil, fmt.Errorf("create temporary agent: %w", err)
+		cleanup()
+		return nil, nil, fmt.Errorf("create temporary agent: %w", err)
 	}
+	m.approvals.Watch(ag, ag.ID(), "")
 
-	return ag, nil
+	release := func() {
+		ag.Close()
+		cleanup()
+	}
+	return ag, release, nil
 }
 
 // RemoveAgent 移除 Agent
@@ -282,9 +442,43 @@ func (m *Manager) RemoveAgent(agentID string) error {
 	}
 
 	delete(m.agents, agentID)
+	delete(m.agentSessions, agentID)
 	return nil
 }
 
+// checkWorkspaceQuota 会话 Agent 写文件前检查路径是否在工作区内、写入后是否超出配额
+func (m *Manager) checkWorkspaceQuota(agentID, tool string, input interface{}) error {
+	if tool != "fs_write" {
+		return nil
+	}
+
+	m.mu.RLock()
+	sessionID, ok := m.agentSessions[agentID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	args, _ := input.(map[string]interface{})
+	path, _ := args["path"].(string)
+	content, _ := args["content"].(string)
+
+	// 绝对路径转换为相对于工作区的路径，越出工作区的由 Resolve 拒绝
+	if filepath.IsAbs(path) {
+		workDir, err := m.workspaces.SessionDir(sessionID)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(workDir, path)
+		if err != nil {
+			return fmt.Errorf("%w: %q", storage.ErrInvalidPath, path)
+		}
+		path = rel
+	}
+
+	return m.workspaces.CheckQuota(sessionID, path, int64(len(content)))
+}
+
 // Close 关闭所有 Agent
 func (m *Manager) Close() error {
 	m.mu.Lock()
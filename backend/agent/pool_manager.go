@@ -17,6 +17,7 @@ type PoolManager struct {
 	deps         *agent.Dependencies
 	mu           sync.RWMutex
 	workflowDeps map[string]*WorkflowDependencies // workflowID -> deps
+	approvals    *ApprovalManager
 }
 
 // WorkflowDependencies 工作流依赖的 Agent 信息
@@ -27,8 +28,24 @@ type WorkflowDependencies struct {
 	WorkDir      string
 }
 
+// WorkflowTemplates 工作流各角色使用的模板 ID
+type WorkflowTemplates struct {
+	Researcher string
+	Writer     string
+	Editor     string
+}
+
+// DefaultWorkflowTemplates 默认的工作流模板
+func DefaultWorkflowTemplates() WorkflowTemplates {
+	return WorkflowTemplates{
+		Researcher: "researcher",
+		Writer:     "writer",
+		Editor:     "editor",
+	}
+}
+
 // NewPoolManager 创建 Pool 管理器
-func NewPoolManager(deps *agent.Dependencies) (*PoolManager, error) {
+func NewPoolManager(deps *agent.Dependencies, approvals *ApprovalManager) (*PoolManager, error) {
 	pool := core.NewPool(&core.PoolOptions{
 		Dependencies: deps,
 		MaxAgents:    50, // 最多管理 50 个 Agent
@@ -38,11 +55,12 @@ func NewPoolManager(deps *agent.Dependencies) (*PoolManager, error) {
 		pool:         pool,
 		deps:         deps,
 		workflowDeps: make(map[string]*WorkflowDependencies),
+		approvals:    approvals,
 	}, nil
 }
 
 // CreateWorkflowAgents 为工作流创建三个专业 Agent
-func (pm *PoolManager) CreateWorkflowAgents(ctx context.Context, workflowID string, modelConfig *types.ModelConfig) (*WorkflowDependencies, error) {
+func (pm *PoolManager) CreateWorkflowAgents(ctx context.Context, workflowID string, modelConfig *types.ModelConfig, templates WorkflowTemplates) (*WorkflowDependencies, error) {
 	log.Printf("[PoolManager] CreateWorkflowAgents called for workflow: %s", workflowID)
 
 	pm.mu.Lock()
@@ -64,12 +82,12 @@ func (pm *PoolManager) CreateWorkflowAgents(ctx context.Context, workflowID stri
 
 	log.Printf("[PoolManager] Creating researcher agent: %s", researcherID)
 	log.Printf("[PoolManager] Researcher config: TemplateID=%s, Model=%s, Provider=%s",
-		"researcher", modelConfig.Model, modelConfig.Provider)
+		templates.Researcher, modelConfig.Model, modelConfig.Provider)
 
 	// 1. 创建研究员 Agent
 	researcherConfig := &types.AgentConfig{
 		AgentID:     researcherID,
-		TemplateID:  "researcher",
+		TemplateID:  templates.Researcher,
 		ModelConfig: modelConfig,
 		Sandbox: &types.SandboxConfig{
 			Kind:    types.SandboxKindLocal,
@@ -78,47 +96,50 @@ func (pm *PoolManager) CreateWorkflowAgents(ctx context.Context, workflowID stri
 	}
 
 	log.Printf("[PoolManager] Calling pm.pool.Create for researcher...")
-	_, err := pm.pool.Create(ctx, researcherConfig)
+	researcher, err := pm.pool.Create(ctx, researcherConfig)
 	if err != nil {
 		log.Printf("[PoolManager] ❌ Failed to create researcher agent: %v", err)
 		return nil, fmt.Errorf("create researcher: %w", err)
 	}
+	pm.approvals.Watch(researcher, researcherID, workflowID)
 	log.Printf("[PoolManager] ✅ Researcher Agent 创建成功: %s", researcherID)
 
 	log.Printf("[PoolManager] Creating writer agent: %s", writerID)
 	// 2. 创建作家 Agent
 	writerConfig := &types.AgentConfig{
 		AgentID:     writerID,
-		TemplateID:  "writer",
+		TemplateID:  templates.Writer,
 		ModelConfig: modelConfig,
 		Sandbox: &types.SandboxConfig{
 			Kind:    types.SandboxKindLocal,
 			WorkDir: workDir + "/writing",
 		},
 	}
-	_, err = pm.pool.Create(ctx, writerConfig)
+	writer, err := pm.pool.Create(ctx, writerConfig)
 	if err != nil {
 		log.Printf("[PoolManager] Failed to create writer agent: %v", err)
 		return nil, fmt.Errorf("create writer: %w", err)
 	}
+	pm.approvals.Watch(writer, writerID, workflowID)
 	log.Printf("[PoolManager] ✓ Writer Agent 创建成功: %s", writerID)
 
 	log.Printf("[PoolManager] Creating editor agent: %s", editorID)
 	// 3. 创建编辑 Agent
 	editorConfig := &types.AgentConfig{
 		AgentID:     editorID,
-		TemplateID:  "editor",
+		TemplateID:  templates.Editor,
 		ModelConfig: modelConfig,
 		Sandbox: &types.SandboxConfig{
 			Kind:    types.SandboxKindLocal,
 			WorkDir: workDir + "/editing",
 		},
 	}
-	_, err = pm.pool.Create(ctx, editorConfig)
+	editor, err := pm.pool.Create(ctx, editorConfig)
 	if err != nil {
 		log.Printf("[PoolManager] Failed to create editor agent: %v", err)
 		return nil, fmt.Errorf("create editor: %w", err)
 	}
+	pm.approvals.Watch(editor, editorID, workflowID)
 	log.Printf("[PoolManager] ✓ Editor Agent 创建成功: %s", editorID)
 
 	deps := &WorkflowDependencies{
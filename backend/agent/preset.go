@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+)
+
+var (
+	// presetPlaceholder 占位符 {{name}}，名称两侧允许空格
+	presetPlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	// presetParamName 参数名
+	presetParamName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// 内置占位符
+const (
+	presetTopicParam  = "topic"
+	presetLengthParam = "target_length"
+)
+
+// PresetLibrary 工作流预设库：渲染预设的主题和要求，记录使用次数和运行结果
+type PresetLibrary struct {
+	store *storage.PresetStore
+
+	mu   sync.Mutex
+	runs map[string]string // 工作流 ID -> 预设 ID
+}
+
+// PresetStart 渲染后的启动参数
+type PresetStart struct {
+	Topic        string
+	Requirements string
+	Model        string
+	GuideRefs    models.GuideRefs
+	Params       map[string]string // 最终使用的参数值（含默认值）
+}
+
+// NewPresetLibrary 创建工作流预设库，重启前运行中的记录标记为 interrupted
+func NewPresetLibrary(store *storage.PresetStore, orchestrator *WorkflowOrchestrator) *PresetLibrary {
+	l := &PresetLibrary{
+		store: store,
+		runs:  make(map[string]string),
+	}
+
+	now := time.Now()
+	for _, preset := range store.List() {
+		_, err := store.Modify(preset.ID, func(preset *models.WorkflowPreset) error {
+			for i := range preset.Runs {
+				if preset.Runs[i].Status == models.PresetRunRunning {
+					preset.Runs[i].Status = models.PresetRunInterrupted
+					preset.Runs[i].FinishedAt = &now
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("[PresetLibrary] Failed to recover preset %s: %v", preset.ID, err)
+		}
+	}
+
+	orchestrator.OnLifecycle(l.onLifecycle)
+	return l
+}
+
+// ValidatePreset 检查参数定义和模板中的占位符：参数名合法且不重复，占位符都已定义或为内置占位符
+func ValidatePreset(preset *models.WorkflowPreset) error {
+	if preset.TargetLength < 0 {
+		return fmt.Errorf("target_length must not be negative")
+	}
+
+	defined := map[string]bool{presetTopicParam: true, presetLengthParam: true}
+	for _, p := range preset.Parameters {
+		if !presetParamName.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if defined[p.Name] {
+			return fmt.Errorf("duplicate or reserved parameter name %q", p.Name)
+		}
+		defined[p.Name] = true
+	}
+
+	for _, m := range presetPlaceholder.FindAllStringSubmatch(preset.Topic, -1) {
+		if m[1] == presetTopicParam {
+			return fmt.Errorf("topic must not reference {{%s}}", presetTopicParam)
+		}
+		if !defined[m[1]] {
+			return fmt.Errorf("placeholder {{%s}} in topic is not a declared parameter", m[1])
+		}
+	}
+	for _, m := range presetPlaceholder.FindAllStringSubmatch(preset.Requirements, -1) {
+		if !defined[m[1]] {
+			return fmt.Errorf("placeholder {{%s}} in requirements is not a declared parameter", m[1])
+		}
+	}
+	return nil
+}
+
+// Render 用启动请求中的参数值渲染预设：topic、model 非空时覆盖预设的默认值，requirements 追加在渲染出的要求之后，
+// 术语表与风格指南中非空的字段覆盖预设的设置；参数未定义、必填参数缺失或最终主题为空时返回错误
+func (l *PresetLibrary) Render(preset *models.WorkflowPreset, req models.WorkflowStartRequest) (*PresetStart, error) {
+	values := make(map[string]string)
+	var missing []string
+	for _, p := range preset.Parameters {
+		value, ok := req.Params[p.Name]
+		if !ok || value == "" {
+			value = p.Default
+		}
+		if value == "" && p.Required {
+			missing = append(missing, p.Name)
+		}
+		values[p.Name] = value
+	}
+	for name := range req.Params {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("unknown parameter %q for preset %s", name, preset.Name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing required parameters: %s", strings.Join(missing, ", "))
+	}
+	start := &PresetStart{
+		Topic:     strings.TrimSpace(req.Topic),
+		Model:     req.Model,
+		GuideRefs: preset.GuideRefs,
+		Params:    make(map[string]string, len(values)),
+	}
+	for name, value := range values {
+		start.Params[name] = value
+	}
+	if preset.TargetLength > 0 {
+		values[presetLengthParam] = strconv.Itoa(preset.TargetLength)
+	}
+	if start.Topic == "" {
+		start.Topic = strings.TrimSpace(renderPlaceholders(preset.Topic, values))
+	}
+	if start.Topic == "" {
+		return nil, fmt.Errorf("topic is required: preset %s has no default topic", preset.Name)
+	}
+	values[presetTopicParam] = start.Topic
+
+	start.Requirements = renderPlaceholders(preset.Requirements, values)
+	if preset.TargetLength > 0 && !strings.Contains(preset.Requirements, presetLengthParam) {
+		start.Requirements = strings.TrimRight(start.Requirements, "\n") + fmt.Sprintf("\n目标长度：约 %d 字", preset.TargetLength)
+	}
+	if req.Requirements != "" {
+		start.Requirements = strings.TrimRight(start.Requirements, "\n") + "\n" + req.Requirements
+	}
+
+	if start.Model == "" {
+		start.Model = preset.Model
+	}
+	if req.GlossaryID != "" {
+		start.GuideRefs.GlossaryID = req.GlossaryID
+	}
+	if req.StyleGuideID != "" {
+		start.GuideRefs.StyleGuideID = req.StyleGuideID
+	}
+	return start, nil
+}
+
+// RecordStart 记录预设启动了一次工作流，更新使用次数
+func (l *PresetLibrary) RecordStart(presetID, workflowID string, start *PresetStart) error {
+	now := time.Now()
+	_, err := l.store.Modify(presetID, func(preset *models.WorkflowPreset) error {
+		preset.UsageCount++
+		preset.LastUsedAt = &now
+		preset.Runs = append([]models.PresetRun{{
+			WorkflowID: workflowID,
+			Topic:      start.Topic,
+			Params:     start.Params,
+			Model:      start.Model,
+			Status:     models.PresetRunRunning,
+			StartedAt:  now,
+		}}, preset.Runs...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.runs[workflowID] = presetID
+	l.mu.Unlock()
+	return nil
+}
+
+// RecordFailure 工作流未能启动时把运行记录标记为失败
+func (l *PresetLibrary) RecordFailure(workflowID string, err error) {
+	l.finish(WorkflowLifecycleEvent{WorkflowID: workflowID, Error: err.Error()}, models.PresetRunFailed)
+}
+
+// onLifecycle 工作流完成或失败时更新预设的运行记录
+func (l *PresetLibrary) onLifecycle(event WorkflowLifecycleEvent) {
+	switch event.Type {
+	case models.WebhookWorkflowCompleted:
+		l.finish(event, models.PresetRunComplete)
+	case models.WebhookWorkflowFailed:
+		l.finish(event, models.PresetRunFailed)
+	}
+}
+
+// finish 记录运行结果（终稿字数取自完成事件中的产物）
+func (l *PresetLibrary) finish(event WorkflowLifecycleEvent, status string) {
+	l.mu.Lock()
+	presetID, ok := l.runs[event.WorkflowID]
+	delete(l.runs, event.WorkflowID)
+	l.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	_, err := l.store.Modify(presetID, func(preset *models.WorkflowPreset) error {
+		for i := range preset.Runs {
+			if preset.Runs[i].WorkflowID == event.WorkflowID {
+				preset.Runs[i].Status = status
+				preset.Runs[i].Error = event.Error
+				preset.Runs[i].FinishedAt = &now
+				preset.Runs[i].FinalLength = utf8.RuneCountInString(event.Artifacts["final"])
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[PresetLibrary] Failed to record run of preset %s: %v", presetID, err)
+	}
+}
+
+// renderPlaceholders 替换文本中的 {{name}}，未提供值的占位符替换为空
+func renderPlaceholders(text string, values map[string]string) string {
+	return presetPlaceholder.ReplaceAllStringFunc(text, func(match string) string {
+		name := presetPlaceholder.FindStringSubmatch(match)[1]
+		return values[name]
+	})
+}
@@ -0,0 +1,577 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/google/uuid"
+	"github.com/wordflowlab/agentsdk/pkg/agent"
+	"github.com/wordflowlab/agentsdk/pkg/types"
+)
+
+const (
+	defaultQueueDepth = 10               // 每个会话最多排队的消息数，可通过环境变量 MESSAGE_QUEUE_DEPTH 覆盖
+	queueFinishedKeep = 10               // 每个会话保留的最近结束的消息数
+	stopTimeout       = 10 * time.Second // Stop 等待轮次结束的最长时间
+)
+
+var (
+	// ErrQueueFull 会话排队的消息已达上限
+	ErrQueueFull = errors.New("message queue is full")
+	// ErrQueueItemNotFound 队列中没有该消息（不存在或已结束）
+	ErrQueueItemNotFound = errors.New("queued message not found")
+	// ErrNoRunningTurn 会话没有进行中的轮次
+	ErrNoRunningTurn = errors.New("no turn in progress")
+)
+
+// MessageQueue 会话消息队列
+// 同一会话的消息按先进先出的顺序逐条交给 Agent 处理，避免并发发送时在 Agent 内部竞争；
+// 不同会话之间互不影响。状态变化通过 Listen 注册的函数通知（WebSocket 推送排队位置）
+type MessageQueue struct {
+	manager      *Manager
+	sessionStore storage.SessionRepository
+	history      *storage.HistoryStore
+	maxDepth     int
+
+	mu           sync.Mutex
+	queues       map[string]*sessionQueue
+	listeners    map[int]func(models.MessageQueueState)
+	nextListener int
+}
+
+// sessionQueue 单个会话的队列
+type sessionQueue struct {
+	running  *queueItem
+	queued   []*queueItem
+	finished []models.QueuedMessage
+	working  bool            // 处理协程是否在运行
+	partial  strings.Builder // Agent 正在生成、尚未保存的回复
+	usage    models.TokenUsage
+	reason   string // 当前轮次 Agent 报告的结束原因
+}
+
+// queueItem 队列中的消息
+type queueItem struct {
+	models.QueuedMessage
+	cancel context.CancelFunc // 处理中时取消本轮
+	stop   bool               // 取消后保留已生成的部分回复（用户停止），否则直接丢弃（分支操作会改写历史）
+	done   chan struct{}      // 结束后关闭
+
+	wait      bool                    // 有调用方同步等待结果，结束时收集本轮消息
+	onDelta   func(string)            // 处理中时接收 Agent 生成的文本片段（wait 时可选）
+	agentID   string                  // 处理本轮的 Agent
+	turnStart int                     // 本轮开始前的历史消息条数
+	turn      []models.HistoryMessage // 本轮写入历史的消息（wait 时）
+}
+
+// NewMessageQueue 创建会话消息队列，并监听会话 Agent 正在生成的回复
+func NewMessageQueue(manager *Manager, sessionStore storage.SessionRepository, history *storage.HistoryStore) (*MessageQueue, error) {
+	q := &MessageQueue{
+		manager:      manager,
+		sessionStore: sessionStore,
+		history:      history,
+		maxDepth:     defaultQueueDepth,
+		queues:       make(map[string]*sessionQueue),
+		listeners:    make(map[int]func(models.MessageQueueState)),
+	}
+	if v := os.Getenv("MESSAGE_QUEUE_DEPTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid MESSAGE_QUEUE_DEPTH: %q", v)
+		}
+		q.maxDepth = n
+	}
+	manager.OnSessionAgentCreated(q.watch)
+	return q, nil
+}
+
+// watch 记录会话 Agent 正在生成的文本，停止时作为部分回复保存；同时累计本轮的 Token 用量和结束原因
+// 工具调用开始或一轮结束时，之前的文本已由 Agent 保存，清空记录
+func (q *MessageQueue) watch(ag *agent.Agent, sessionID string) {
+	eventCh := ag.Subscribe([]types.AgentChannel{types.ChannelProgress, types.ChannelMonitor}, nil)
+	go func() {
+		for envelope := range eventCh {
+			var onDelta func(string)
+			q.mu.Lock()
+			if sq := q.queues[sessionID]; sq != nil {
+				switch e := envelope.Event.(type) {
+				case *types.ProgressTextChunkEvent:
+					sq.partial.WriteString(e.Delta)
+					if sq.running != nil && sq.running.onDelta != nil {
+						onDelta = sq.running.onDelta
+					}
+				case *types.ProgressToolStartEvent:
+					sq.partial.Reset()
+				case *types.ProgressDoneEvent:
+					sq.partial.Reset()
+					sq.reason = e.Reason
+				case *types.MonitorTokenUsageEvent:
+					sq.usage.InputTokens += e.InputTokens
+					sq.usage.OutputTokens += e.OutputTokens
+					sq.usage.TotalTokens += e.TotalTokens
+				}
+			}
+			q.mu.Unlock()
+
+			if onDelta != nil {
+				onDelta(envelope.Event.(*types.ProgressTextChunkEvent).Delta)
+			}
+		}
+	}()
+}
+
+// Listen 注册监听函数，队列中任一消息状态变化后调用；返回取消注册的函数
+func (q *MessageQueue) Listen(fn func(models.MessageQueueState)) func() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	id := q.nextListener
+	q.nextListener++
+	q.listeners[id] = fn
+
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		delete(q.listeners, id)
+	}
+}
+
+// Enqueue 将消息加入会话队列，返回排队中的消息；排队数已达上限时返回 ErrQueueFull
+func (q *MessageQueue) Enqueue(sessionID, message string) (*models.QueuedMessage, error) {
+	_, result, err := q.enqueue(sessionID, message, false, nil)
+	return result, err
+}
+
+// Send 将消息加入会话队列并等待本轮结束，返回最终的助手消息、工具调用、Token 用量和结束原因
+// onDelta 不为空时，本轮处理中 Agent 生成的文本片段依次传给它（流式输出）；
+// ctx 结束（超时或调用方断开）时返回当时的状态和 ctx 的错误，本轮继续在后台处理
+func (q *MessageQueue) Send(ctx context.Context, sessionID, message string, onDelta func(string)) (*models.ChatResponse, error) {
+	item, _, err := q.enqueue(sessionID, message, true, onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-item.done:
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		item.onDelta = nil
+		return &models.ChatResponse{
+			SessionID: sessionID,
+			ItemID:    item.ID,
+			Status:    item.Status,
+			Messages:  []models.HistoryMessage{},
+			ToolCalls: []models.ChatToolCall{},
+		}, fmt.Errorf("wait for reply: %w", ctx.Err())
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return chatResponse(item), nil
+}
+
+// enqueue 将消息加入会话队列，wait 表示调用方会等待本轮结果
+func (q *MessageQueue) enqueue(sessionID, message string, wait bool, onDelta func(string)) (*queueItem, *models.QueuedMessage, error) {
+	q.mu.Lock()
+	sq := q.queues[sessionID]
+	if sq == nil {
+		sq = &sessionQueue{}
+		q.queues[sessionID] = sq
+	}
+	if len(sq.queued) >= q.maxDepth {
+		q.mu.Unlock()
+		return nil, nil, fmt.Errorf("%w: %d messages waiting", ErrQueueFull, len(sq.queued))
+	}
+
+	item := &queueItem{QueuedMessage: models.QueuedMessage{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Message:   message,
+		Status:    models.QueueStatusQueued,
+		CreatedAt: time.Now(),
+	}, done: make(chan struct{}), wait: wait, onDelta: onDelta}
+	sq.queued = append(sq.queued, item)
+	start := !sq.working
+	sq.working = true
+	state := q.stateLocked(sessionID, item)
+	result := *state.Changed
+	q.mu.Unlock()
+
+	q.notify(state)
+	if start {
+		go q.work(sessionID, sq)
+	}
+	return item, &result, nil
+}
+
+// State 获取会话队列的状态
+func (q *MessageQueue) State(sessionID string) models.MessageQueueState {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.stateLocked(sessionID, nil)
+}
+
+// Busy 会话是否有处理中或排队中的消息
+func (q *MessageQueue) Busy(sessionID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	sq := q.queues[sessionID]
+	return sq != nil && (sq.running != nil || len(sq.queued) > 0)
+}
+
+// Cancel 取消会话队列中的消息：排队中的直接移出队列，处理中的停止本轮（同 Stop）
+func (q *MessageQueue) Cancel(sessionID, itemID string) (*models.QueuedMessage, error) {
+	q.mu.Lock()
+	sq := q.queues[sessionID]
+	if sq == nil {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrQueueItemNotFound, itemID)
+	}
+
+	if sq.running != nil && sq.running.ID == itemID {
+		q.mu.Unlock()
+		return q.Stop(sessionID)
+	}
+
+	for i, item := range sq.queued {
+		if item.ID != itemID {
+			continue
+		}
+		sq.queued = append(sq.queued[:i], sq.queued[i+1:]...)
+		item.Status = models.QueueStatusCancelled
+		sq.finish(item)
+		state := q.stateLocked(sessionID, item)
+		result := *state.Changed
+		q.mu.Unlock()
+
+		q.notify(state)
+		return &result, nil
+	}
+
+	q.mu.Unlock()
+	return nil, fmt.Errorf("%w: %s", ErrQueueItemNotFound, itemID)
+}
+
+// Stop 停止会话当前的轮次并等待其结束：已生成的部分回复保存为标记了 stopped 的助手消息，
+// Agent 随后重建，可以继续发送消息；排队中的消息继续处理。返回结束后的消息
+func (q *MessageQueue) Stop(sessionID string) (*models.QueuedMessage, error) {
+	q.mu.Lock()
+	sq := q.queues[sessionID]
+	if sq == nil || sq.running == nil {
+		q.mu.Unlock()
+		return nil, ErrNoRunningTurn
+	}
+	item := sq.running
+	item.stop = true
+	item.cancel()
+	q.mu.Unlock()
+
+	select {
+	case <-item.done:
+	case <-time.After(stopTimeout):
+		return nil, fmt.Errorf("turn did not stop within %s", stopTimeout)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	result := item.QueuedMessage
+	return &result, nil
+}
+
+// Clear 取消会话全部排队中的消息并中止当前轮次，不保留部分回复（编辑消息、切换分支前调用）
+func (q *MessageQueue) Clear(sessionID string) {
+	q.mu.Lock()
+	sq := q.queues[sessionID]
+	if sq == nil {
+		q.mu.Unlock()
+		return
+	}
+
+	if sq.running != nil {
+		sq.running.cancel()
+	}
+	var states []models.MessageQueueState
+	for len(sq.queued) > 0 {
+		item := sq.queued[0]
+		sq.queued = sq.queued[1:]
+		item.Status = models.QueueStatusCancelled
+		sq.finish(item)
+		states = append(states, q.stateLocked(sessionID, item))
+	}
+	q.mu.Unlock()
+
+	for _, state := range states {
+		q.notify(state)
+	}
+}
+
+// Forget 删除会话的队列状态（会话删除后调用，应先 Clear）；仍在结束中的轮次不再记录到任何会话
+func (q *MessageQueue) Forget(sessionID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.queues, sessionID)
+}
+
+// work 逐条处理会话队列中的消息，队列为空时退出
+// 使用启动时的队列而不是每次从 map 中查找，会话被 Forget 后仍能安全地结束当前轮次
+func (q *MessageQueue) work(sessionID string, sq *sessionQueue) {
+	for {
+		q.mu.Lock()
+		if len(sq.queued) == 0 {
+			sq.working = false
+			q.mu.Unlock()
+			return
+		}
+
+		item := sq.queued[0]
+		sq.queued = sq.queued[1:]
+		ctx, cancel := context.WithCancel(context.Background())
+		now := time.Now()
+		item.cancel = cancel
+		item.Status = models.QueueStatusRunning
+		item.StartedAt = &now
+		sq.running = item
+		sq.partial.Reset()
+		sq.usage = models.TokenUsage{}
+		sq.reason = ""
+		state := q.stateLocked(sessionID, item)
+		q.mu.Unlock()
+		q.notify(state)
+
+		err := q.run(ctx, item)
+
+		q.mu.Lock()
+		stop := item.stop && ctx.Err() != nil
+		partial := sq.partial.String()
+		sq.partial.Reset()
+		q.mu.Unlock()
+
+		var stopped *models.HistoryMessage
+		if stop {
+			stopped, err = q.keepPartial(item, partial)
+		}
+		var turn []models.HistoryMessage
+		if item.wait && item.agentID != "" {
+			if messages, syncErr := q.history.Sync(item.agentID); syncErr == nil && item.turnStart <= len(messages) {
+				turn = messages[item.turnStart:]
+			}
+		}
+
+		q.mu.Lock()
+		switch {
+		case stop && err != nil:
+			item.Status = models.QueueStatusFailed
+			item.Error = "stop: " + err.Error()
+			log.Printf("[MessageQueue] Session %s failed to keep the stopped reply: %v", sessionID, err)
+		case stop:
+			item.Status = models.QueueStatusStopped
+			item.Reply = stopped
+		case ctx.Err() != nil:
+			item.Status = models.QueueStatusCancelled
+		case err != nil:
+			item.Status = models.QueueStatusFailed
+			item.Error = err.Error()
+			log.Printf("[MessageQueue] Session %s message %s failed: %v", sessionID, item.ID, err)
+		default:
+			item.Status = models.QueueStatusDone
+		}
+		item.turn = turn
+		item.StopReason = turnStopReason(item.Status, sq.reason)
+		if sq.usage != (models.TokenUsage{}) {
+			usage := sq.usage
+			item.Usage = &usage
+		}
+		cancel()
+		sq.running = nil
+		sq.finish(item)
+		state = q.stateLocked(sessionID, item)
+		q.mu.Unlock()
+		close(item.done)
+		q.notify(state)
+	}
+}
+
+// run 将消息交给会话 Agent 处理，回复内容通过 Agent 事件订阅推送
+func (q *MessageQueue) run(ctx context.Context, item *queueItem) error {
+	session, err := q.sessionStore.Get(item.SessionID)
+	if err != nil {
+		return err
+	}
+	// 已被 Clear 取消（例如会话正在删除）时不再重建 Agent
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ag, err := q.manager.GetOrCreateSessionAgent(ctx, session)
+	if err != nil {
+		return err
+	}
+	if item.wait {
+		messages, err := q.history.Sync(session.AgentID)
+		if err != nil {
+			return err
+		}
+		item.agentID = session.AgentID
+		item.turnStart = len(messages)
+	}
+
+	_, chatErr := ag.Chat(ctx, item.Message)
+
+	// 更新会话时间（重新读取，避免覆盖处理期间的其他修改）
+	if session, err := q.sessionStore.Get(item.SessionID); err == nil {
+		session.UpdatedAt = time.Now()
+		q.sessionStore.Update(session)
+	}
+	return chatErr
+}
+
+// turnStopReason 轮次的结束原因：正常完成时为 Agent 报告的原因，其他情况为结束状态
+func turnStopReason(status, reason string) string {
+	switch status {
+	case models.QueueStatusDone:
+		if reason == "" {
+			return "completed"
+		}
+		return reason
+	case models.QueueStatusStopped:
+		return "stopped"
+	case models.QueueStatusCancelled:
+		return "cancelled"
+	default:
+		return "error"
+	}
+}
+
+// chatResponse 根据结束的消息生成同步聊天响应（调用方需持有锁）
+func chatResponse(item *queueItem) *models.ChatResponse {
+	resp := &models.ChatResponse{
+		SessionID:  item.SessionID,
+		ItemID:     item.ID,
+		Status:     item.Status,
+		Messages:   append([]models.HistoryMessage{}, item.turn...),
+		ToolCalls:  []models.ChatToolCall{},
+		Usage:      item.Usage,
+		StopReason: item.StopReason,
+		Error:      item.Error,
+	}
+
+	results := make(map[string]models.ContentBlock)
+	for _, msg := range item.turn {
+		for _, block := range msg.Blocks {
+			if block.Type == models.BlockToolResult {
+				results[block.ToolUseID] = block
+			}
+		}
+	}
+	for _, msg := range resp.Messages {
+		if msg.Role != "assistant" {
+			continue
+		}
+		message := msg
+		resp.Message = &message
+		for _, block := range msg.Blocks {
+			if block.Type != models.BlockToolUse {
+				continue
+			}
+			result := results[block.ID]
+			resp.ToolCalls = append(resp.ToolCalls, models.ChatToolCall{
+				ID:      block.ID,
+				Name:    block.Name,
+				Input:   block.Input,
+				Output:  result.Output,
+				IsError: result.IsError,
+			})
+		}
+	}
+	return resp
+}
+
+// keepPartial 关闭被停止的 Agent，将部分回复写入历史并重建 Agent（已连接的客户端会收到新的历史）
+func (q *MessageQueue) keepPartial(item *queueItem, partial string) (*models.HistoryMessage, error) {
+	session, err := q.sessionStore.Get(item.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.manager.RemoveAgent(session.AgentID); err != nil {
+		return nil, err
+	}
+
+	stopped, stopErr := q.history.Stop(session.AgentID, item.Message, partial)
+
+	// 无论是否保存成功都重建 Agent，保证可以继续对话
+	if _, err := q.manager.GetOrCreateSessionAgent(context.Background(), session); err != nil {
+		return nil, err
+	}
+	if stopErr != nil {
+		return nil, stopErr
+	}
+	log.Printf("[MessageQueue] Session %s stopped, kept %d characters of the reply", item.SessionID, len(partial))
+	return stopped, nil
+}
+
+// finish 记录结束的消息，只保留最近的若干条
+func (sq *sessionQueue) finish(item *queueItem) {
+	now := time.Now()
+	item.FinishedAt = &now
+	item.Position = 0
+	sq.finished = append([]models.QueuedMessage{item.QueuedMessage}, sq.finished...)
+	if len(sq.finished) > queueFinishedKeep {
+		sq.finished = sq.finished[:queueFinishedKeep]
+	}
+}
+
+// stateLocked 生成会话队列状态并更新排队位置，changed 为状态发生变化的消息（调用方需持有锁）
+func (q *MessageQueue) stateLocked(sessionID string, changed *queueItem) models.MessageQueueState {
+	state := models.MessageQueueState{
+		SessionID: sessionID,
+		Queued:    []models.QueuedMessage{},
+		Finished:  []models.QueuedMessage{},
+		MaxDepth:  q.maxDepth,
+	}
+
+	sq := q.queues[sessionID]
+	if sq == nil {
+		return state
+	}
+	if sq.running != nil {
+		sq.running.Position = 0
+		running := sq.running.QueuedMessage
+		state.Running = &running
+	}
+	for i, item := range sq.queued {
+		item.Position = i + 1
+		state.Queued = append(state.Queued, item.QueuedMessage)
+	}
+	state.Finished = append(state.Finished, sq.finished...)
+	if changed != nil {
+		message := changed.QueuedMessage
+		state.Changed = &message
+	}
+	return state
+}
+
+// notify 通知监听函数
+func (q *MessageQueue) notify(state models.MessageQueueState) {
+	q.mu.Lock()
+	listeners := make([]func(models.MessageQueueState), 0, len(q.listeners))
+	for _, fn := range q.listeners {
+		listeners = append(listeners, fn)
+	}
+	q.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(state)
+	}
+}
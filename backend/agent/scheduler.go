@@ -0,0 +1,372 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	schedulerTick  = 10 * time.Second // 检查到期运行的间隔
+	maxCatchUpRuns = 10               // catch_up=all 时最多补跑的次数（只补最近的几次）
+)
+
+// ErrScheduleBusy 定时工作流的上一次运行尚未结束
+var ErrScheduleBusy = errors.New("previous run is still running")
+
+// Scheduler 定时工作流调度器
+// 按 cron 表达式通过 WorkflowOrchestrator.StartWorkflow 启动工作流：同一计划同时只运行一个工作流，
+// 到期时上一次仍在运行则记录为 skipped；每次运行在计划时间后随机延迟 0~jitter_seconds 秒；
+// 服务停止期间错过的运行在启动时按 catch_up 策略处理
+type Scheduler struct {
+	store        *storage.ScheduleStore
+	orchestrator *WorkflowOrchestrator
+	manager      *Manager
+
+	mu      sync.Mutex
+	active  map[string]string      // 计划 ID -> 运行中的工作流 ID
+	runs    map[string]scheduleRef // 工作流 ID -> 所属的计划和运行记录
+	backlog map[string][]time.Time // 计划 ID -> 等待补跑的计划时间（catch_up=all）
+	stop    chan struct{}
+}
+
+// scheduleRef 工作流对应的计划运行
+type scheduleRef struct {
+	scheduleID string
+	runID      string
+}
+
+// NewScheduler 创建定时工作流调度器
+func NewScheduler(store *storage.ScheduleStore, orchestrator *WorkflowOrchestrator, manager *Manager) *Scheduler {
+	s := &Scheduler{
+		store:        store,
+		orchestrator: orchestrator,
+		manager:      manager,
+		active:       make(map[string]string),
+		runs:         make(map[string]scheduleRef),
+		backlog:      make(map[string][]time.Time),
+		stop:         make(chan struct{}),
+	}
+	orchestrator.OnLifecycle(s.onLifecycle)
+	return s
+}
+
+// Start 处理重启前未结束和错过的运行，然后开始按计划运行
+func (s *Scheduler) Start() {
+	now := time.Now()
+	for _, schedule := range s.store.List() {
+		s.recover(schedule, now)
+	}
+
+	go func() {
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.tick(time.Now())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	log.Printf("[Scheduler] Started with %d schedule(s)", len(s.store.List()))
+}
+
+// Stop 停止调度（运行中的工作流不受影响）
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+// RunNow 立即运行一次（不影响下一次计划时间），上一次运行尚未结束时返回 ErrScheduleBusy
+func (s *Scheduler) RunNow(scheduleID string) (*models.ScheduleRun, error) {
+	if _, err := s.store.Get(scheduleID); err != nil {
+		return nil, err
+	}
+	return s.fire(scheduleID, time.Now(), false, true)
+}
+
+// Forget 删除计划时清理等待补跑的运行（运行中的工作流继续执行）
+func (s *Scheduler) Forget(scheduleID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.backlog, scheduleID)
+}
+
+// PlanSchedule 校验 cron 表达式和时区，并计算 after 之后的下一次运行时间；计划停用时清空
+func PlanSchedule(schedule *models.WorkflowSchedule, after time.Time) error {
+	cron, loc, err := parseSchedule(schedule)
+	if err != nil {
+		return err
+	}
+	if !schedule.Enabled {
+		schedule.NextRunAt = nil
+		schedule.NextStartAt = nil
+		return nil
+	}
+
+	next := cron.Next(after.In(loc))
+	if next.IsZero() {
+		return fmt.Errorf("cron expression %q never fires", schedule.Cron)
+	}
+	start := next
+	if schedule.JitterSeconds > 0 {
+		start = next.Add(time.Duration(rand.Intn(schedule.JitterSeconds+1)) * time.Second)
+	}
+	schedule.NextRunAt = &next
+	schedule.NextStartAt = &start
+	return nil
+}
+
+// parseSchedule 解析计划的 cron 表达式和时区
+func parseSchedule(schedule *models.WorkflowSchedule) (*CronSchedule, *time.Location, error) {
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron: %w", err)
+	}
+	loc := time.Local
+	if schedule.Timezone != "" {
+		if loc, err = time.LoadLocation(schedule.Timezone); err != nil {
+			return nil, nil, fmt.Errorf("invalid timezone: %q", schedule.Timezone)
+		}
+	}
+	return cron, loc, nil
+}
+
+// recover 启动时处理一个计划：重启前运行中的记录标记为 interrupted，错过的运行按补跑策略处理
+func (s *Scheduler) recover(schedule *models.WorkflowSchedule, now time.Time) {
+	var missed []time.Time // 最近错过的若干次（按时间顺序）
+	var total int          // 错过的总次数
+	updated, err := s.store.Modify(schedule.ID, func(schedule *models.WorkflowSchedule) error {
+		for i := range schedule.Runs {
+			if schedule.Runs[i].Status == models.ScheduleRunRunning {
+				schedule.Runs[i].Status = models.ScheduleRunInterrupted
+				schedule.Runs[i].Reason = "server restarted while the workflow was running"
+				schedule.Runs[i].FinishedAt = &now
+			}
+		}
+
+		if schedule.Enabled && schedule.NextStartAt != nil && schedule.NextStartAt.Before(now) {
+			missed, total = missedRuns(schedule, now, maxCatchUpRuns)
+			if len(missed) > 0 && schedule.CatchUp != models.CatchUpOnce && schedule.CatchUp != models.CatchUpAll {
+				schedule.Runs = append([]models.ScheduleRun{{
+					ID:          uuid.New().String(),
+					ScheduledAt: missed[len(missed)-1],
+					Status:      models.ScheduleRunSkipped,
+					Reason:      fmt.Sprintf("missed %d run(s) while the server was down", total),
+					CatchUp:     true,
+				}}, schedule.Runs...)
+			}
+		}
+		if schedule.Enabled && (schedule.NextStartAt == nil || !schedule.NextStartAt.After(now)) {
+			return PlanSchedule(schedule, now)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[Scheduler] Failed to recover schedule %s: %v", schedule.ID, err)
+		return
+	}
+	if len(missed) == 0 {
+		return
+	}
+
+	switch updated.CatchUp {
+	case models.CatchUpOnce:
+		log.Printf("[Scheduler] Schedule %s missed %d run(s), catching up once", updated.ID, total)
+		s.fire(updated.ID, missed[len(missed)-1], true, false)
+	case models.CatchUpAll:
+		log.Printf("[Scheduler] Schedule %s missed %d run(s), catching up the last %d", updated.ID, total, len(missed))
+		s.mu.Lock()
+		s.backlog[updated.ID] = missed[1:]
+		s.mu.Unlock()
+		s.fire(updated.ID, missed[0], true, false)
+	default:
+		log.Printf("[Scheduler] Schedule %s missed %d run(s), skipped", updated.ID, total)
+	}
+}
+
+// missedRuns 从 NextRunAt 到 now 之间错过的计划时间：返回最近的至多 keep 次（按时间顺序）和错过的总次数
+func missedRuns(schedule *models.WorkflowSchedule, now time.Time, keep int) ([]time.Time, int) {
+	cron, loc, err := parseSchedule(schedule)
+	if err != nil || schedule.NextRunAt == nil {
+		return nil, 0
+	}
+	var recent []time.Time
+	total := 0
+	for t := schedule.NextRunAt.In(loc); !t.IsZero() && !t.After(now); t = cron.Next(t) {
+		total++
+		if len(recent) == keep {
+			recent = append(recent[:0], recent[1:]...)
+		}
+		recent = append(recent, t)
+	}
+	return recent, total
+}
+
+// tick 启动到期的计划，并计算下一次运行时间
+func (s *Scheduler) tick(now time.Time) {
+	for _, schedule := range s.store.List() {
+		if !schedule.Enabled || schedule.NextStartAt == nil || schedule.NextStartAt.After(now) {
+			continue
+		}
+
+		var scheduledAt time.Time
+		_, err := s.store.Modify(schedule.ID, func(schedule *models.WorkflowSchedule) error {
+			if schedule.NextStartAt == nil || schedule.NextStartAt.After(now) {
+				return errNotDue
+			}
+			scheduledAt = *schedule.NextRunAt
+			return PlanSchedule(schedule, now)
+		})
+		if err != nil {
+			if !errors.Is(err, errNotDue) {
+				log.Printf("[Scheduler] Failed to plan schedule %s: %v", schedule.ID, err)
+			}
+			continue
+		}
+
+		if _, err := s.fire(schedule.ID, scheduledAt, false, false); err != nil {
+			log.Printf("[Scheduler] Schedule %s run at %s not started: %v", schedule.ID, scheduledAt.Format(time.RFC3339), err)
+		}
+	}
+}
+
+// errNotDue 计划在修改前已被更新为未到期
+var errNotDue = errors.New("schedule is not due")
+
+// fire 为计划启动一次工作流；上一次运行尚未结束时记录一条 skipped 运行并返回 ErrScheduleBusy
+func (s *Scheduler) fire(scheduleID string, scheduledAt time.Time, catchUp, manual bool) (*models.ScheduleRun, error) {
+	run := models.ScheduleRun{
+		ID:          uuid.New().String(),
+		ScheduledAt: scheduledAt,
+		CatchUp:     catchUp,
+		Manual:      manual,
+	}
+
+	s.mu.Lock()
+	if workflowID, busy := s.active[scheduleID]; busy {
+		s.mu.Unlock()
+		if !manual {
+			run.Status = models.ScheduleRunSkipped
+			run.Reason = fmt.Sprintf("previous run is still running (workflow %s)", workflowID)
+			s.record(scheduleID, run)
+		}
+		return nil, fmt.Errorf("%w: workflow %s", ErrScheduleBusy, workflowID)
+	}
+	run.WorkflowID = uuid.New().String()
+	s.active[scheduleID] = run.WorkflowID
+	s.runs[run.WorkflowID] = scheduleRef{scheduleID: scheduleID, runID: run.ID}
+	s.mu.Unlock()
+
+	now := time.Now()
+	run.StartedAt = &now
+	run.Status = models.ScheduleRunRunning
+	schedule, err := s.store.Modify(scheduleID, func(schedule *models.WorkflowSchedule) error {
+		schedule.LastRunAt = &now
+		schedule.Runs = append([]models.ScheduleRun{run}, schedule.Runs...)
+		return nil
+	})
+	if err != nil {
+		s.release(scheduleID, run.WorkflowID)
+		return nil, err
+	}
+
+	guidance, err := s.manager.LoadGuidance(schedule.GuideRefs)
+	if err == nil {
+		log.Printf("[Scheduler] Schedule %s starting workflow %s (scheduled at %s)", scheduleID, run.WorkflowID, scheduledAt.Format(time.RFC3339))
+		err = s.orchestrator.StartWorkflow(context.Background(), run.WorkflowID, schedule.Topic, schedule.Requirements, WorkflowModelConfig(schedule.Model), guidance)
+	}
+	if err != nil {
+		s.finishRun(run.WorkflowID, models.ScheduleRunFailed, err.Error())
+		return nil, err
+	}
+	return &run, nil
+}
+
+// onLifecycle 工作流完成或失败时更新运行记录
+func (s *Scheduler) onLifecycle(event WorkflowLifecycleEvent) {
+	switch event.Type {
+	case models.WebhookWorkflowCompleted:
+		s.finishRun(event.WorkflowID, models.ScheduleRunComplete, "")
+	case models.WebhookWorkflowFailed:
+		s.finishRun(event.WorkflowID, models.ScheduleRunFailed, event.Error)
+	}
+}
+
+// finishRun 记录运行结果，释放计划并继续补跑
+func (s *Scheduler) finishRun(workflowID, status, reason string) {
+	s.mu.Lock()
+	ref, ok := s.runs[workflowID]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	_, err := s.store.Modify(ref.scheduleID, func(schedule *models.WorkflowSchedule) error {
+		for i := range schedule.Runs {
+			if schedule.Runs[i].ID == ref.runID {
+				schedule.Runs[i].Status = status
+				schedule.Runs[i].Reason = reason
+				schedule.Runs[i].FinishedAt = &now
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("[Scheduler] Failed to record run of schedule %s: %v", ref.scheduleID, err)
+	}
+	log.Printf("[Scheduler] Schedule %s workflow %s finished: %s", ref.scheduleID, workflowID, status)
+
+	s.release(ref.scheduleID, workflowID)
+	if next, ok := s.nextBacklog(ref.scheduleID); ok {
+		go s.fire(ref.scheduleID, next, true, false)
+	}
+}
+
+// release 清除计划的运行中标记
+func (s *Scheduler) release(scheduleID, workflowID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.runs, workflowID)
+	if s.active[scheduleID] == workflowID {
+		delete(s.active, scheduleID)
+	}
+}
+
+// nextBacklog 取出下一次等待补跑的计划时间
+func (s *Scheduler) nextBacklog(scheduleID string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backlog := s.backlog[scheduleID]
+	if len(backlog) == 0 {
+		delete(s.backlog, scheduleID)
+		return time.Time{}, false
+	}
+	s.backlog[scheduleID] = backlog[1:]
+	return backlog[0], true
+}
+
+// record 追加一条运行记录
+func (s *Scheduler) record(scheduleID string, run models.ScheduleRun) {
+	_, err := s.store.Modify(scheduleID, func(schedule *models.WorkflowSchedule) error {
+		schedule.Runs = append([]models.ScheduleRun{run}, schedule.Runs...)
+		return nil
+	})
+	if err != nil {
+		log.Printf("[Scheduler] Failed to record run of schedule %s: %v", scheduleID, err)
+	}
+}
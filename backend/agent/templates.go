@@ -1,10 +1,79 @@
 package agent
 
 import (
+	"os"
+
+	"github.com/coso/agentdemo/backend/models"
 	"github.com/wordflowlab/agentsdk/pkg/agent"
 	"github.com/wordflowlab/agentsdk/pkg/types"
 )
 
+// templateMeta 模板说明与适用场景
+type templateMeta struct {
+	Name        string
+	Description string
+	Suitability []string
+}
+
+// builtinTemplateMeta 内置模板的说明与适用场景
+var builtinTemplateMeta = map[string]templateMeta{
+	"simple-chat": {
+		Name:        "智能助手",
+		Description: "通用对话，支持 Slash Commands 与 Skills 自动激活，可读写文件",
+		Suitability: []string{models.SuitabilityChat},
+	},
+	"writing-assistant": {
+		Name:        "写作助手",
+		Description: "帮助用户创作、编辑和改进各类文本，可读写文件保存草稿",
+		Suitability: []string{models.SuitabilityChat},
+	},
+	"text-polisher": {
+		Name:        "文本润色",
+		Description: "修正语法、优化表达，保持原意与风格",
+		Suitability: []string{models.SuitabilityWritingTool},
+	},
+	"text-rewriter": {
+		Name:        "文本改写",
+		Description: "换一种表达方式重写文本，可指定目标风格",
+		Suitability: []string{models.SuitabilityWritingTool},
+	},
+	"text-expander": {
+		Name:        "文本扩写",
+		Description: "在保持原意的基础上补充细节、深化论述",
+		Suitability: []string{models.SuitabilityWritingTool},
+	},
+	"text-summarizer": {
+		Name:        "文本总结",
+		Description: "提取核心要点，生成原文 20-30% 长度的摘要",
+		Suitability: []string{models.SuitabilityWritingTool},
+	},
+	"text-translator": {
+		Name:        "文本翻译",
+		Description: "按请求指定的目标语言翻译，支持术语表，保留 Markdown 结构与代码块",
+		Suitability: []string{models.SuitabilityWritingTool},
+	},
+	"researcher": {
+		Name:        "研究员",
+		Description: "分析主题并生成结构化写作大纲（outline.md），可执行 bash 命令",
+		Suitability: []string{models.SuitabilityWorkflow},
+	},
+	"writer": {
+		Name:        "作家",
+		Description: "基于大纲撰写文章草稿（draft.md），可执行 bash 命令",
+		Suitability: []string{models.SuitabilityWorkflow},
+	},
+	"editor": {
+		Name:        "编辑",
+		Description: "审校润色草稿并生成终稿（final.md），可执行 bash 命令",
+		Suitability: []string{models.SuitabilityWorkflow},
+	},
+	"title-generator": {
+		Name:        "标题生成",
+		Description: "根据会话的第一轮对话生成简短标题（内部使用）",
+		Suitability: []string{},
+	},
+}
+
 // GetSimpleChatTemplate 简单对话模板（支持 Skills 和 Commands）
 func GetSimpleChatTemplate() *types.AgentTemplateDefinition {
 	return &types.AgentTemplateDefinition{
@@ -43,6 +112,8 @@ func RegisterAllTemplates(registry *agent.TemplateRegistry) {
 	registry.Register(GetRewriteTemplate())
 	registry.Register(GetExpandTemplate())
 	registry.Register(GetSummarizeTemplate())
+	registry.Register(GetTranslateTemplate())
+	registry.Register(GetTitleGeneratorTemplate())
 }
 
 // GetWritingAssistantTemplate 写作助手模板
@@ -156,8 +227,12 @@ func GetSummarizeTemplate() *types.AgentTemplateDefinition {
 }
 
 // GetTranslateTemplate 文本翻译模板
-func GetTranslateTemplate(targetLanguage string) *types.AgentTemplateDefinition {
-	prompt := `你是一位专业的翻译专家。你的任务是将用户提供的文本翻译成` + targetLanguage + `。
+// 目标语言、源语言和术语表随每次请求在消息中给出，因此模板只需注册一次
+func GetTranslateTemplate() *types.AgentTemplateDefinition {
+	return &types.AgentTemplateDefinition{
+		ID:    "text-translator",
+		Model: "", // 将从环境变量中读取
+		SystemPrompt: `你是一位专业的翻译专家。你的任务是按照用户消息中的翻译要求，将给出的文本翻译成指定的目标语言。
 
 翻译原则：
 1. **准确性**：忠实传达原文的意思和语气
@@ -166,15 +241,13 @@ func GetTranslateTemplate(targetLanguage string) *types.AgentTemplateDefinition
 4. **完整性**：不遗漏任何重要信息
 
 注意事项：
-- 保持原文的风格和语气
+- 严格使用消息中指定的目标语言，未指定源语言时自动识别
+- 如果提供了术语表，术语必须使用术语表中给定的译法
+- 保持 Markdown 结构不变（标题、列表、表格、链接、强调等标记原样保留，只翻译其中的文字）
+- 形如 [[CODE_0]] 的占位符代表代码，必须原样保留，不得翻译、修改或删除
 - 对于专有名词，保留原文或使用通用译法
-- 只返回翻译后的文本，不要添加解释说明`
-
-	return &types.AgentTemplateDefinition{
-		ID:           "text-translator",
-		Model:        "", // 将从环境变量中读取
-		SystemPrompt: prompt,
-		Tools:        []interface{}{},
+- 只返回翻译后的文本，不要添加解释说明`,
+		Tools: []interface{}{},
 	}
 }
 
@@ -250,3 +323,19 @@ func GetEditorTemplate() *types.AgentTemplateDefinition {
 		Tools: []interface{}{"fs_read", "fs_write", "bash_run"},
 	}
 }
+
+// GetTitleGeneratorTemplate 会话标题生成模板
+func GetTitleGeneratorTemplate() *types.AgentTemplateDefinition {
+	return &types.AgentTemplateDefinition{
+		ID:    "title-generator",
+		Model: os.Getenv("TITLE_MODEL"), // 可单独指定更便宜的模型，留空时使用 MODEL
+		SystemPrompt: `你负责为对话生成标题。根据用户提供的第一轮对话，概括对话主题。
+
+要求：
+- 使用与用户消息相同的语言
+- 中文不超过 15 个字，其他语言不超过 8 个单词
+- 不要使用引号、句号或 Markdown
+- 只返回标题本身，不要添加任何解释`,
+		Tools: []interface{}{},
+	}
+}
@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/wordflowlab/agentsdk/pkg/agent"
+	"github.com/wordflowlab/agentsdk/pkg/types"
+)
+
+const (
+	titleTimeout      = 30 * time.Second
+	titleInputLimit   = 500 // 每条消息送入标题生成的最大字符数
+	titleOutputLimit  = 30  // 标题最大字符数
+	titleTemplateName = "title-generator"
+)
+
+// TitleGenerator 会话标题生成器
+// 会话完成第一轮对话后，用标题模板生成简短标题；用户手动设置过标题的会话不会被覆盖
+type TitleGenerator struct {
+	manager      *Manager
+	sessionStore storage.SessionRepository
+
+	mu           sync.Mutex
+	running      map[string]bool // 正在生成标题的会话
+	listeners    map[int]func(*models.Session)
+	nextListener int
+}
+
+// NewTitleGenerator 创建标题生成器，并监听新创建的会话 Agent
+func NewTitleGenerator(manager *Manager, sessionStore storage.SessionRepository) *TitleGenerator {
+	g := &TitleGenerator{
+		manager:      manager,
+		sessionStore: sessionStore,
+		running:      make(map[string]bool),
+		listeners:    make(map[int]func(*models.Session)),
+	}
+	manager.OnSessionAgentCreated(g.watch)
+	return g
+}
+
+// Listen 注册监听函数，标题更新后调用；返回取消注册的函数
+func (g *TitleGenerator) Listen(fn func(*models.Session)) func() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := g.nextListener
+	g.nextListener++
+	g.listeners[id] = fn
+
+	return func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		delete(g.listeners, id)
+	}
+}
+
+// watch 监听会话 Agent，每轮对话结束后检查是否需要生成标题
+func (g *TitleGenerator) watch(ag *agent.Agent, sessionID string) {
+	eventCh := ag.Subscribe([]types.AgentChannel{types.ChannelProgress}, nil)
+	go func() {
+		for envelope := range eventCh {
+			if _, ok := envelope.Event.(*types.ProgressDoneEvent); ok {
+				go g.maybeGenerate(sessionID)
+			}
+		}
+	}()
+}
+
+// maybeGenerate 会话仍使用默认标题且已有一轮完整对话时生成标题
+func (g *TitleGenerator) maybeGenerate(sessionID string) {
+	session, err := g.sessionStore.Get(sessionID)
+	if err != nil || !needsTitle(session) {
+		return
+	}
+
+	g.mu.Lock()
+	if g.running[sessionID] {
+		g.mu.Unlock()
+		return
+	}
+	g.running[sessionID] = true
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.running, sessionID)
+		g.mu.Unlock()
+	}()
+
+	userMessage, reply := firstExchange(session.AgentID)
+	if userMessage == "" || reply == "" {
+		return
+	}
+
+	title, err := g.generate(userMessage, reply)
+	if err != nil {
+		log.Printf("[TitleGenerator] Failed to generate title for session %s: %v", sessionID, err)
+		return
+	}
+
+	// 生成期间用户可能已经修改了标题
+	session, err = g.sessionStore.Get(sessionID)
+	if err != nil || !needsTitle(session) {
+		return
+	}
+	session.Title = title
+	if err := g.sessionStore.Update(session); err != nil {
+		log.Printf("[TitleGenerator] Failed to save title for session %s: %v", sessionID, err)
+		return
+	}
+	log.Printf("[TitleGenerator] Session %s titled: %s", sessionID, title)
+
+	g.notify(session)
+}
+
+// generate 调用标题模板生成标题
+func (g *TitleGenerator) generate(userMessage, reply string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+	defer cancel()
+
+	ag, release, err := g.manager.CreateTemporaryAgent(ctx, titleTemplateName, "")
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	prompt := fmt.Sprintf("用户：%s\n\n助手：%s", truncateRunes(userMessage, titleInputLimit), truncateRunes(reply, titleInputLimit))
+	result, err := ag.Chat(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	title := cleanTitle(result.Text)
+	if title == "" {
+		return "", fmt.Errorf("empty title")
+	}
+	return title, nil
+}
+
+// notify 通知所有监听者
+func (g *TitleGenerator) notify(session *models.Session) {
+	g.mu.Lock()
+	listeners := make([]func(*models.Session), 0, len(g.listeners))
+	for _, fn := range g.listeners {
+		listeners = append(listeners, fn)
+	}
+	g.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(session)
+	}
+}
+
+// needsTitle 会话是否需要自动生成标题
+func needsTitle(session *models.Session) bool {
+	return !session.TitleEdited && session.Title == models.DefaultSessionTitle
+}
+
+// firstExchange 获取会话的第一条用户消息和第一条助手回复
+func firstExchange(agentID string) (string, string) {
+	messages, err := storage.LoadAgentMessages(agentID)
+	if err != nil {
+		return "", ""
+	}
+
+	var userMessage, reply string
+	for _, msg := range messages {
+		content := strings.TrimSpace(msg.Content)
+		if content == "" {
+			continue
+		}
+		switch {
+		case msg.Role == "user" && userMessage == "":
+			userMessage = content
+		case msg.Role == "assistant" && userMessage != "" && reply == "":
+			reply = content
+		}
+	}
+	return userMessage, reply
+}
+
+// cleanTitle 清理模型输出：取第一行，去掉引号和结尾标点，并限制长度
+func cleanTitle(text string) string {
+	title := strings.TrimSpace(text)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	title = strings.TrimSpace(strings.TrimLeft(title, "#"))
+	title = strings.Trim(title, "\"'“”‘’「」《》*`")
+	title = strings.TrimRight(title, "。.!！?？")
+	return truncateRunes(strings.TrimSpace(title), titleOutputLimit)
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit])
+}
@@ -0,0 +1,308 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/google/uuid"
+	"github.com/wordflowlab/agentsdk/pkg/agent"
+	"github.com/wordflowlab/agentsdk/pkg/types"
+)
+
+const (
+	defaultWebhookAttempts = 5                // 每次投递最多尝试的次数，可通过环境变量 WEBHOOK_MAX_ATTEMPTS 覆盖
+	webhookTimeout         = 10 * time.Second // 单次请求超时
+	webhookBackoff         = 5 * time.Second  // 第一次重试前的等待时间，之后每次翻倍
+	webhookMaxBackoff      = 10 * time.Minute
+	webhookResponseLimit   = 512 // 投递日志中记录的响应体长度
+)
+
+// ErrWebhookInactive Webhook 已停用
+var ErrWebhookInactive = errors.New("webhook is inactive")
+
+// WebhookDispatcher Webhook 投递器
+// 事件按订阅投递给每个 Webhook：请求体为 models.WebhookPayload，使用 HMAC-SHA256 签名，
+// 非 2xx 响应或请求失败时按指数退避重试，每次尝试都记录在投递日志中；重启时继续未完成的投递
+type WebhookDispatcher struct {
+	store       *storage.WebhookStore
+	client      *http.Client
+	maxAttempts int
+}
+
+// NewWebhookDispatcher 创建 Webhook 投递器，并继续上次退出时未完成的投递
+func NewWebhookDispatcher(store *storage.WebhookStore) (*WebhookDispatcher, error) {
+	d := &WebhookDispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: webhookTimeout},
+		maxAttempts: defaultWebhookAttempts,
+	}
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS: %q", v)
+		}
+		d.maxAttempts = n
+	}
+
+	for _, delivery := range store.Deliveries("", models.DeliveryPending, 0) {
+		log.Printf("[Webhook] Resuming delivery %s of %s to %s", delivery.ID, delivery.EventType, delivery.URL)
+		go d.run(delivery, d.maxAttempts)
+	}
+	return d, nil
+}
+
+// WatchWorkflows 投递工作流的启动、阶段完成、完成和失败事件
+func (d *WebhookDispatcher) WatchWorkflows(wo *WorkflowOrchestrator) {
+	wo.OnLifecycle(func(event WorkflowLifecycleEvent) {
+		d.Emit(event.Type, event)
+	})
+}
+
+// WatchSessions 会话 Agent 一轮对话结束（done 事件）时投递 session.message_completed，附带最后一条助手消息
+func (d *WebhookDispatcher) WatchSessions(manager *Manager, sessionStore storage.SessionRepository, history *storage.HistoryStore) {
+	manager.OnSessionAgentCreated(func(ag *agent.Agent, sessionID string) {
+		agentID := ag.ID()
+		eventCh := ag.Subscribe([]types.AgentChannel{types.ChannelProgress}, nil)
+		go func() {
+			for envelope := range eventCh {
+				done, ok := envelope.Event.(*types.ProgressDoneEvent)
+				if !ok || !d.subscribed(models.WebhookSessionMessageCompleted) {
+					continue
+				}
+
+				data := map[string]interface{}{
+					"session_id": sessionID,
+					"agent_id":   agentID,
+					"reason":     done.Reason,
+				}
+				if session, err := sessionStore.Get(sessionID); err == nil {
+					data["title"] = session.Title
+					data["agent_type"] = session.AgentType
+				}
+				if messages, err := history.Sync(agentID); err == nil {
+					for i := len(messages) - 1; i >= 0; i-- {
+						if messages[i].Role == "assistant" {
+							data["message"] = messages[i]
+							break
+						}
+					}
+				}
+				d.Emit(models.WebhookSessionMessageCompleted, data)
+			}
+		}()
+	})
+}
+
+// Emit 向订阅了该事件的所有启用中的 Webhook 投递事件（异步）
+func (d *WebhookDispatcher) Emit(eventType string, data interface{}) {
+	payload := models.WebhookPayload{
+		ID:        "evt_" + uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+	for _, webhook := range d.store.List() {
+		if webhook.Active && subscribes(webhook, eventType) {
+			d.start(webhook, payload, d.maxAttempts)
+		}
+	}
+}
+
+// Ping 向 Webhook 投递一次 ping 事件并等待结果（不重试），用于检查地址和签名校验
+func (d *WebhookDispatcher) Ping(webhookID string) (*models.WebhookDelivery, error) {
+	webhook, err := d.store.Get(webhookID)
+	if err != nil {
+		return nil, err
+	}
+	payload := models.WebhookPayload{
+		ID:        "evt_" + uuid.New().String(),
+		Type:      models.WebhookPing,
+		CreatedAt: time.Now(),
+		Data:      map[string]string{"webhook_id": webhook.ID},
+	}
+	delivery := d.newDelivery(webhook, payload)
+	d.run(delivery, 1)
+	return d.store.Delivery(delivery.ID)
+}
+
+// Redeliver 重新投递一条记录中的事件（新的投递记录，事件 ID 不变），返回新的投递记录
+func (d *WebhookDispatcher) Redeliver(deliveryID string) (*models.WebhookDelivery, error) {
+	previous, err := d.store.Delivery(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	webhook, err := d.store.Get(previous.WebhookID)
+	if err != nil {
+		return nil, err
+	}
+	if !webhook.Active {
+		return nil, fmt.Errorf("%w: %s", ErrWebhookInactive, webhook.ID)
+	}
+	return d.start(webhook, previous.Payload, d.maxAttempts), nil
+}
+
+// subscribed 是否有启用中的 Webhook 订阅了该事件
+func (d *WebhookDispatcher) subscribed(eventType string) bool {
+	for _, webhook := range d.store.List() {
+		if webhook.Active && subscribes(webhook, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// start 创建投递记录并在后台投递
+func (d *WebhookDispatcher) start(webhook *models.Webhook, payload models.WebhookPayload, maxAttempts int) *models.WebhookDelivery {
+	delivery := d.newDelivery(webhook, payload)
+	go d.run(delivery, maxAttempts)
+	result := *delivery
+	return &result
+}
+
+// newDelivery 创建并保存待投递的记录
+func (d *WebhookDispatcher) newDelivery(webhook *models.Webhook, payload models.WebhookPayload) *models.WebhookDelivery {
+	delivery := &models.WebhookDelivery{
+		ID:        uuid.New().String(),
+		WebhookID: webhook.ID,
+		EventID:   payload.ID,
+		EventType: payload.Type,
+		URL:       webhook.URL,
+		Status:    models.DeliveryPending,
+		Attempts:  []models.WebhookAttempt{},
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}
+	d.save(delivery)
+	return delivery
+}
+
+// run 投递直到成功或尝试次数用完，每次尝试后更新投递记录
+func (d *WebhookDispatcher) run(delivery *models.WebhookDelivery, maxAttempts int) {
+	for {
+		// 每次尝试使用最新的地址和密钥；Webhook 被删除或停用后不再重试
+		webhook, err := d.store.Get(delivery.WebhookID)
+		if err == nil && !webhook.Active {
+			err = fmt.Errorf("%w: %s", ErrWebhookInactive, webhook.ID)
+		}
+		if err != nil {
+			delivery.Attempts = append(delivery.Attempts, models.WebhookAttempt{Time: time.Now(), Error: err.Error()})
+			d.finish(delivery, models.DeliveryFailed)
+			return
+		}
+		delivery.URL = webhook.URL
+
+		attempt := d.attempt(webhook, delivery)
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		if attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode < 300 {
+			d.finish(delivery, models.DeliverySucceeded)
+			return
+		}
+		if len(delivery.Attempts) >= maxAttempts {
+			log.Printf("[Webhook] Delivery %s of %s to %s failed after %d attempts", delivery.ID, delivery.EventType, delivery.URL, len(delivery.Attempts))
+			d.finish(delivery, models.DeliveryFailed)
+			return
+		}
+
+		delay := webhookBackoff << (len(delivery.Attempts) - 1)
+		if delay > webhookMaxBackoff || delay <= 0 {
+			delay = webhookMaxBackoff
+		}
+		next := time.Now().Add(delay)
+		delivery.NextRetryAt = &next
+		d.save(delivery)
+		time.Sleep(delay)
+	}
+}
+
+// attempt 发送一次请求
+// 请求头：X-Webhook-Event 事件类型、X-Webhook-Delivery 投递 ID、X-Webhook-Timestamp Unix 秒、
+// X-Webhook-Signature "sha256=" + HMAC-SHA256(密钥, 时间戳 + "." + 请求体) 的十六进制
+func (d *WebhookDispatcher) attempt(webhook *models.Webhook, delivery *models.WebhookDelivery) models.WebhookAttempt {
+	start := time.Now()
+	attempt := models.WebhookAttempt{Time: start}
+
+	body, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "agentdemo-webhook/1")
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	attempt.Response = string(snippet)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = resp.Status
+	}
+	return attempt
+}
+
+// finish 记录投递的最终结果
+func (d *WebhookDispatcher) finish(delivery *models.WebhookDelivery, status string) {
+	now := time.Now()
+	delivery.Status = status
+	delivery.NextRetryAt = nil
+	delivery.FinishedAt = &now
+	d.save(delivery)
+}
+
+// save 保存投递记录，失败时只记录日志（不影响投递本身）
+func (d *WebhookDispatcher) save(delivery *models.WebhookDelivery) {
+	if err := d.store.SaveDelivery(delivery); err != nil {
+		log.Printf("[Webhook] Failed to save delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// SignWebhook 计算投递签名：HMAC-SHA256(secret, timestamp + "." + body) 的十六进制
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// subscribes Webhook 是否订阅了该事件（ping 总是投递）
+func subscribes(webhook *models.Webhook, eventType string) bool {
+	if eventType == models.WebhookPing {
+		return true
+	}
+	for _, e := range webhook.Events {
+		if e == "*" || e == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/coso/agentdemo/backend/models"
 	"github.com/wordflowlab/agentsdk/pkg/types"
 )
 
@@ -26,6 +27,9 @@ const (
 // WorkflowStatus 工作流状态
 type WorkflowStatus struct {
 	WorkflowID     string             `json:"workflow_id"`
+	Topic          string             `json:"topic"`
+	Requirements   string             `json:"requirements,omitempty"`
+	Model          string             `json:"model,omitempty"`
 	Stage          WorkflowStage      `json:"stage"`
 	Progress       int                `json:"progress"`
 	StartTime      time.Time          `json:"start_time"`
@@ -35,6 +39,14 @@ type WorkflowStatus struct {
 	EditorStatus   *types.AgentStatus `json:"editor_status,omitempty"`
 	Events         []WorkflowEvent    `json:"events"`
 	Error          string             `json:"error,omitempty"`
+
+	// 终稿中仍然出现的禁用词
+	GuideViolations []models.GuideViolation `json:"guide_violations,omitempty"`
+
+	// 等待用户审批的工具调用
+	PendingApprovals []models.ApprovalRequest `json:"pending_approvals,omitempty"`
+
+	guidance *Guidance
 }
 
 // WorkflowEvent 工作流事件
@@ -54,25 +66,129 @@ type ToolCallInfo struct {
 	State  string `json:"state"`
 }
 
+// WorkflowLifecycleEvent 工作流生命周期事件（启动、阶段完成、完成、失败），通过 OnLifecycle 注册的函数通知
+type WorkflowLifecycleEvent struct {
+	Type            string                  `json:"-"` // models.WebhookWorkflow*
+	WorkflowID      string                  `json:"workflow_id"`
+	Topic           string                  `json:"topic"`
+	Requirements    string                  `json:"requirements,omitempty"`
+	Model           string                  `json:"model,omitempty"`
+	Stage           WorkflowStage           `json:"stage"`
+	CompletedStage  WorkflowStage           `json:"completed_stage,omitempty"` // 阶段完成事件中完成的阶段
+	Progress        int                     `json:"progress"`
+	StartTime       time.Time               `json:"start_time"`
+	EndTime         *time.Time              `json:"end_time,omitempty"`
+	Error           string                  `json:"error,omitempty"`
+	Artifacts       map[string]string       `json:"artifacts,omitempty"` // 完成事件中的大纲、初稿和终稿
+	GuideViolations []models.GuideViolation `json:"guide_violations,omitempty"`
+}
+
 // WorkflowOrchestrator 工作流编排器
 type WorkflowOrchestrator struct {
 	poolManager *PoolManager
+	templates   *TemplateCatalog
+	approvals   *ApprovalManager
 	workflows   map[string]*WorkflowStatus
 	mu          sync.RWMutex
+
+	lifecycleHooks []func(WorkflowLifecycleEvent)
 }
 
 // NewWorkflowOrchestrator 创建工作流编排器
-func NewWorkflowOrchestrator(poolManager *PoolManager) *WorkflowOrchestrator {
-	return &WorkflowOrchestrator{
+func NewWorkflowOrchestrator(poolManager *PoolManager, templates *TemplateCatalog, approvals *ApprovalManager) *WorkflowOrchestrator {
+	wo := &WorkflowOrchestrator{
 		poolManager: poolManager,
+		templates:   templates,
+		approvals:   approvals,
 		workflows:   make(map[string]*WorkflowStatus),
 	}
+	approvals.Listen(wo.onApproval)
+	return wo
+}
+
+// OnLifecycle 注册工作流生命周期事件的处理函数（在事件所在的工作流协程中调用）
+func (wo *WorkflowOrchestrator) OnLifecycle(fn func(WorkflowLifecycleEvent)) {
+	wo.mu.Lock()
+	defer wo.mu.Unlock()
+
+	wo.lifecycleHooks = append(wo.lifecycleHooks, fn)
+}
+
+// WorkflowModelConfig 工作流 Agent 的模型配置，model 为空时使用 MODEL 环境变量或 Provider 的默认模型
+func WorkflowModelConfig(model string) *types.ModelConfig {
+	providerType := os.Getenv("PROVIDER")
+	if providerType == "" {
+		providerType = "anthropic" // 默认使用 anthropic
+	}
+
+	// 根据 Provider 类型优先选择对应的 API Key
+	var apiKey string
+	switch providerType {
+	case "anthropic":
+		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+	case "glm", "zhipu", "bigmodel":
+		apiKey = os.Getenv("GLM_API_KEY")
+	case "deepseek":
+		apiKey = os.Getenv("DEEPSEEK_API_KEY")
+	default:
+		// 默认尝试所有 API Key
+		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			apiKey = os.Getenv("GLM_API_KEY")
+		}
+		if apiKey == "" {
+			apiKey = os.Getenv("DEEPSEEK_API_KEY")
+		}
+	}
+	if apiKey == "" {
+		apiKey = "sk-default"
+	}
+
+	if model == "" {
+		model = os.Getenv("MODEL")
+	}
+	if model == "" {
+		if providerType == "glm" {
+			model = "glm-4" // GLM 默认模型
+		} else if providerType == "deepseek" {
+			model = "deepseek-chat" // Deepseek 默认模型
+		} else {
+			model = "claude-3-haiku-20240307" // Anthropic 默认模型
+		}
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		if providerType == "anthropic" {
+			baseURL = "http://yunwu.ai" // Anthropic 使用 yunwu.ai 中转
+		} else if providerType == "glm" {
+			baseURL = "https://open.bigmodel.cn/api/paas/v4" // GLM 默认地址
+		} else if providerType == "deepseek" {
+			baseURL = "https://api.deepseek.com" // Deepseek 默认地址
+		}
+	}
+
+	return &types.ModelConfig{
+		Provider: providerType,
+		Model:    model,
+		APIKey:   apiKey,
+		BaseURL:  baseURL,
+	}
 }
 
 // StartWorkflow 启动工作流
-func (wo *WorkflowOrchestrator) StartWorkflow(ctx context.Context, workflowID, topic, requirements string, modelConfig *types.ModelConfig) error {
+// guidance 不为空时，术语表与风格指南会注入作家和编辑的模板，并在终稿生成后检查禁用词
+func (wo *WorkflowOrchestrator) StartWorkflow(ctx context.Context, workflowID, topic, requirements string, modelConfig *types.ModelConfig, guidance *Guidance) error {
 	log.Printf("[WorkflowOrchestrator] StartWorkflow called - ID: %s, Topic: %s", workflowID, topic)
 
+	// 启动阶段的失败同样发出 workflow.failed 事件（在释放锁之后）
+	var setupErr error
+	defer func() {
+		if setupErr != nil {
+			wo.notifyLifecycle(models.WebhookWorkflowFailed, workflowID, "")
+		}
+	}()
+
 	wo.mu.Lock()
 	defer wo.mu.Unlock()
 
@@ -84,11 +200,15 @@ func (wo *WorkflowOrchestrator) StartWorkflow(ctx context.Context, workflowID, t
 
 	// 创建工作流状态
 	status := &WorkflowStatus{
-		WorkflowID: workflowID,
-		Stage:      StageResearch,
-		Progress:   0,
-		StartTime:  time.Now(),
-		Events:     []WorkflowEvent{},
+		WorkflowID:   workflowID,
+		Topic:        topic,
+		Requirements: requirements,
+		Model:        modelConfig.Model,
+		Stage:        StageResearch,
+		Progress:     0,
+		StartTime:    time.Now(),
+		Events:       []WorkflowEvent{},
+		guidance:     guidance,
 	}
 	wo.workflows[workflowID] = status
 	log.Printf("[WorkflowOrchestrator] Workflow status created: %s", workflowID)
@@ -103,6 +223,20 @@ func (wo *WorkflowOrchestrator) StartWorkflow(ctx context.Context, workflowID, t
 	status.Events = append(status.Events, event)
 	log.Printf("[WorkflowOrchestrator] Workflow start event added")
 
+	// 作家和编辑使用注入规范后的模板
+	templates := DefaultWorkflowTemplates()
+	var err error
+	if templates.Writer, err = wo.templates.WithGuidance(templates.Writer, guidance); err != nil {
+		setupErr = err
+		markFailed(status, "setup", err)
+		return err
+	}
+	if templates.Editor, err = wo.templates.WithGuidance(templates.Editor, guidance); err != nil {
+		setupErr = err
+		markFailed(status, "setup", err)
+		return err
+	}
+
 	// 创建三个 Agent
 	log.Printf("[WorkflowOrchestrator] Creating workflow agents...")
 	log.Printf("[WorkflowOrchestrator] ModelConfig: Provider=%s, Model=%s, BaseURL=%s",
@@ -112,11 +246,11 @@ func (wo *WorkflowOrchestrator) StartWorkflow(ctx context.Context, workflowID, t
 	createCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	deps, err := wo.poolManager.CreateWorkflowAgents(createCtx, workflowID, modelConfig)
+	deps, err := wo.poolManager.CreateWorkflowAgents(createCtx, workflowID, modelConfig, templates)
 	if err != nil {
 		log.Printf("[WorkflowOrchestrator] ❌ Failed to create agents: %v", err)
-		status.Stage = StageFailed
-		status.Error = err.Error()
+		setupErr = err
+		markFailed(status, "setup", err)
 		return err
 	}
 	log.Printf("[WorkflowOrchestrator] ✅ Agents created - Researcher: %s, Writer: %s, Editor: %s",
@@ -127,8 +261,8 @@ func (wo *WorkflowOrchestrator) StartWorkflow(ctx context.Context, workflowID, t
 	err = wo.ensureWorkspaceDirs(deps.WorkDir)
 	if err != nil {
 		log.Printf("[WorkflowOrchestrator] Failed to create workspace dirs: %v", err)
-		status.Stage = StageFailed
-		status.Error = err.Error()
+		setupErr = err
+		markFailed(status, "setup", err)
 		return err
 	}
 	log.Printf("[WorkflowOrchestrator] Workspace directories created")
@@ -151,6 +285,8 @@ func (wo *WorkflowOrchestrator) executeWorkflow(ctx context.Context, workflowID,
 		}
 	}()
 
+	wo.notifyLifecycle(models.WebhookWorkflowStarted, workflowID, "")
+
 	// 阶段 1: 研究员生成大纲
 	log.Printf("[executeWorkflow] [%s] Starting research stage", workflowID)
 	err := wo.executeResearchStage(ctx, workflowID, topic, requirements, deps)
@@ -160,6 +296,7 @@ func (wo *WorkflowOrchestrator) executeWorkflow(ctx context.Context, workflowID,
 		return
 	}
 	log.Printf("[executeWorkflow] [%s] Research stage completed", workflowID)
+	wo.notifyLifecycle(models.WebhookWorkflowStageCompleted, workflowID, StageResearch)
 
 	// 阶段 2: 作家撰写内容
 	log.Printf("[executeWorkflow] [%s] Starting writing stage", workflowID)
@@ -170,6 +307,7 @@ func (wo *WorkflowOrchestrator) executeWorkflow(ctx context.Context, workflowID,
 		return
 	}
 	log.Printf("[executeWorkflow] [%s] Writing stage completed", workflowID)
+	wo.notifyLifecycle(models.WebhookWorkflowStageCompleted, workflowID, StageWriting)
 
 	// 阶段 3: 编辑审校润色
 	log.Printf("[executeWorkflow] [%s] Starting editing stage", workflowID)
@@ -180,6 +318,7 @@ func (wo *WorkflowOrchestrator) executeWorkflow(ctx context.Context, workflowID,
 		return
 	}
 	log.Printf("[executeWorkflow] [%s] Editing stage completed", workflowID)
+	wo.notifyLifecycle(models.WebhookWorkflowStageCompleted, workflowID, StageEditing)
 
 	// 完成
 	log.Printf("[executeWorkflow] [%s] All stages completed, marking as complete", workflowID)
@@ -343,6 +482,7 @@ func (wo *WorkflowOrchestrator) executeEditingStage(ctx context.Context, workflo
 		log.Printf("[executeEditingStage] [%s] ✓ final.md exists (size: %d bytes)", workflowID, len(content))
 		wo.updateProgress(workflowID, StageEditing, 100)
 		wo.addEvent(workflowID, StageEditing, "stage_complete", "终稿已完成")
+		wo.checkGuidance(workflowID, string(content))
 	} else {
 		log.Printf("[executeEditingStage] [%s] ✗ final.md NOT FOUND at %s", workflowID, finalPath)
 		log.Printf("[executeEditingStage] [%s] Editor did not write final.md file", workflowID)
@@ -418,15 +558,19 @@ func (wo *WorkflowOrchestrator) ensureWorkspaceDirs(workDir string) error {
 	return nil
 }
 
-// GetWorkflowStatus 获取工作流状态
+// GetWorkflowStatus 获取工作流状态的副本（附带 Agent 状态和待审批的工具调用）
+// 共享的状态对象只在持有写锁时修改，这里只读取并在副本上填充
 func (wo *WorkflowOrchestrator) GetWorkflowStatus(workflowID string) (*WorkflowStatus, error) {
 	wo.mu.RLock()
 	defer wo.mu.RUnlock()
 
-	status, exists := wo.workflows[workflowID]
+	shared, exists := wo.workflows[workflowID]
 	if !exists {
 		return nil, fmt.Errorf("workflow not found: %s", workflowID)
 	}
+	status := *shared
+	status.Events = append(make([]WorkflowEvent, 0, len(shared.Events)), shared.Events...)
+	status.GuideViolations = append([]models.GuideViolation(nil), shared.GuideViolations...)
 
 	// 更新 Agent 状态
 	deps, err := wo.poolManager.GetWorkflowDeps(workflowID)
@@ -435,8 +579,9 @@ func (wo *WorkflowOrchestrator) GetWorkflowStatus(workflowID string) (*WorkflowS
 		status.WriterStatus, _ = wo.poolManager.GetAgentStatus(deps.WriterID)
 		status.EditorStatus, _ = wo.poolManager.GetAgentStatus(deps.EditorID)
 	}
+	status.PendingApprovals = wo.approvals.Pending("", workflowID)
 
-	return status, nil
+	return &status, nil
 }
 
 // GetArtifacts 获取工作流产物
@@ -469,6 +614,49 @@ func (wo *WorkflowOrchestrator) GetArtifacts(workflowID string) (map[string]stri
 	return artifacts, nil
 }
 
+// checkGuidance 检查终稿是否仍包含禁用词
+func (wo *WorkflowOrchestrator) checkGuidance(workflowID, final string) {
+	wo.mu.Lock()
+	status, exists := wo.workflows[workflowID]
+	if !exists {
+		wo.mu.Unlock()
+		return
+	}
+	violations := status.guidance.Check(final)
+	status.GuideViolations = violations
+	wo.mu.Unlock()
+
+	for _, v := range violations {
+		wo.addEvent(workflowID, StageEditing, "guide_violation", fmt.Sprintf("终稿中出现禁用词「%s」%d 次", v.Term, v.Count))
+	}
+}
+
+// onApproval 将工作流 Agent 的审批请求记录为工作流事件
+func (wo *WorkflowOrchestrator) onApproval(request models.ApprovalRequest) {
+	if request.WorkflowID == "" {
+		return
+	}
+
+	wo.mu.RLock()
+	status, exists := wo.workflows[request.WorkflowID]
+	var stage WorkflowStage
+	if exists {
+		stage = status.Stage
+	}
+	wo.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	if request.Status == models.ApprovalStatusPending {
+		wo.addEvent(request.WorkflowID, stage, "approval_required",
+			fmt.Sprintf("工具 %s 等待审批 (request %s): %s", request.Tool, request.ID, request.Arguments))
+		return
+	}
+	wo.addEvent(request.WorkflowID, stage, "approval_resolved",
+		fmt.Sprintf("工具 %s 审批结果: %s %s", request.Tool, request.Status, request.Note))
+}
+
 // 辅助方法
 func (wo *WorkflowOrchestrator) updateProgress(workflowID string, stage WorkflowStage, progress int) {
 	wo.mu.Lock()
@@ -497,27 +685,81 @@ func (wo *WorkflowOrchestrator) addEvent(workflowID string, stage WorkflowStage,
 
 func (wo *WorkflowOrchestrator) failWorkflow(workflowID, stage string, err error) {
 	wo.mu.Lock()
-	defer wo.mu.Unlock()
+	status, exists := wo.workflows[workflowID]
+	if exists {
+		markFailed(status, stage, err)
+	}
+	wo.mu.Unlock()
 
-	if status, exists := wo.workflows[workflowID]; exists {
-		status.Stage = StageFailed
-		status.Error = fmt.Sprintf("%s stage failed: %v", stage, err)
-		now := time.Now()
-		status.EndTime = &now
-		log.Printf("[Workflow %s] FAILED at %s: %v", workflowID, stage, err)
+	if exists {
+		wo.notifyLifecycle(models.WebhookWorkflowFailed, workflowID, "")
 	}
 }
 
+// markFailed 把工作流标记为失败（调用方需持有写锁，并在释放锁后发出 workflow.failed 事件）
+func markFailed(status *WorkflowStatus, stage string, err error) {
+	status.Stage = StageFailed
+	status.Error = fmt.Sprintf("%s stage failed: %v", stage, err)
+	now := time.Now()
+	status.EndTime = &now
+	log.Printf("[Workflow %s] FAILED at %s: %v", status.WorkflowID, stage, err)
+}
+
 func (wo *WorkflowOrchestrator) completeWorkflow(workflowID string) {
 	wo.mu.Lock()
-	defer wo.mu.Unlock()
-
-	if status, exists := wo.workflows[workflowID]; exists {
+	status, exists := wo.workflows[workflowID]
+	if exists {
 		status.Stage = StageComplete
 		status.Progress = 100
 		now := time.Now()
 		status.EndTime = &now
-		wo.addEvent(workflowID, StageComplete, "workflow_complete", "工作流已完成")
+		// 已持有锁，直接追加事件（addEvent 会再次加锁）
+		status.Events = append(status.Events, WorkflowEvent{
+			Time:      now,
+			Stage:     StageComplete,
+			EventType: "workflow_complete",
+			Message:   "工作流已完成",
+		})
 		log.Printf("[Workflow %s] COMPLETED", workflowID)
 	}
+	wo.mu.Unlock()
+
+	if exists {
+		wo.notifyLifecycle(models.WebhookWorkflowCompleted, workflowID, "")
+	}
+}
+
+// notifyLifecycle 通知工作流生命周期事件，完成事件附带工作流产物
+func (wo *WorkflowOrchestrator) notifyLifecycle(eventType, workflowID string, completed WorkflowStage) {
+	wo.mu.RLock()
+	status, exists := wo.workflows[workflowID]
+	if !exists || len(wo.lifecycleHooks) == 0 {
+		wo.mu.RUnlock()
+		return
+	}
+	event := WorkflowLifecycleEvent{
+		Type:            eventType,
+		WorkflowID:      workflowID,
+		Topic:           status.Topic,
+		Requirements:    status.Requirements,
+		Model:           status.Model,
+		Stage:           status.Stage,
+		CompletedStage:  completed,
+		Progress:        status.Progress,
+		StartTime:       status.StartTime,
+		EndTime:         status.EndTime,
+		Error:           status.Error,
+		GuideViolations: status.GuideViolations,
+	}
+	hooks := append([]func(WorkflowLifecycleEvent){}, wo.lifecycleHooks...)
+	wo.mu.RUnlock()
+
+	if eventType == models.WebhookWorkflowCompleted {
+		if artifacts, err := wo.GetArtifacts(workflowID); err == nil {
+			event.Artifacts = artifacts
+		}
+	}
+	for _, hook := range hooks {
+		hook(event)
+	}
 }
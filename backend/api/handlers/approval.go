@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	agentmgr "github.com/coso/agentdemo/backend/agent"
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// ApprovalHandler 工具调用审批处理器
+type ApprovalHandler struct {
+	policyStore  *storage.ApprovalPolicyStore
+	sessionStore storage.SessionRepository
+	agentManager *agentmgr.Manager
+}
+
+// NewApprovalHandler 创建工具调用审批处理器
+func NewApprovalHandler(policyStore *storage.ApprovalPolicyStore, sessionStore storage.SessionRepository, agentManager *agentmgr.Manager) *ApprovalHandler {
+	return &ApprovalHandler{
+		policyStore:  policyStore,
+		sessionStore: sessionStore,
+		agentManager: agentManager,
+	}
+}
+
+// GetPolicy 获取审批策略
+// GET /api/approvals/policy
+func (h *ApprovalHandler) GetPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, h.policyStore.Get())
+}
+
+// UpdatePolicy 替换审批策略，对之后的工具调用立即生效
+// PUT /api/approvals/policy
+func (h *ApprovalHandler) UpdatePolicy(c *gin.Context) {
+	var policy models.ApprovalPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	patterns, err := agentmgr.ValidatePolicy(&policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if policy.Rules == nil {
+		policy.Rules = []models.ApprovalRule{}
+	}
+
+	if err := h.policyStore.Set(&policy, patterns); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	log.Printf("[ApprovalHandler] Approval policy updated: %d rules, default %s", len(policy.Rules), policy.DefaultAction)
+	c.JSON(http.StatusOK, policy)
+}
+
+// ListPending 列出待审批的工具调用
+// 可通过 ?session_id= / ?agent_id= / ?workflow_id= 过滤
+// GET /api/approvals
+func (h *ApprovalHandler) ListPending(c *gin.Context) {
+	agentID := c.Query("agent_id")
+	if sessionID := c.Query("session_id"); sessionID != "" {
+		session, err := h.sessionStore.Get(sessionID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+			return
+		}
+		agentID = session.AgentID
+	}
+
+	c.JSON(http.StatusOK, h.agentManager.Approvals().Pending(agentID, c.Query("workflow_id")))
+}
+
+// Decide 对待审批的工具调用做出决定（allow / deny）
+// POST /api/approvals/:id
+func (h *ApprovalHandler) Decide(c *gin.Context) {
+	var req models.ApprovalDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	approvals := h.agentManager.Approvals()
+	requestID := c.Param("id")
+	if _, ok := approvals.Get(requestID); !ok {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "no pending approval request: " + requestID})
+		return
+	}
+
+	if err := approvals.Decide(requestID, req.Decision, req.Note); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "decision recorded"})
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	agentmgr "github.com/coso/agentdemo/backend/agent"
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// BranchHandler 会话分支处理器（编辑历史消息、切换分支）
+type BranchHandler struct {
+	sessionStore storage.SessionRepository
+	history      *storage.HistoryStore
+	agentManager *agentmgr.Manager
+	queue        *agentmgr.MessageQueue
+}
+
+// NewBranchHandler 创建会话分支处理器
+func NewBranchHandler(sessionStore storage.SessionRepository, history *storage.HistoryStore, agentManager *agentmgr.Manager, queue *agentmgr.MessageQueue) *BranchHandler {
+	return &BranchHandler{
+		sessionStore: sessionStore,
+		history:      history,
+		agentManager: agentManager,
+		queue:        queue,
+	}
+}
+
+// EditMessage 编辑历史中的用户消息并从该处重新生成回复
+// 原来的后续对话保留在旧分支中；进行中的轮次会被中止，排队中的消息会被取消
+// POST /api/sessions/:id/messages/:messageId/edit
+func (h *BranchHandler) EditMessage(c *gin.Context) {
+	var req models.EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "message must not be empty"})
+		return
+	}
+
+	session, err := h.sessionStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	// 关闭 Agent 后再改写其消息，重建时从截断后的历史加载
+	h.queue.Clear(session.ID)
+	if err := h.agentManager.RemoveAgent(session.AgentID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	branch, forkErr := h.history.Fork(session.AgentID, c.Param("messageId"), sessionBranchParams(session), models.Branch{
+		Kind:         models.BranchEdit,
+		Preview:      req.Message,
+		BranchParams: sessionBranchParams(session),
+	})
+
+	// 无论分叉是否成功都重建 Agent，已连接的 WebSocket 客户端会切换到新 Agent 并收到最新历史
+	_, err = h.agentManager.GetOrCreateSessionAgent(context.Background(), session)
+	if forkErr != nil {
+		c.JSON(statusForBranchError(forkErr), models.ErrorResponse{Error: forkErr.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// 更新会话时间，编辑后的消息交给消息队列处理
+	session.UpdatedAt = time.Now()
+	h.sessionStore.Update(session)
+
+	item, err := h.queue.Enqueue(session.ID, req.Message)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("[BranchHandler] Session %s forked at message %s into branch %s", session.ID, branch.ForkMessageID, branch.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": session.ID,
+		"branch":     branch,
+		"status":     item.Status,
+		"item":       item,
+		"message":    "Message edited, connect to WebSocket for real-time updates",
+	})
+}
+
+// Regenerate 丢弃最后一轮回复并重新生成，可指定其他模型或模板（之后的对话沿用新的模型和模板，直到切换分支）
+// 原回复和每次重新生成的结果都作为变体保留，各自记录使用的模板和模型，通过 GET /variants 查看，checkout 选用并恢复；
+// 进行中的轮次会被中止，排队中的消息会被取消
+// POST /api/sessions/:id/regenerate
+func (h *BranchHandler) Regenerate(c *gin.Context) {
+	var req models.RegenerateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	if req.Temperature != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "temperature is not supported: the agent model config has no temperature setting"})
+		return
+	}
+
+	session, err := h.sessionStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return
+	}
+	if req.AgentType != "" {
+		if err := h.agentManager.Templates().CheckChat(req.AgentType); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	spec := models.Branch{Kind: models.BranchRegenerate, BranchParams: sessionBranchParams(session)}
+	if req.Model != "" || req.AgentType != "" {
+		spec.Params = &req
+	}
+	if req.AgentType != "" {
+		spec.AgentType = req.AgentType
+	}
+	if req.Model != "" {
+		spec.Model = req.Model
+	}
+
+	h.queue.Clear(session.ID)
+	if err := h.agentManager.RemoveAgent(session.AgentID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	branch, message, forkErr := h.history.ForkLastTurn(session.AgentID, sessionBranchParams(session), spec)
+	if forkErr == nil {
+		session.AgentType, session.Model = spec.AgentType, spec.Model
+	}
+
+	// 无论分叉是否成功都重建 Agent，已连接的 WebSocket 客户端会切换到新 Agent 并收到最新历史
+	_, err = h.agentManager.GetOrCreateSessionAgent(context.Background(), session)
+	if forkErr != nil {
+		status := statusForBranchError(forkErr)
+		if errors.Is(forkErr, storage.ErrNothingToRegenerate) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{Error: forkErr.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// 先保存修改后的模型和模板，再交给消息队列处理
+	session.UpdatedAt = time.Now()
+	h.sessionStore.Update(session)
+
+	item, err := h.queue.Enqueue(session.ID, message)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("[BranchHandler] Session %s regenerating last turn in branch %s", session.ID, branch.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": session.ID,
+		"branch":     branch,
+		"status":     item.Status,
+		"item":       item,
+		"message":    "Regenerating, connect to WebSocket for real-time updates",
+	})
+}
+
+// ListVariants 列出当前这一轮回复的全部变体，选用某个变体即切换到对应分支
+// GET /api/sessions/:id/variants
+func (h *BranchHandler) ListVariants(c *gin.Context) {
+	session, err := h.sessionStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	variants, err := h.history.Variants(session.AgentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, variants)
+}
+
+// ForkSession 将会话分叉为新的独立会话，复制到指定位置为止的历史，可使用其他模板或模型
+// ?at=<消息序号> 复制第 0 ~ at 条消息（含），省略时复制全部；工作区文件不复制，原会话不受影响
+// POST /api/sessions/:id/fork
+func (h *BranchHandler) ForkSession(c *gin.Context) {
+	var req models.ForkSessionRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	source, err := h.sessionStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	var count int
+	if c.Query("at") != "" {
+		at, err := parseNonNegative(c, "at")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		count = at + 1
+	} else {
+		messages, err := h.history.Sync(source.AgentID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		count = len(messages)
+	}
+
+	agentType := source.AgentType
+	if req.AgentType != "" {
+		if err := h.agentManager.Templates().CheckChat(req.AgentType); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		agentType = req.AgentType
+	}
+	model := source.Model
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	title := strings.TrimSpace(req.Title)
+	titleEdited := title != "" || source.TitleEdited
+	if title == "" {
+		title = source.Title
+		if source.TitleEdited {
+			title += " (fork)"
+		}
+	}
+
+	session := &models.Session{
+		ID:          uuid.New().String(),
+		Title:       title,
+		TitleEdited: titleEdited,
+		ForkedFrom:  source.ID,
+		AgentID:     "agt:" + uuid.New().String(),
+		AgentType:   agentType,
+		Model:       model,
+		Tags:        source.Tags,
+		GuideRefs:   source.GuideRefs,
+	}
+
+	if err := h.history.Copy(source.AgentID, session.AgentID, count); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrInvalidForkPoint) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.sessionStore.Create(session); err != nil {
+		storage.PurgeAgentData(session.AgentID)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("[BranchHandler] Session %s forked into %s with %d messages", source.ID, session.ID, count)
+
+	c.JSON(http.StatusOK, session)
+}
+
+// ListBranches 列出会话的全部分支
+// GET /api/sessions/:id/branches
+func (h *BranchHandler) ListBranches(c *gin.Context) {
+	session, err := h.sessionStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	branches, err := h.history.Branches(session.AgentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, branches)
+}
+
+// CheckoutBranch 切换到指定分支，Agent 从该分支的历史继续对话，并恢复该分支记录的模板和模型；
+// 进行中的轮次和排队中的消息会被取消
+// POST /api/sessions/:id/branches/:branchId/checkout
+func (h *BranchHandler) CheckoutBranch(c *gin.Context) {
+	session, err := h.sessionStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	h.queue.Clear(session.ID)
+	if err := h.agentManager.RemoveAgent(session.AgentID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	branches, checkoutErr := h.history.Checkout(session.AgentID, c.Param("branchId"), sessionBranchParams(session))
+	if checkoutErr == nil {
+		h.restoreBranchParams(session, branches)
+	}
+
+	// 立即重建 Agent，已连接的 WebSocket 客户端会切换到新 Agent 并收到新分支的历史
+	_, err = h.agentManager.GetOrCreateSessionAgent(context.Background(), session)
+	if checkoutErr != nil {
+		c.JSON(statusForBranchError(checkoutErr), models.ErrorResponse{Error: checkoutErr.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, branches)
+}
+
+// statusForBranchError 将分支错误映射为 HTTP 状态码
+func statusForBranchError(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrNotEditable):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// sessionBranchParams 会话当前的模板和模型
+func sessionBranchParams(session *models.Session) models.BranchParams {
+	return models.BranchParams{AgentType: session.AgentType, Model: session.Model}
+}
+
+// restoreBranchParams 把活动分支记录的模板和模型恢复到会话上并保存
+// 没有记录（旧数据）或模板已不可用时保留会话当前的设置
+func (h *BranchHandler) restoreBranchParams(session *models.Session, branches *models.BranchList) {
+	for _, branch := range branches.Branches {
+		if branch.ID != branches.Active || branch.AgentType == "" {
+			continue
+		}
+		if err := h.agentManager.Templates().CheckChat(branch.AgentType); err != nil {
+			log.Printf("[BranchHandler] Session %s keeps template %s: %v", session.ID, session.AgentType, err)
+			return
+		}
+		if branch.BranchParams == sessionBranchParams(session) {
+			return
+		}
+		session.AgentType, session.Model = branch.AgentType, branch.Model
+		session.UpdatedAt = time.Now()
+		if err := h.sessionStore.Update(session); err != nil {
+			log.Printf("[BranchHandler] Failed to restore template and model of session %s: %v", session.ID, err)
+		}
+		return
+	}
+}
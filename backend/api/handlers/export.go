@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	agentmgr "github.com/coso/agentdemo/backend/agent"
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const exportTimeFormat = "2006-01-02 15:04:05"
+
+// ExportHandler 会话与工作流导出处理器
+type ExportHandler struct {
+	sessionStore storage.SessionRepository
+	history      *storage.HistoryStore
+	agentManager *agentmgr.Manager
+	orchestrator *agentmgr.WorkflowOrchestrator
+}
+
+// NewExportHandler 创建导出处理器
+func NewExportHandler(sessionStore storage.SessionRepository, history *storage.HistoryStore, agentManager *agentmgr.Manager, orchestrator *agentmgr.WorkflowOrchestrator) *ExportHandler {
+	return &ExportHandler{
+		sessionStore: sessionStore,
+		history:      history,
+		agentManager: agentManager,
+		orchestrator: orchestrator,
+	}
+}
+
+// ExportSession 导出会话（当前分支）的标题、模型、带时间戳的消息和工具调用
+// ?format=md|json|html|jsonl，默认 md；格式说明见 docs/EXPORT_FORMAT.md
+// GET /api/sessions/:id/export
+func (h *ExportHandler) ExportSession(c *gin.Context) {
+	format := c.DefaultQuery("format", models.ExportMarkdown)
+	if !validExportFormat(format) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "format must be md, json, html or jsonl"})
+		return
+	}
+
+	session, err := h.sessionStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	messages, err := h.history.Sync(session.AgentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	branches, err := h.history.Branches(session.AgentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	export := &models.SessionExport{
+		Schema:     models.SessionExportSchema,
+		Version:    models.ExportVersion,
+		ExportedAt: time.Now(),
+		Session:    session,
+		Model:      h.agentManager.SessionModel(session),
+		Branch:     branches.Active,
+		Messages:   messages,
+	}
+
+	var body []byte
+	switch format {
+	case models.ExportJSON:
+		body, err = json.MarshalIndent(export, "", "  ")
+	case models.ExportJSONL:
+		body, err = sessionJSONL(export)
+	case models.ExportHTML:
+		body, err = renderHTML(sessionHTML, export)
+	default:
+		body = sessionMarkdown(export)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sendExport(c, "session-"+session.ID, format, body)
+}
+
+// ExportWorkflow 导出工作流：概要、大纲、初稿、终稿和事件日志
+// ?format=md|json|html|jsonl，默认 md；格式说明见 docs/EXPORT_FORMAT.md
+// GET /api/workflow/:id/export
+func (h *ExportHandler) ExportWorkflow(c *gin.Context) {
+	format := c.DefaultQuery("format", models.ExportMarkdown)
+	if !validExportFormat(format) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "format must be md, json, html or jsonl"})
+		return
+	}
+
+	workflowID := c.Param("id")
+	status, err := h.orchestrator.GetWorkflowStatus(workflowID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	artifacts, err := h.orchestrator.GetArtifacts(workflowID)
+	if err != nil {
+		// 工作流创建 Agent 前失败时没有产物
+		artifacts = map[string]string{}
+	}
+
+	export := &models.WorkflowExport{
+		Schema:     models.WorkflowExportSchema,
+		Version:    models.ExportVersion,
+		ExportedAt: time.Now(),
+		Workflow: models.WorkflowSummary{
+			WorkflowID:      status.WorkflowID,
+			Topic:           status.Topic,
+			Requirements:    status.Requirements,
+			Model:           status.Model,
+			Stage:           string(status.Stage),
+			Progress:        status.Progress,
+			StartTime:       status.StartTime,
+			EndTime:         status.EndTime,
+			Error:           status.Error,
+			GuideViolations: status.GuideViolations,
+		},
+		Artifacts: models.WorkflowArtifactsResponse{
+			Outline: artifacts["outline"],
+			Draft:   artifacts["draft"],
+			Final:   artifacts["final"],
+		},
+		Events: workflowEvents(status.Events),
+	}
+
+	var body []byte
+	switch format {
+	case models.ExportJSON:
+		body, err = json.MarshalIndent(export, "", "  ")
+	case models.ExportJSONL:
+		body, err = workflowJSONL(export)
+	case models.ExportHTML:
+		body, err = renderHTML(workflowHTML, export)
+	default:
+		body = workflowMarkdown(export)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sendExport(c, "workflow-"+workflowID, format, body)
+}
+
+// validExportFormat 是否为支持的导出格式
+func validExportFormat(format string) bool {
+	switch format {
+	case models.ExportMarkdown, models.ExportJSON, models.ExportJSONL, models.ExportHTML:
+		return true
+	}
+	return false
+}
+
+// sendExport 以附件形式返回导出内容
+func sendExport(c *gin.Context, name, format string, body []byte) {
+	contentTypes := map[string]string{
+		models.ExportMarkdown: "text/markdown; charset=utf-8",
+		models.ExportJSON:     "application/json; charset=utf-8",
+		models.ExportJSONL:    "application/x-ndjson; charset=utf-8",
+		models.ExportHTML:     "text/html; charset=utf-8",
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+	c.Data(http.StatusOK, contentTypes[format], body)
+}
+
+// sessionJSONL 会话的 JSON Lines 导出：首行为会话信息，之后每行一条消息
+func sessionJSONL(export *models.SessionExport) ([]byte, error) {
+	lines := []interface{}{struct {
+		Type       string          `json:"type"`
+		Schema     string          `json:"schema"`
+		Version    int             `json:"version"`
+		ExportedAt time.Time       `json:"exported_at"`
+		Session    *models.Session `json:"session"`
+		Model      string          `json:"model"`
+		Branch     string          `json:"branch"`
+	}{"session", export.Schema, export.Version, export.ExportedAt, export.Session, export.Model, export.Branch}}
+	for _, msg := range export.Messages {
+		lines = append(lines, struct {
+			Type string `json:"type"`
+			models.HistoryMessage
+		}{"message", msg})
+	}
+	return jsonLines(lines)
+}
+
+// workflowJSONL 工作流的 JSON Lines 导出：首行为概要和产物，之后每行一个事件
+func workflowJSONL(export *models.WorkflowExport) ([]byte, error) {
+	lines := []interface{}{struct {
+		Type       string                           `json:"type"`
+		Schema     string                           `json:"schema"`
+		Version    int                              `json:"version"`
+		ExportedAt time.Time                        `json:"exported_at"`
+		Workflow   models.WorkflowSummary           `json:"workflow"`
+		Artifacts  models.WorkflowArtifactsResponse `json:"artifacts"`
+	}{"workflow", export.Schema, export.Version, export.ExportedAt, export.Workflow, export.Artifacts}}
+	for _, event := range export.Events {
+		lines = append(lines, struct {
+			Type string `json:"type"`
+			models.WorkflowEventData
+		}{"event", event})
+	}
+	return jsonLines(lines)
+}
+
+// jsonLines 每个值编码为一行 JSON
+func jsonLines(values []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	for _, v := range values {
+		if err := encoder.Encode(v); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// sessionMarkdown 会话的 Markdown 导出
+func sessionMarkdown(export *models.SessionExport) []byte {
+	var b strings.Builder
+	session := export.Session
+
+	fmt.Fprintf(&b, "# %s\n\n", session.Title)
+	fmt.Fprintf(&b, "- 会话 ID：`%s`\n", session.ID)
+	fmt.Fprintf(&b, "- 模板：`%s`\n", session.AgentType)
+	fmt.Fprintf(&b, "- 模型：`%s`\n", export.Model)
+	fmt.Fprintf(&b, "- 分支：`%s`\n", export.Branch)
+	fmt.Fprintf(&b, "- 创建时间：%s\n", formatExportTime(session.CreatedAt))
+	fmt.Fprintf(&b, "- 更新时间：%s\n", formatExportTime(session.UpdatedAt))
+	fmt.Fprintf(&b, "- 导出时间：%s\n", formatExportTime(export.ExportedAt))
+	if len(session.Tags) > 0 {
+		fmt.Fprintf(&b, "- 标签：%s\n", strings.Join(session.Tags, "、"))
+	}
+
+	for _, msg := range export.Messages {
+		fmt.Fprintf(&b, "\n---\n\n### %s · %s\n\n", messageLabel(msg), formatExportTime(msg.Timestamp))
+
+		parts := make([]string, 0, len(msg.Blocks))
+		for _, block := range msg.Blocks {
+			switch block.Type {
+			case models.BlockText:
+				parts = append(parts, strings.TrimSpace(block.Text))
+			case models.BlockToolUse:
+				parts = append(parts, fmt.Sprintf("**🔧 调用工具 `%s`**\n\n%s", block.Name, codeBlock("json", toolInput(block))))
+			case models.BlockToolResult:
+				title := "**📎 工具结果**"
+				if block.IsError {
+					title = "**⚠️ 工具错误**"
+				}
+				parts = append(parts, fmt.Sprintf("%s\n\n%s", title, codeBlock("", toolOutput(block))))
+			default:
+				parts = append(parts, codeBlock("json", string(block.Raw)))
+			}
+		}
+		b.WriteString(strings.Join(parts, "\n\n") + "\n")
+	}
+	return []byte(b.String())
+}
+
+// workflowMarkdown 工作流的 Markdown 导出
+func workflowMarkdown(export *models.WorkflowExport) []byte {
+	var b strings.Builder
+	workflow := export.Workflow
+
+	fmt.Fprintf(&b, "# %s\n\n", workflowTitle(workflow))
+	fmt.Fprintf(&b, "- 工作流 ID：`%s`\n", workflow.WorkflowID)
+	if workflow.Requirements != "" {
+		fmt.Fprintf(&b, "- 要求：%s\n", workflow.Requirements)
+	}
+	if workflow.Model != "" {
+		fmt.Fprintf(&b, "- 模型：`%s`\n", workflow.Model)
+	}
+	fmt.Fprintf(&b, "- 阶段：%s（%d%%）\n", workflow.Stage, workflow.Progress)
+	fmt.Fprintf(&b, "- 开始时间：%s\n", formatExportTime(workflow.StartTime))
+	if workflow.EndTime != nil {
+		fmt.Fprintf(&b, "- 结束时间：%s\n", formatExportTime(*workflow.EndTime))
+	}
+	fmt.Fprintf(&b, "- 导出时间：%s\n", formatExportTime(export.ExportedAt))
+	if workflow.Error != "" {
+		fmt.Fprintf(&b, "- 错误：%s\n", workflow.Error)
+	}
+	for _, v := range workflow.GuideViolations {
+		fmt.Fprintf(&b, "- 禁用词「%s」出现 %d 次\n", v.Term, v.Count)
+	}
+
+	for _, section := range []struct{ title, content string }{
+		{"大纲", export.Artifacts.Outline},
+		{"初稿", export.Artifacts.Draft},
+		{"终稿", export.Artifacts.Final},
+	} {
+		fmt.Fprintf(&b, "\n## %s\n\n", section.title)
+		if section.content == "" {
+			b.WriteString("_（无）_\n")
+			continue
+		}
+		b.WriteString(strings.TrimSpace(section.content) + "\n")
+	}
+
+	b.WriteString("\n## 事件日志\n\n| 时间 | 阶段 | 事件 | 内容 |\n| --- | --- | --- | --- |\n")
+	for _, event := range export.Events {
+		message := event.Message
+		if event.ToolCall != nil {
+			message = fmt.Sprintf("%s（工具 `%s`，%s）", message, event.ToolCall.Name, event.ToolCall.State)
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", formatExportTime(event.Time), event.Stage, event.EventType, tableCell(message))
+	}
+	return []byte(b.String())
+}
+
+// renderHTML 渲染独立的 HTML 页面（内联样式，可直接打印）
+func renderHTML(tmpl *template.Template, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// messageLabel 消息角色的显示名称
+func messageLabel(msg models.HistoryMessage) string {
+	if msg.Role == "assistant" {
+		if msg.Stopped {
+			return "🤖 助手（已停止）"
+		}
+		return "🤖 助手"
+	}
+	for _, block := range msg.Blocks {
+		if block.Type != models.BlockToolResult {
+			return "👤 用户"
+		}
+	}
+	if len(msg.Blocks) > 0 {
+		return "📎 工具结果"
+	}
+	return "👤 用户"
+}
+
+// workflowTitle 工作流标题
+func workflowTitle(workflow models.WorkflowSummary) string {
+	if workflow.Topic != "" {
+		return workflow.Topic
+	}
+	return "工作流 " + workflow.WorkflowID
+}
+
+// toolInput 格式化工具调用参数
+func toolInput(block models.ContentBlock) string {
+	if len(block.Input) == 0 {
+		return "{}"
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, block.Input, "", "  "); err != nil {
+		return string(block.Input)
+	}
+	return buf.String()
+}
+
+// toolOutput 格式化工具输出，字符串原样返回
+func toolOutput(block models.ContentBlock) string {
+	if s, ok := block.Output.(string); ok {
+		return s
+	}
+	data, err := json.MarshalIndent(block.Output, "", "  ")
+	if err != nil {
+		return fmt.Sprint(block.Output)
+	}
+	return string(data)
+}
+
+// codeBlock 生成代码块，围栏长度大于内容中最长的连续反引号
+func codeBlock(lang, content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + strings.TrimRight(content, "\n") + "\n" + fence
+}
+
+// tableCell 转义 Markdown 表格单元格
+func tableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// formatExportTime 格式化导出中的时间
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(exportTimeFormat)
+}
+
+var exportFuncs = template.FuncMap{
+	"time":   formatExportTime,
+	"label":  messageLabel,
+	"input":  toolInput,
+	"output": toolOutput,
+	"title":  workflowTitle,
+}
+
+const exportStyle = `<style>
+body { font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; max-width: 860px; margin: 2em auto; padding: 0 1em; color: #222; line-height: 1.6; }
+h1 { border-bottom: 2px solid #eee; padding-bottom: .3em; }
+.meta { color: #666; font-size: .9em; }
+.meta code { background: #f4f4f4; padding: 0 .3em; border-radius: 3px; }
+.message { border: 1px solid #e5e5e5; border-radius: 8px; padding: .8em 1em; margin: 1em 0; page-break-inside: avoid; }
+.message.assistant { background: #fafbfc; }
+.message h3 { margin: 0 0 .5em; font-size: 1em; }
+.message h3 small, .event small { color: #888; font-weight: normal; }
+.text, .artifact { white-space: pre-wrap; }
+details { margin: .5em 0; border-left: 3px solid #c9d6e3; padding-left: .8em; }
+details.error { border-color: #e3a1a1; }
+summary { cursor: pointer; color: #345; }
+pre { background: #f6f8fa; padding: .8em; overflow-x: auto; white-space: pre-wrap; word-break: break-word; }
+table { border-collapse: collapse; width: 100%; font-size: .9em; }
+th, td { border: 1px solid #e5e5e5; padding: .3em .5em; text-align: left; vertical-align: top; }
+@media print { details { display: block; } details > *:not(summary) { display: block; } summary { list-style: none; } }
+</style>`
+
+var sessionHTML = template.Must(template.New("session").Funcs(exportFuncs).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Session.Title}}</title>
+` + exportStyle + `
+</head>
+<body>
+<h1>{{.Session.Title}}</h1>
+<div class="meta">
+会话 <code>{{.Session.ID}}</code> · 模板 <code>{{.Session.AgentType}}</code> · 模型 <code>{{.Model}}</code> · 分支 <code>{{.Branch}}</code><br>
+创建于 {{time .Session.CreatedAt}} · 更新于 {{time .Session.UpdatedAt}} · 导出于 {{time .ExportedAt}}
+</div>
+{{range .Messages}}
+<div class="message {{.Role}}" id="{{.ID}}">
+<h3>{{label .}} <small>{{time .Timestamp}}</small></h3>
+{{range .Blocks}}{{if eq .Type "text"}}<div class="text">{{.Text}}</div>
+{{else if eq .Type "tool_use"}}<details><summary>🔧 调用工具 <code>{{.Name}}</code></summary><pre>{{input .}}</pre></details>
+{{else if eq .Type "tool_result"}}<details{{if .IsError}} class="error"{{end}}><summary>{{if .IsError}}⚠️ 工具错误{{else}}📎 工具结果{{end}}</summary><pre>{{output .}}</pre></details>
+{{else}}<details><summary>{{.Type}}</summary><pre>{{printf "%s" .Raw}}</pre></details>
+{{end}}{{end}}</div>
+{{end}}
+</body>
+</html>
+`))
+
+var workflowHTML = template.Must(template.New("workflow").Funcs(exportFuncs).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{title .Workflow}}</title>
+` + exportStyle + `
+</head>
+<body>
+<h1>{{title .Workflow}}</h1>
+<div class="meta">
+工作流 <code>{{.Workflow.WorkflowID}}</code>{{if .Workflow.Model}} · 模型 <code>{{.Workflow.Model}}</code>{{end}} · 阶段 {{.Workflow.Stage}}（{{.Workflow.Progress}}%）<br>
+开始于 {{time .Workflow.StartTime}}{{if .Workflow.EndTime}} · 结束于 {{time .Workflow.EndTime}}{{end}} · 导出于 {{time .ExportedAt}}
+{{if .Workflow.Requirements}}<br>要求：{{.Workflow.Requirements}}{{end}}
+{{if .Workflow.Error}}<br>错误：{{.Workflow.Error}}{{end}}
+{{range .Workflow.GuideViolations}}<br>禁用词「{{.Term}}」出现 {{.Count}} 次{{end}}
+</div>
+<h2>大纲</h2>
+<div class="artifact">{{or .Artifacts.Outline "（无）"}}</div>
+<h2>初稿</h2>
+<div class="artifact">{{or .Artifacts.Draft "（无）"}}</div>
+<h2>终稿</h2>
+<div class="artifact">{{or .Artifacts.Final "（无）"}}</div>
+<h2>事件日志</h2>
+<table>
+<tr><th>时间</th><th>阶段</th><th>事件</th><th>内容</th></tr>
+{{range .Events}}<tr class="event"><td>{{time .Time}}</td><td>{{.Stage}}</td><td>{{.EventType}}</td><td>{{.Message}}{{with .ToolCall}}<details><summary>🔧 <code>{{.Name}}</code> <small>{{.State}}</small></summary>{{if .Input}}<pre>{{.Input}}</pre>{{end}}{{if .Output}}<pre>{{.Output}}</pre>{{end}}</details>{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// GuideHandler 术语表与风格指南处理器
+type GuideHandler struct {
+	guideStore *storage.GuideStore
+}
+
+// NewGuideHandler 创建术语表与风格指南处理器
+func NewGuideHandler(guideStore *storage.GuideStore) *GuideHandler {
+	return &GuideHandler{
+		guideStore: guideStore,
+	}
+}
+
+// CreateGlossary 上传术语表
+// POST /api/glossaries
+func (h *GuideHandler) CreateGlossary(c *gin.Context) {
+	var req models.GlossaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	glossary, err := h.guideStore.CreateGlossary(req.Name, req.Terms)
+	if err != nil {
+		c.JSON(statusForStoreError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, glossary)
+}
+
+// ListGlossaries 列出术语表（最新版本）
+// GET /api/glossaries
+func (h *GuideHandler) ListGlossaries(c *gin.Context) {
+	c.JSON(http.StatusOK, h.guideStore.ListGlossaries())
+}
+
+// GetGlossary 获取术语表，可通过 ?version=N 获取历史版本
+// GET /api/glossaries/:id
+func (h *GuideHandler) GetGlossary(c *gin.Context) {
+	version, err := parseVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	glossary, err := h.guideStore.GetGlossary(c.Param("id"), version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, glossary)
+}
+
+// ListGlossaryVersions 列出术语表的全部版本
+// GET /api/glossaries/:id/versions
+func (h *GuideHandler) ListGlossaryVersions(c *gin.Context) {
+	versions, err := h.guideStore.GlossaryVersions(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// UpdateGlossary 更新术语表（生成新版本）
+// PUT /api/glossaries/:id
+func (h *GuideHandler) UpdateGlossary(c *gin.Context) {
+	var req models.GlossaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	glossary, err := h.guideStore.UpdateGlossary(c.Param("id"), req.Name, req.Terms)
+	if err != nil {
+		c.JSON(statusForStoreError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, glossary)
+}
+
+// DeleteGlossary 删除术语表
+// DELETE /api/glossaries/:id
+func (h *GuideHandler) DeleteGlossary(c *gin.Context) {
+	if err := h.guideStore.DeleteGlossary(c.Param("id")); err != nil {
+		c.JSON(statusForStoreError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "glossary deleted"})
+}
+
+// CreateStyleGuide 上传风格指南
+// POST /api/style-guides
+func (h *GuideHandler) CreateStyleGuide(c *gin.Context) {
+	var req models.StyleGuideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	guide, err := h.guideStore.CreateStyleGuide(req.Name, req.Content)
+	if err != nil {
+		c.JSON(statusForStoreError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, guide)
+}
+
+// ListStyleGuides 列出风格指南（最新版本）
+// GET /api/style-guides
+func (h *GuideHandler) ListStyleGuides(c *gin.Context) {
+	c.JSON(http.StatusOK, h.guideStore.ListStyleGuides())
+}
+
+// GetStyleGuide 获取风格指南，可通过 ?version=N 获取历史版本
+// GET /api/style-guides/:id
+func (h *GuideHandler) GetStyleGuide(c *gin.Context) {
+	version, err := parseVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	guide, err := h.guideStore.GetStyleGuide(c.Param("id"), version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, guide)
+}
+
+// ListStyleGuideVersions 列出风格指南的全部版本
+// GET /api/style-guides/:id/versions
+func (h *GuideHandler) ListStyleGuideVersions(c *gin.Context) {
+	versions, err := h.guideStore.StyleGuideVersions(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// UpdateStyleGuide 更新风格指南（生成新版本）
+// PUT /api/style-guides/:id
+func (h *GuideHandler) UpdateStyleGuide(c *gin.Context) {
+	var req models.StyleGuideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	guide, err := h.guideStore.UpdateStyleGuide(c.Param("id"), req.Name, req.Content)
+	if err != nil {
+		c.JSON(statusForStoreError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, guide)
+}
+
+// DeleteStyleGuide 删除风格指南
+// DELETE /api/style-guides/:id
+func (h *GuideHandler) DeleteStyleGuide(c *gin.Context) {
+	if err := h.guideStore.DeleteStyleGuide(c.Param("id")); err != nil {
+		c.JSON(statusForStoreError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "style guide deleted"})
+}
+
+// parseVersion 解析 ?version=N，缺省为 0（最新版本）
+func parseVersion(c *gin.Context) (int, error) {
+	v := c.Query("version")
+	if v == "" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		return 0, errors.New("version must be a positive integer")
+	}
+	return version, nil
+}
+
+// statusForStoreError 将存储层错误映射为 HTTP 状态码
+func statusForStoreError(err error) int {
+	if errors.Is(err, storage.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
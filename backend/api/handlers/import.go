@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	agentmgr "github.com/coso/agentdemo/backend/agent"
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxImportSize = 20 << 20 // 导入文件的最大字节数
+
+var errImportTooLarge = fmt.Errorf("import file exceeds %d MB", maxImportSize>>20)
+
+// ImportHandler 会话导入处理器
+type ImportHandler struct {
+	sessionStore storage.SessionRepository
+	history      *storage.HistoryStore
+	agentManager *agentmgr.Manager
+}
+
+// NewImportHandler 创建导入处理器
+func NewImportHandler(sessionStore storage.SessionRepository, history *storage.HistoryStore, agentManager *agentmgr.Manager) *ImportHandler {
+	return &ImportHandler{
+		sessionStore: sessionStore,
+		history:      history,
+		agentManager: agentManager,
+	}
+}
+
+// ImportSession 从导出文件或聊天记录创建会话，消息写入 Agent 的历史，之后可以继续对话
+// 请求体为文件内容（json / jsonl），或 multipart 表单字段 file。支持的格式：
+// 本系统的会话导出（docs/EXPORT_FORMAT.md）；role / content 消息数组、{"messages": [...]} 或每行一条消息的 jsonl
+// ?title= &agent_type= &model= 覆盖导入的值；输入包含无法导入的内容时返回 422，
+// 使用 ?skip_unsupported=true 丢弃这些内容并在结果中列出
+// POST /api/sessions/import
+func (h *ImportHandler) ImportSession(c *gin.Context) {
+	data, err := readImportFile(c)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errImportTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	parsed, err := parseImport(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if len(parsed.issues) > 0 && c.Query("skip_unsupported") != "true" {
+		c.JSON(http.StatusUnprocessableEntity, models.ImportErrorResponse{
+			Error:       fmt.Sprintf("%d item(s) cannot be imported, retry with skip_unsupported=true to drop them", len(parsed.issues)),
+			Unsupported: parsed.issues,
+		})
+		return
+	}
+
+	session, warnings, err := h.importedSession(c, parsed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	count, err := h.history.Import(session.AgentID, parsed.messages)
+	if err != nil {
+		storage.PurgeAgentData(session.AgentID)
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrInvalidImport) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// 保留原有时间，便于迁移的会话按原来的顺序排列
+	messages, err := h.history.Sync(session.AgentID)
+	if err != nil {
+		storage.PurgeAgentData(session.AgentID)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = messages[0].Timestamp
+	}
+	session.UpdatedAt = messages[len(messages)-1].Timestamp
+	if session.UpdatedAt.Before(session.CreatedAt) {
+		session.UpdatedAt = session.CreatedAt
+	}
+
+	if err := h.sessionStore.Import(session); err != nil {
+		storage.PurgeAgentData(session.AgentID)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("[ImportHandler] Session %s imported from %s with %d messages (%d skipped)", session.ID, parsed.format, count, len(parsed.issues))
+
+	c.JSON(http.StatusOK, models.ImportResponse{
+		Session:  session,
+		Format:   parsed.format,
+		Messages: count,
+		Skipped:  parsed.issues,
+		Warnings: warnings,
+	})
+}
+
+// importedSession 根据导入内容和查询参数生成新会话（新的会话 ID 和 Agent ID）
+func (h *ImportHandler) importedSession(c *gin.Context, parsed *importData) (*models.Session, []string, error) {
+	var warnings []string
+	session := &models.Session{
+		ID:        uuid.New().String(),
+		Title:     models.DefaultSessionTitle, // 第一轮对话后自动生成标题
+		AgentID:   "agt:" + uuid.New().String(),
+		AgentType: "simple-chat",
+	}
+
+	if source := parsed.session; source != nil {
+		if source.Title != "" {
+			session.Title = source.Title
+			session.TitleEdited = source.TitleEdited
+		}
+		session.Model = source.Model
+		session.CreatedAt = source.CreatedAt
+		session.Tags = source.Tags
+		session.Pinned = source.Pinned
+		session.Metadata = source.Metadata
+
+		if source.AgentType != "" {
+			if err := h.agentManager.Templates().CheckChat(source.AgentType); err == nil {
+				session.AgentType = source.AgentType
+			} else {
+				warnings = append(warnings, fmt.Sprintf("%v; using %s", err, session.AgentType))
+			}
+		}
+		if _, err := h.agentManager.LoadGuidance(source.GuideRefs); err == nil {
+			session.GuideRefs = source.GuideRefs
+		} else {
+			warnings = append(warnings, "guides not attached: "+err.Error())
+		}
+	}
+	if parsed.title != "" {
+		session.Title = parsed.title
+		session.TitleEdited = true
+	}
+
+	if title := strings.TrimSpace(c.Query("title")); title != "" {
+		session.Title = title
+		session.TitleEdited = true
+	}
+	if agentType := c.Query("agent_type"); agentType != "" {
+		if err := h.agentManager.Templates().CheckChat(agentType); err != nil {
+			return nil, nil, err
+		}
+		session.AgentType = agentType
+	}
+	if model := c.Query("model"); model != "" {
+		session.Model = model
+	}
+	return session, warnings, nil
+}
+
+// readImportFile 读取导入文件：multipart 表单字段 file，或整个请求体
+func readImportFile(c *gin.Context) ([]byte, error) {
+	var src io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		src = file
+	}
+
+	data, err := io.ReadAll(io.LimitReader(src, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportSize {
+		return nil, errImportTooLarge
+	}
+	return data, nil
+}
+
+// importData 解析后的导入内容
+type importData struct {
+	format   string
+	session  *models.Session // 本系统导出中的会话
+	title    string          // 聊天记录中的标题
+	messages []models.HistoryMessage
+	issues   []models.ImportIssue
+}
+
+// importHeader 用于识别顶层 JSON 对象的字段
+type importHeader struct {
+	Type     string          `json:"type"`
+	Schema   string          `json:"schema"`
+	Version  int             `json:"version"`
+	Session  *models.Session `json:"session"`
+	Title    string          `json:"title"`
+	Role     string          `json:"role"`
+	Messages json.RawMessage `json:"messages"`
+}
+
+// parseImport 识别导入格式并转换消息
+func parseImport(data []byte) (*importData, error) {
+	values, err := jsonValues(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, errors.New("import file is empty")
+	}
+
+	// 消息数组
+	if len(values) == 1 && values[0][0] == '[' {
+		var messages []json.RawMessage
+		if err := json.Unmarshal(values[0], &messages); err != nil {
+			return nil, fmt.Errorf("invalid message array: %w", err)
+		}
+		return convertMessages(&importData{format: models.ImportMessages}, messages, 0)
+	}
+
+	var header importHeader
+	if err := json.Unmarshal(values[0], &header); err != nil {
+		return nil, errors.New("expected a JSON object or array of messages")
+	}
+
+	switch header.Schema {
+	case "":
+	case models.SessionExportSchema:
+		if header.Version < 1 || header.Version > models.ExportVersion {
+			return nil, fmt.Errorf("unsupported %s version %d (supported: 1-%d)", header.Schema, header.Version, models.ExportVersion)
+		}
+		if header.Session == nil {
+			return nil, errors.New("export has no session")
+		}
+		parsed := &importData{format: models.ImportAgentdemo, session: header.Session}
+		if len(values) > 1 {
+			// jsonl：首行为会话，之后每行一条消息
+			return convertMessages(parsed, values[1:], 1)
+		}
+		var messages []json.RawMessage
+		if err := json.Unmarshal(header.Messages, &messages); err != nil {
+			return nil, fmt.Errorf("invalid messages: %w", err)
+		}
+		return convertMessages(parsed, messages, 0)
+	case models.WorkflowExportSchema:
+		return nil, errors.New("workflow exports cannot be imported as sessions")
+	default:
+		return nil, fmt.Errorf("unsupported schema %q", header.Schema)
+	}
+
+	switch {
+	case len(values) > 1 || header.Role != "":
+		// jsonl：每行一条消息
+		return convertMessages(&importData{format: models.ImportMessages}, values, 0)
+	case header.Messages != nil:
+		var messages []json.RawMessage
+		if err := json.Unmarshal(header.Messages, &messages); err != nil {
+			return nil, fmt.Errorf("invalid messages: %w", err)
+		}
+		parsed := &importData{format: models.ImportMessages, title: strings.TrimSpace(header.Title)}
+		return convertMessages(parsed, messages, 0)
+	default:
+		return nil, errors.New("unrecognized format: expected a session export, an array of messages or an object with messages")
+	}
+}
+
+// jsonValues 依次读取输入中的全部 JSON 值（json 为一个，jsonl 为每行一个）
+func jsonValues(data []byte) ([]json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var values []json.RawMessage
+	for {
+		var value json.RawMessage
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON (value %d): %w", len(values)+1, err)
+		}
+		values = append(values, value)
+	}
+}
+
+// importMessage 输入中的一条消息，兼容本系统导出（blocks）、Anthropic（content 块）和 OpenAI（tool_calls / tool 角色）
+type importMessage struct {
+	Type       string           `json:"type"`
+	Role       string           `json:"role"`
+	Content    json.RawMessage  `json:"content"`
+	Blocks     json.RawMessage  `json:"blocks"`
+	ToolCalls  []importToolCall `json:"tool_calls"`
+	ToolCallID string           `json:"tool_call_id"`
+	Timestamp  json.RawMessage  `json:"timestamp"`
+	CreatedAt  json.RawMessage  `json:"created_at"`
+}
+
+// importToolCall OpenAI 格式的工具调用
+type importToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// importBlock 输入中的内容块
+type importBlock struct {
+	Type      string          `json:"type"`
+	Text      *string         `json:"text"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   interface{}     `json:"content"`
+	IsError   bool            `json:"is_error"`
+}
+
+// convertMessages 转换消息，offset 为第一条消息在输入中的序号
+func convertMessages(parsed *importData, raws []json.RawMessage, offset int) (*importData, error) {
+	for i, raw := range raws {
+		index := offset + i
+		var msg importMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, fmt.Errorf("message %d: %w", index, err)
+		}
+		if msg.Type != "" && msg.Type != "message" {
+			return nil, fmt.Errorf("message %d: unexpected line type %q", index, msg.Type)
+		}
+
+		converted := models.HistoryMessage{Role: msg.Role, Timestamp: parseImportTime(msg.Timestamp, msg.CreatedAt)}
+		switch msg.Role {
+		case "user", "assistant":
+			blocks := msg.Blocks
+			if blocks == nil {
+				blocks = msg.Content
+			}
+			converted.Blocks = parsed.convertContent(index, blocks)
+			for j, call := range msg.ToolCalls {
+				block, err := toolCallBlock(call)
+				if err != nil {
+					return nil, fmt.Errorf("message %d tool_calls %d: %w", index, j, err)
+				}
+				converted.Blocks = append(converted.Blocks, block)
+			}
+		case "tool":
+			// OpenAI 的工具结果消息，转换为用户消息中的 tool_result 块
+			if msg.ToolCallID == "" {
+				return nil, fmt.Errorf("message %d: tool message requires tool_call_id", index)
+			}
+			converted.Role = "user"
+			converted.Blocks = []models.ContentBlock{{
+				Type:      models.BlockToolResult,
+				ToolUseID: msg.ToolCallID,
+				Output:    blockText(parsed.convertContent(index, msg.Content)),
+			}}
+		case "system", "developer":
+			parsed.issues = append(parsed.issues, models.ImportIssue{
+				Message: index,
+				Type:    msg.Role,
+				Reason:  "system prompts are not imported, the session template provides the system prompt",
+			})
+			continue
+		case "":
+			return nil, fmt.Errorf("message %d: missing role", index)
+		default:
+			parsed.issues = append(parsed.issues, models.ImportIssue{Message: index, Type: msg.Role, Reason: "unsupported role"})
+			continue
+		}
+		parsed.messages = append(parsed.messages, converted)
+	}
+	return parsed, nil
+}
+
+// convertContent 转换消息内容（字符串或内容块数组），无法导入的块记录到 issues
+func (d *importData) convertContent(index int, content json.RawMessage) []models.ContentBlock {
+	var blocks []models.ContentBlock
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil || len(content) == 0 || string(content) == "null" {
+		if strings.TrimSpace(text) != "" {
+			blocks = append(blocks, models.ContentBlock{Type: models.BlockText, Text: text})
+		}
+		return blocks
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(content, &raws); err != nil {
+		d.issues = append(d.issues, models.ImportIssue{Message: index, Type: "content", Reason: "content must be a string or an array of blocks"})
+		return blocks
+	}
+
+	for j, raw := range raws {
+		j := j
+		var block importBlock
+		if err := json.Unmarshal(raw, &block); err != nil {
+			d.issues = append(d.issues, models.ImportIssue{Message: index, Block: &j, Type: "unknown", Reason: "block is not an object"})
+			continue
+		}
+
+		switch block.Type {
+		case models.BlockText, "input_text", "output_text", "":
+			if block.Text == nil {
+				d.issues = append(d.issues, models.ImportIssue{Message: index, Block: &j, Type: block.Type, Reason: "block has no text"})
+				continue
+			}
+			if strings.TrimSpace(*block.Text) != "" {
+				blocks = append(blocks, models.ContentBlock{Type: models.BlockText, Text: *block.Text})
+			}
+		case models.BlockToolUse:
+			blocks = append(blocks, models.ContentBlock{Type: models.BlockToolUse, ID: block.ID, Name: block.Name, Input: block.Input})
+		case models.BlockToolResult:
+			blocks = append(blocks, models.ContentBlock{
+				Type:      models.BlockToolResult,
+				ToolUseID: block.ToolUseID,
+				Output:    block.Content,
+				IsError:   block.IsError,
+			})
+		default:
+			d.issues = append(d.issues, models.ImportIssue{Message: index, Block: &j, Type: block.Type, Reason: "unsupported content block"})
+		}
+	}
+	return blocks
+}
+
+// toolCallBlock 将 OpenAI 格式的工具调用转换为 tool_use 块
+func toolCallBlock(call importToolCall) (models.ContentBlock, error) {
+	if call.Type != "" && call.Type != "function" {
+		return models.ContentBlock{}, fmt.Errorf("unsupported tool call type %q", call.Type)
+	}
+	input := json.RawMessage(call.Function.Arguments)
+	if strings.TrimSpace(call.Function.Arguments) == "" {
+		input = json.RawMessage("{}")
+	} else if !json.Valid(input) {
+		return models.ContentBlock{}, errors.New("arguments are not valid JSON")
+	}
+	return models.ContentBlock{Type: models.BlockToolUse, ID: call.ID, Name: call.Function.Name, Input: input}, nil
+}
+
+// blockText 拼接内容块中的文本
+func blockText(blocks []models.ContentBlock) string {
+	var parts []string
+	for _, block := range blocks {
+		if block.Type == models.BlockText {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// parseImportTime 解析消息时间：RFC 3339 字符串或 Unix 时间戳（秒或毫秒），无法解析时返回零值
+func parseImportTime(values ...json.RawMessage) time.Time {
+	for _, value := range values {
+		var text string
+		if err := json.Unmarshal(value, &text); err == nil {
+			if t, err := time.Parse(time.RFC3339Nano, text); err == nil {
+				return t
+			}
+			continue
+		}
+		var seconds float64
+		if err := json.Unmarshal(value, &seconds); err == nil && seconds > 0 {
+			if seconds > 1e12 {
+				return time.UnixMilli(int64(seconds))
+			}
+			return time.Unix(int64(seconds), int64((seconds-float64(int64(seconds)))*1e9))
+		}
+	}
+	return time.Time{}
+}
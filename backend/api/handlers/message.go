@@ -2,13 +2,10 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
 	agentmgr "github.com/coso/agentdemo/backend/agent"
@@ -17,21 +14,32 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	defaultWaitTimeout = 120 // 同步聊天默认等待秒数
+	maxWaitTimeout     = 600 // 同步聊天最长等待秒数
+)
+
 // MessageHandler 消息处理器
 type MessageHandler struct {
-	sessionStore *storage.SessionStore
+	sessionStore storage.SessionRepository
+	history      *storage.HistoryStore
 	agentManager *agentmgr.Manager
+	queue        *agentmgr.MessageQueue
 }
 
 // NewMessageHandler 创建消息处理器
-func NewMessageHandler(sessionStore *storage.SessionStore, agentManager *agentmgr.Manager) *MessageHandler {
+func NewMessageHandler(sessionStore storage.SessionRepository, history *storage.HistoryStore, agentManager *agentmgr.Manager, queue *agentmgr.MessageQueue) *MessageHandler {
 	return &MessageHandler{
 		sessionStore: sessionStore,
+		history:      history,
 		agentManager: agentManager,
+		queue:        queue,
 	}
 }
 
 // SendMessage 发送消息
+// 消息进入会话的消息队列，按顺序逐条处理；排队数达到上限时返回 429
+// ?wait=true 时阻塞到本轮结束，返回 ChatResponse；?timeout= 等待秒数（默认 120，最长 600），超时返回 504，本轮继续处理
 func (h *MessageHandler) SendMessage(c *gin.Context) {
 	sessionID := c.Param("id")
 	log.Printf("[SendMessage] Received request for session: %s", sessionID)
@@ -44,6 +52,20 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 	}
 	log.Printf("[SendMessage] Message content: %q (length: %d)", req.Message, len(req.Message))
 
+	wait := c.Query("wait") == "true"
+	timeout, err := parseNonNegative(c, "timeout")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if timeout == 0 {
+		timeout = defaultWaitTimeout
+	}
+	if timeout > maxWaitTimeout {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: fmt.Sprintf("timeout must not exceed %d seconds", maxWaitTimeout)})
+		return
+	}
+
 	// 获取会话
 	session, err := h.sessionStore.Get(sessionID)
 	if err != nil {
@@ -53,123 +75,88 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 	}
 	log.Printf("[SendMessage] Session found: ID=%s, AgentID=%s, Title=%s, AgentType=%s", session.ID, session.AgentID, session.Title, session.AgentType)
 
-	// 获取或创建 Agent（使用 Session 的 AgentType）
+	// 获取或创建 Agent（使用 Session 的 AgentType），尽早报告创建失败
 	log.Printf("[SendMessage] Getting or creating agent: AgentID=%s, Template=%s", session.AgentID, session.AgentType)
-	ag, err := h.agentManager.GetOrCreateAgent(context.Background(), session.AgentID, session.AgentType)
-	if err != nil {
+	if _, err := h.agentManager.GetOrCreateSessionAgent(context.Background(), session); err != nil {
 		log.Printf("[SendMessage] ERROR: Failed to get/create agent: AgentID=%s, Template=%s, error: %v", session.AgentID, session.AgentType, err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
 		return
 	}
 	log.Printf("[SendMessage] Agent ready: %s (template: %s)", session.AgentID, session.AgentType)
 
-	// 发送消息（异步）
-	log.Printf("[SendMessage] Sending message to agent: %q", req.Message)
-	if err := ag.Send(context.Background(), req.Message); err != nil {
-		log.Printf("[SendMessage] ERROR: Failed to send message to agent: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+	if wait {
+		h.sendAndWait(c, sessionID, req.Message, time.Duration(timeout)*time.Second)
 		return
 	}
-	log.Printf("[SendMessage] Message sent successfully to agent %s", session.AgentID)
 
-	// 更新会话时间
-	session.UpdatedAt = time.Now()
-	h.sessionStore.Update(session)
+	// 加入消息队列（异步处理）
+	item, err := h.queue.Enqueue(sessionID, req.Message)
+	if err != nil {
+		log.Printf("[SendMessage] ERROR: Failed to enqueue message: %v", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, agentmgr.ErrQueueFull) {
+			status = http.StatusTooManyRequests
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("[SendMessage] Message %s queued for agent %s at position %d", item.ID, session.AgentID, item.Position)
 
 	c.JSON(http.StatusOK, gin.H{
 		"session_id": sessionID,
-		"status":     "processing",
-		"message":    "Message sent, connect to WebSocket for real-time updates",
+		"status":     item.Status,
+		"item":       item,
+		"message":    "Message queued, connect to WebSocket for real-time updates",
 	})
 	log.Printf("[SendMessage] Request completed successfully for session %s", sessionID)
 }
 
-// 用于 JSON 反序列化的简化结构
-type jsonMessage struct {
-	Role    string                   `json:"role"`
-	Content []map[string]interface{} `json:"content"`
-}
-
-// extractTextFromJSON 从 JSON content 数组中提取文本
-func extractTextFromJSON(content []map[string]interface{}) string {
-	if len(content) == 0 {
-		return ""
-	}
-
-	var textParts []string
-	for _, block := range content {
-		// 检查是否有 text 字段（TextBlock）
-		if text, ok := block["text"].(string); ok {
-			textParts = append(textParts, text)
-			continue
-		}
-
-		// 检查是否有 name 字段（ToolUseBlock）
-		if name, ok := block["name"].(string); ok {
-			textParts = append(textParts, fmt.Sprintf("[使用工具: %s]", name))
-			continue
-		}
-
-		// 检查是否有 tool_use_id 字段（ToolResultBlock）
-		if _, ok := block["tool_use_id"].(string); ok {
-			if result, hasResult := block["content"].(string); hasResult {
-				textParts = append(textParts, fmt.Sprintf("[工具结果: %s]", result))
-			} else {
-				textParts = append(textParts, "[工具结果]")
-			}
-			continue
-		}
-
-		log.Printf("[extractTextFromJSON] Unknown block format: %v", block)
+// sendAndWait 将消息加入队列并等待本轮结束（同步聊天）
+// 完成、停止和取消时返回 200，出错时返回 500，等待超时返回 504（本轮不会被取消）
+func (h *MessageHandler) sendAndWait(c *gin.Context, sessionID, message string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	resp, err := h.queue.Send(ctx, sessionID, message, nil)
+	switch {
+	case errors.Is(err, agentmgr.ErrQueueFull):
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Printf("[SendMessage] Session %s: no reply within %s, message %s keeps running", sessionID, timeout, resp.ItemID)
+		resp.Error = fmt.Sprintf("no reply within %s; the turn keeps running, follow it via GET /api/sessions/%s/queue or WebSocket", timeout, sessionID)
+		c.JSON(http.StatusGatewayTimeout, resp)
+	case err != nil:
+		// 调用方已断开，或其他错误
+		log.Printf("[SendMessage] Session %s: wait aborted: %v", sessionID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+	case resp.Status == models.QueueStatusFailed:
+		c.JSON(http.StatusInternalServerError, resp)
+	default:
+		log.Printf("[SendMessage] Session %s: message %s finished with status %s", sessionID, resp.ItemID, resp.Status)
+		c.JSON(http.StatusOK, resp)
 	}
-
-	return strings.Join(textParts, "\n")
 }
 
-// loadMessagesFromJSON 直接从 JSON 文件加载消息
-func loadMessagesFromJSON(agentID string) ([]models.Message, error) {
-	// 构建 JSON 文件路径
-	messagesPath := filepath.Join(".agentsdk", agentID, "messages.json")
-
-	// 检查文件是否存在
-	if _, err := os.Stat(messagesPath); os.IsNotExist(err) {
-		log.Printf("[loadMessagesFromJSON] Messages file not found: %s", messagesPath)
-		return []models.Message{}, nil // 返回空数组，不是错误
-	}
+// GetMessages 获取消息历史（按时间正序，包含结构化的工具调用和结果）
+// 默认返回最新的一页；?before=<消息ID> 加载更早的消息，?after=<消息ID> 加载更新的消息，?limit= 每页条数
+// GET /api/sessions/:id/messages
+func (h *MessageHandler) GetMessages(c *gin.Context) {
+	sessionID := c.Param("id")
 
-	// 读取文件
-	data, err := os.ReadFile(messagesPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read messages file: %w", err)
+	query := models.HistoryQuery{
+		Before: c.Query("before"),
+		After:  c.Query("after"),
 	}
-
-	// 解析 JSON
-	var jsonMessages []jsonMessage
-	if err := json.Unmarshal(data, &jsonMessages); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal messages: %w", err)
+	if query.Before != "" && query.After != "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "before and after cannot be used together"})
+		return
 	}
-
-	// 转换为 API 消息格式
-	messages := make([]models.Message, 0, len(jsonMessages))
-	for i, msg := range jsonMessages {
-		content := extractTextFromJSON(msg.Content)
-		apiMessage := models.Message{
-			Role:      msg.Role,
-			Content:   content,
-			Timestamp: time.Now(),
-		}
-		messages = append(messages, apiMessage)
-		log.Printf("[loadMessagesFromJSON] Message %d: role=%s, content_length=%d, blocks=%d",
-			i, msg.Role, len(content), len(msg.Content))
+	limit, err := parseNonNegative(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
 	}
-
-	return messages, nil
-}
-
-// GetMessages 获取消息历史
-func (h *MessageHandler) GetMessages(c *gin.Context) {
-	sessionID := c.Param("id")
-	log.Printf("[GetMessages] Loading messages for session: %s", sessionID)
+	query.Limit = limit
 
 	// 获取会话
 	session, err := h.sessionStore.Get(sessionID)
@@ -184,7 +171,7 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 	if !ok {
 		// Agent 不存在，尝试创建以加载历史消息（使用 Session 的 AgentType）
 		log.Printf("[GetMessages] Agent not found, creating: AgentID=%s, Template=%s", session.AgentID, session.AgentType)
-		ag, err = h.agentManager.GetOrCreateAgent(context.Background(), session.AgentID, session.AgentType)
+		ag, err = h.agentManager.GetOrCreateSessionAgent(context.Background(), session)
 		if err != nil {
 			log.Printf("[GetMessages] ERROR: Failed to create agent: %v", err)
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
@@ -192,23 +179,76 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 		}
 	}
 
-	// 获取 Agent 状态
-	status := ag.Status()
-
-	// 直接从 JSON 文件加载消息（绕过 SDK 的反序列化问题）
-	agentID := ag.ID()
-	messages, err := loadMessagesFromJSON(agentID)
+	page, err := h.history.Page(ag.ID(), query)
 	if err != nil {
-		log.Printf("[GetMessages] ERROR: Failed to load messages from JSON: %v", err)
-		// 返回空数组而不是错误，避免前端清空消息
-		messages = []models.Message{}
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
 	}
 
-	log.Printf("[GetMessages] Returning %d messages for session %s", len(messages), sessionID)
 	c.JSON(http.StatusOK, gin.H{
 		"session_id": sessionID,
-		"messages":   messages,
-		"status":     status,
+		"messages":   page.Messages,
+		"total":      page.Total,
+		"has_more":   page.HasMore,
+		"before":     page.Before,
+		"after":      page.After,
+		"status":     ag.Status(),
 	})
 }
 
+// StopTurn 停止会话当前的轮次（生成或工具调用循环），等待其结束后返回该消息
+// 已生成的部分回复保存为标记 stopped 的助手消息，Agent 随后可以继续对话；排队中的消息继续处理
+// POST /api/sessions/:id/stop
+func (h *MessageHandler) StopTurn(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, err := h.sessionStore.Get(sessionID); err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	item, err := h.queue.Stop(sessionID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, agentmgr.ErrNoRunningTurn) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// GetQueue 获取会话消息队列：处理中、排队中和最近结束的消息
+// GET /api/sessions/:id/queue
+func (h *MessageHandler) GetQueue(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, err := h.sessionStore.Get(sessionID); err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.queue.State(sessionID))
+}
+
+// CancelQueued 取消队列中的消息：排队中的移出队列，处理中的中止本轮
+// DELETE /api/sessions/:id/queue/:itemId
+func (h *MessageHandler) CancelQueued(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, err := h.sessionStore.Get(sessionID); err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	item, err := h.queue.Cancel(sessionID, c.Param("itemId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	agentmgr "github.com/coso/agentdemo/backend/agent"
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wordflowlab/agentsdk/pkg/types"
+)
+
+const (
+	// OpenAISessionHeader 将 OpenAI 兼容接口的调用绑定到已保存的会话
+	OpenAISessionHeader = "X-Session-ID"
+
+	openAIModelSeparator = "/" // model 字段中模板 ID 与模型的分隔符
+	openAIOwner          = "agentdemo"
+)
+
+// OpenAIHandler OpenAI 兼容接口处理器
+// model 对应已注册的模板（可附加 "/模型" 指定 Provider 模型）；不带会话头时每次调用使用临时 Agent，
+// 请求中的完整对话作为上下文；带会话头时只发送最后一条用户消息，上下文为会话自身的历史
+type OpenAIHandler struct {
+	sessionStore storage.SessionRepository
+	agentManager *agentmgr.Manager
+	queue        *agentmgr.MessageQueue
+}
+
+// NewOpenAIHandler 创建 OpenAI 兼容接口处理器
+func NewOpenAIHandler(sessionStore storage.SessionRepository, agentManager *agentmgr.Manager, queue *agentmgr.MessageQueue) *OpenAIHandler {
+	return &OpenAIHandler{
+		sessionStore: sessionStore,
+		agentManager: agentManager,
+		queue:        queue,
+	}
+}
+
+// openAITurn 请求中的一条用户或助手消息
+type openAITurn struct {
+	role string
+	text string
+}
+
+// openAIResult 一次调用的结果
+type openAIResult struct {
+	text         string
+	usage        *models.TokenUsage
+	finishReason string
+}
+
+// openAIRun 执行一次调用，onDelta 依次接收生成的文本片段（非流式时为 nil）
+type openAIRun func(ctx context.Context, onDelta func(string)) (*openAIResult, error)
+
+// openAISuitability 通过 OpenAI 兼容接口提供的模板适用场景（内部模板和工作流角色不对外提供）
+var openAISuitability = []string{models.SuitabilityChat, models.SuitabilityWritingTool}
+
+// ListModels 列出可用的模型（每个对话模板和写作工具模板一项）
+// GET /v1/models
+func (h *OpenAIHandler) ListModels(c *gin.Context) {
+	data := make([]models.OpenAIModel, 0)
+	seen := make(map[string]bool)
+	for _, suitability := range openAISuitability {
+		for _, t := range h.agentManager.Templates().List(suitability) {
+			if !seen[t.ID] {
+				seen[t.ID] = true
+				data = append(data, openAIModel(t.ID))
+			}
+		}
+	}
+	c.JSON(http.StatusOK, models.OpenAIModelList{Object: "list", Data: data})
+}
+
+// openAITemplate 模板是否存在且可以通过 OpenAI 兼容接口调用
+func (h *OpenAIHandler) openAITemplate(templateID string) bool {
+	info, ok := h.agentManager.Templates().Info(templateID)
+	if ok {
+		for _, s := range info.Suitability {
+			for _, allowed := range openAISuitability {
+				if s == allowed {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// GetModel 获取模型（模板）
+// GET /v1/models/:model
+func (h *OpenAIHandler) GetModel(c *gin.Context) {
+	id := c.Param("model")
+	templateID, _ := splitOpenAIModel(id)
+	if !h.openAITemplate(templateID) {
+		openAIError(c, http.StatusNotFound, "not_found_error", fmt.Sprintf("model %q does not exist, see GET /v1/models", id))
+		return
+	}
+	c.JSON(http.StatusOK, openAIModel(id))
+}
+
+// ChatCompletions OpenAI Chat Completions 兼容接口，支持流式（stream: true，SSE）和非流式
+// 请求头 X-Session-ID 将调用绑定到已保存的会话：消息进入会话的消息队列，回复写入会话历史
+// POST /v1/chat/completions
+func (h *OpenAIHandler) ChatCompletions(c *gin.Context) {
+	var req models.OpenAIChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if len(req.Tools) > 0 || len(req.Functions) > 0 {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", "tools are not supported: the agent only uses the tools of its template")
+		return
+	}
+
+	templateID, model := splitOpenAIModel(req.Model)
+	if !h.openAITemplate(templateID) {
+		openAIError(c, http.StatusNotFound, "not_found_error", fmt.Sprintf("model %q does not exist, see GET /v1/models", req.Model))
+		return
+	}
+
+	system, turns, err := parseOpenAIMessages(req.Messages)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	var run openAIRun
+	if sessionID := c.GetHeader(OpenAISessionHeader); sessionID != "" {
+		status, err := h.checkSession(sessionID, templateID, model)
+		if err != nil {
+			kind := "invalid_request_error"
+			if status == http.StatusNotFound {
+				kind = "not_found_error"
+			} else if status == http.StatusInternalServerError {
+				kind = "server_error"
+			}
+			openAIError(c, status, kind, err.Error())
+			return
+		}
+		c.Header(OpenAISessionHeader, sessionID)
+		run = h.sessionRun(sessionID, turns[len(turns)-1].text)
+	} else {
+		run = h.temporaryRun(templateID, model, openAIPrompt(system, turns))
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), maxWaitTimeout*time.Second)
+	defer cancel()
+
+	id := "chatcmpl-" + uuid.New().String()
+	created := time.Now().Unix()
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		h.stream(ctx, c, id, created, req.Model, includeUsage, run)
+		return
+	}
+
+	result, err := run(ctx, nil)
+	if err != nil {
+		status, kind := openAIRunError(err)
+		openAIError(c, status, kind, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, models.OpenAIChatCompletion{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   req.Model,
+		Choices: []models.OpenAIChoice{{
+			Message:      models.OpenAIReplyMessage{Role: "assistant", Content: result.text},
+			FinishReason: result.finishReason,
+		}},
+		Usage: openAIUsage(result.usage),
+	})
+}
+
+// checkSession 检查绑定的会话是否存在且使用 model 指定的模板和模型，并尽早创建会话 Agent
+// 会话 Agent 在请求结束后继续使用，与其他创建会话 Agent 的地方一样不使用请求的 context
+func (h *OpenAIHandler) checkSession(sessionID, templateID, model string) (int, error) {
+	session, err := h.sessionStore.Get(sessionID)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	if session.AgentType != templateID {
+		return http.StatusBadRequest, fmt.Errorf("session %s uses template %q, not %q", sessionID, session.AgentType, templateID)
+	}
+	if sessionModel := h.agentManager.SessionModel(session); model != "" && model != sessionModel {
+		return http.StatusBadRequest, fmt.Errorf("session %s uses model %q, not %q", sessionID, sessionModel, model)
+	}
+	if _, err := h.agentManager.GetOrCreateSessionAgent(context.Background(), session); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// sessionRun 通过会话的消息队列发送消息，回复写入会话历史
+func (h *OpenAIHandler) sessionRun(sessionID, message string) openAIRun {
+	return func(ctx context.Context, onDelta func(string)) (*openAIResult, error) {
+		resp, err := h.queue.Send(ctx, sessionID, message, onDelta)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.Status {
+		case models.QueueStatusFailed:
+			return nil, errors.New(resp.Error)
+		case models.QueueStatusCancelled:
+			return nil, errors.New("the turn was cancelled")
+		}
+
+		result := &openAIResult{usage: resp.Usage, finishReason: openAIFinishReason(resp.StopReason)}
+		if resp.Message != nil {
+			result.text = resp.Message.Content
+		}
+		log.Printf("[OpenAI] Session %s: message %s finished with status %s", sessionID, resp.ItemID, resp.Status)
+		return result, nil
+	}
+}
+
+// temporaryRun 使用临时 Agent 处理一次调用，结束后关闭
+func (h *OpenAIHandler) temporaryRun(templateID, model, prompt string) openAIRun {
+	return func(ctx context.Context, onDelta func(string)) (*openAIResult, error) {
+		ag, release, err := h.agentManager.CreateTemporaryAgent(ctx, templateID, model)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		var (
+			mu       sync.Mutex
+			finished bool
+			usage    models.TokenUsage
+			reason   string
+		)
+		eventCh := ag.Subscribe([]types.AgentChannel{types.ChannelProgress, types.ChannelMonitor}, nil)
+		go func() {
+			for envelope := range eventCh {
+				mu.Lock()
+				if !finished {
+					switch e := envelope.Event.(type) {
+					case *types.ProgressTextChunkEvent:
+						if onDelta != nil {
+							onDelta(e.Delta)
+						}
+					case *types.ProgressDoneEvent:
+						reason = e.Reason
+					case *types.MonitorTokenUsageEvent:
+						usage.InputTokens += e.InputTokens
+						usage.OutputTokens += e.OutputTokens
+						usage.TotalTokens += e.TotalTokens
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+
+		reply, err := ag.Chat(ctx, prompt)
+
+		mu.Lock()
+		defer mu.Unlock()
+		finished = true
+		if err != nil {
+			return nil, err
+		}
+		result := &openAIResult{finishReason: openAIFinishReason(reason)}
+		if reply != nil {
+			result.text = reply.Text
+		}
+		if usage != (models.TokenUsage{}) {
+			result.usage = &usage
+		}
+		return result, nil
+	}
+}
+
+// stream 以 SSE 输出 chat.completion.chunk 分片，最后发送 data: [DONE]
+// 开始输出后出错时发送 {"error": …} 分片（状态码已无法修改）
+func (h *OpenAIHandler) stream(ctx context.Context, c *gin.Context, id string, created int64, model string, includeUsage bool, run openAIRun) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	write := func(v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+	}
+	chunk := func(delta models.OpenAIDelta, finishReason *string) models.OpenAIChatChunk {
+		return models.OpenAIChatChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []models.OpenAIChunkChoice{{Delta: delta, FinishReason: finishReason}},
+		}
+	}
+
+	// 文本片段可能在调用返回后才送达，返回后不再写入
+	var (
+		mu     sync.Mutex
+		closed bool
+		sent   strings.Builder
+	)
+	write(chunk(models.OpenAIDelta{Role: "assistant"}, nil))
+	result, err := run(ctx, func(delta string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed || delta == "" {
+			return
+		}
+		sent.WriteString(delta)
+		write(chunk(models.OpenAIDelta{Content: delta}, nil))
+	})
+	mu.Lock()
+	closed = true
+	mu.Unlock()
+
+	if err != nil {
+		log.Printf("[OpenAI] Stream %s failed: %v", id, err)
+		_, kind := openAIRunError(err)
+		write(models.OpenAIErrorResponse{Error: models.OpenAIError{Message: err.Error(), Type: kind}})
+		fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+		c.Writer.Flush()
+		return
+	}
+
+	if rest := unsentSuffix(sent.String(), result.text); rest != "" {
+		write(chunk(models.OpenAIDelta{Content: rest}, nil))
+	}
+	finishReason := result.finishReason
+	write(chunk(models.OpenAIDelta{}, &finishReason))
+	if includeUsage {
+		write(models.OpenAIChatChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []models.OpenAIChunkChoice{},
+			Usage:   openAIUsage(result.usage),
+		})
+	}
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+// unsentSuffix 最终回复中尚未推送的部分：sent 的末尾与 reply 的开头重合的部分视为已推送
+// （sent 可能还包含工具调用前生成的文本）
+func unsentSuffix(sent, reply string) string {
+	n := len(reply)
+	if len(sent) < n {
+		n = len(sent)
+	}
+	for ; n > 0; n-- {
+		if strings.HasSuffix(sent, reply[:n]) {
+			break
+		}
+	}
+	return reply[n:]
+}
+
+// parseOpenAIMessages 解析请求中的消息：system / developer 消息作为附加说明，
+// 其余为用户和助手的对话，最后一条须为用户消息；不支持工具调用消息和非文本内容
+func parseOpenAIMessages(messages []models.OpenAIMessage) ([]string, []openAITurn, error) {
+	var system []string
+	var turns []openAITurn
+	for i, msg := range messages {
+		if msg.Role == "tool" || msg.Role == "function" || len(msg.ToolCalls) > 0 {
+			return nil, nil, fmt.Errorf("messages[%d]: tool call messages are not supported", i)
+		}
+		text, err := openAIContentText(msg.Content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+
+		switch msg.Role {
+		case "system", "developer":
+			if strings.TrimSpace(text) != "" {
+				system = append(system, text)
+			}
+		case "user", "assistant":
+			turns = append(turns, openAITurn{role: msg.Role, text: text})
+		default:
+			return nil, nil, fmt.Errorf("messages[%d]: unsupported role %q", i, msg.Role)
+		}
+	}
+
+	if len(turns) == 0 || turns[len(turns)-1].role != "user" {
+		return nil, nil, errors.New("the last message must be from the user")
+	}
+	if strings.TrimSpace(turns[len(turns)-1].text) == "" {
+		return nil, nil, errors.New("the last user message is empty")
+	}
+	return system, turns, nil
+}
+
+// openAIContentText 提取消息内容的文本：字符串，或 text 片段数组
+func openAIContentText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errors.New("content must be a string or an array of content parts")
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", fmt.Errorf("content part type %q is not supported", part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// openAIPrompt 将无状态调用的完整对话组织为发给临时 Agent 的一条消息
+func openAIPrompt(system []string, turns []openAITurn) string {
+	last := turns[len(turns)-1].text
+	if len(system) == 0 && len(turns) == 1 {
+		return last
+	}
+
+	var b strings.Builder
+	if len(system) > 0 {
+		b.WriteString("请同时遵循以下说明：\n\n")
+		b.WriteString(strings.Join(system, "\n\n"))
+		b.WriteString("\n\n")
+	}
+	if len(turns) > 1 {
+		b.WriteString("以下是此前的对话记录：\n\n")
+		for _, turn := range turns[:len(turns)-1] {
+			if turn.role == "user" {
+				b.WriteString("用户：")
+			} else {
+				b.WriteString("助手：")
+			}
+			b.WriteString(turn.text)
+			b.WriteString("\n\n")
+		}
+		b.WriteString("请回复用户的最新消息：\n\n")
+	}
+	b.WriteString(last)
+	return b.String()
+}
+
+// splitOpenAIModel 将 model 字段拆分为模板 ID 和模型（未指定模型时为空）
+func splitOpenAIModel(model string) (string, string) {
+	templateID, providerModel, _ := strings.Cut(model, openAIModelSeparator)
+	return templateID, providerModel
+}
+
+// openAIFinishReason 将 Agent 的结束原因转换为 OpenAI 的 finish_reason
+func openAIFinishReason(reason string) string {
+	if strings.Contains(reason, "max_tokens") || strings.Contains(reason, "length") {
+		return "length"
+	}
+	return "stop"
+}
+
+// openAIRunError 调用出错时的状态码和错误类型
+func openAIRunError(err error) (int, string) {
+	switch {
+	case errors.Is(err, agentmgr.ErrQueueFull):
+		return http.StatusTooManyRequests, "rate_limit_error"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "timeout_error"
+	default:
+		return http.StatusInternalServerError, "server_error"
+	}
+}
+
+// openAIUsage 转换 Token 用量，没有用量信息时为 0
+func openAIUsage(usage *models.TokenUsage) *models.OpenAIUsage {
+	if usage == nil {
+		return &models.OpenAIUsage{}
+	}
+	return &models.OpenAIUsage{
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+}
+
+// openAIModel 模型列表项
+func openAIModel(id string) models.OpenAIModel {
+	return models.OpenAIModel{ID: id, Object: "model", OwnedBy: openAIOwner}
+}
+
+// openAIError 返回 OpenAI 格式的错误
+func openAIError(c *gin.Context, status int, kind, message string) {
+	c.JSON(status, models.OpenAIErrorResponse{Error: models.OpenAIError{Message: message, Type: kind}})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	agentmgr "github.com/coso/agentdemo/backend/agent"
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PresetHandler 工作流预设处理器
+type PresetHandler struct {
+	store   *storage.PresetStore
+	presets *agentmgr.PresetLibrary
+}
+
+// NewPresetHandler 创建工作流预设处理器
+func NewPresetHandler(store *storage.PresetStore, presets *agentmgr.PresetLibrary) *PresetHandler {
+	return &PresetHandler{
+		store:   store,
+		presets: presets,
+	}
+}
+
+// CreatePreset 创建工作流预设
+// POST /api/workflow/presets
+func (h *PresetHandler) CreatePreset(c *gin.Context) {
+	var req models.WorkflowPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	preset := &models.WorkflowPreset{ID: uuid.New().String()}
+	applyPresetRequest(preset, req)
+	if err := agentmgr.ValidatePreset(preset); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.store.Create(preset); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrPresetNameTaken) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("[PresetHandler] Preset %s created: %s", preset.ID, preset.Name)
+
+	c.JSON(http.StatusCreated, preset)
+}
+
+// ListPresets 列出工作流预设（含使用次数和最近的运行记录）
+// GET /api/workflow/presets
+func (h *PresetHandler) ListPresets(c *gin.Context) {
+	c.JSON(http.StatusOK, h.store.List())
+}
+
+// GetPreset 按 ID 或名称获取工作流预设
+// GET /api/workflow/presets/:id
+func (h *PresetHandler) GetPreset(c *gin.Context) {
+	preset, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, preset)
+}
+
+// UpdatePreset 更新工作流预设（使用次数和运行记录保留）
+// PUT /api/workflow/presets/:id
+func (h *PresetHandler) UpdatePreset(c *gin.Context) {
+	existing, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req models.WorkflowPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var invalid error
+	preset, err := h.store.Modify(existing.ID, func(preset *models.WorkflowPreset) error {
+		applyPresetRequest(preset, req)
+		preset.UpdatedAt = time.Now()
+		invalid = agentmgr.ValidatePreset(preset)
+		return invalid
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, storage.ErrPresetNameTaken):
+			status = http.StatusConflict
+		case invalid != nil:
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, preset)
+}
+
+// DeletePreset 删除工作流预设
+// DELETE /api/workflow/presets/:id
+func (h *PresetHandler) DeletePreset(c *gin.Context) {
+	preset, err := h.store.Get(c.Param("id"))
+	if err == nil {
+		err = h.store.Delete(preset.ID)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Preset deleted successfully"})
+}
+
+// RenderPreset 预览用参数渲染出的主题和要求（不启动工作流）
+// POST /api/workflow/presets/:id/render
+func (h *PresetHandler) RenderPreset(c *gin.Context) {
+	preset, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req models.WorkflowStartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	start, err := h.presets.Render(preset, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"topic":        start.Topic,
+		"requirements": start.Requirements,
+		"model":        start.Model,
+		"params":       start.Params,
+	})
+}
+
+// applyPresetRequest 把请求写入预设
+func applyPresetRequest(preset *models.WorkflowPreset, req models.WorkflowPresetRequest) {
+	preset.Name = req.Name
+	preset.Description = req.Description
+	preset.Topic = req.Topic
+	preset.Requirements = req.Requirements
+	preset.Parameters = req.Parameters
+	if preset.Parameters == nil {
+		preset.Parameters = []models.PresetParameter{}
+	}
+	preset.Model = req.Model
+	preset.TargetLength = req.TargetLength
+	preset.GuideRefs = req.GuideRefs
+}
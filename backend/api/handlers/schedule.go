@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	agentmgr "github.com/coso/agentdemo/backend/agent"
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ScheduleHandler 定时工作流处理器
+type ScheduleHandler struct {
+	store     *storage.ScheduleStore
+	scheduler *agentmgr.Scheduler
+}
+
+// NewScheduleHandler 创建定时工作流处理器
+func NewScheduleHandler(store *storage.ScheduleStore, scheduler *agentmgr.Scheduler) *ScheduleHandler {
+	return &ScheduleHandler{
+		store:     store,
+		scheduler: scheduler,
+	}
+}
+
+// CreateSchedule 创建定时工作流
+// POST /api/schedules
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	var req models.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	schedule := &models.WorkflowSchedule{ID: uuid.New().String()}
+	if err := applyScheduleRequest(schedule, req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.store.Create(schedule); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("[ScheduleHandler] Schedule %s created: %q (%s)", schedule.ID, schedule.Cron, schedule.Topic)
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// ListSchedules 列出定时工作流
+// GET /api/schedules
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	c.JSON(http.StatusOK, h.store.List())
+}
+
+// GetSchedule 获取定时工作流
+// GET /api/schedules/:id
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	schedule, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateSchedule 更新定时工作流，并按新的表达式重新计算下一次运行时间（运行记录保留）
+// PUT /api/schedules/:id
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	var req models.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var invalid error
+	schedule, err := h.store.Modify(c.Param("id"), func(schedule *models.WorkflowSchedule) error {
+		invalid = applyScheduleRequest(schedule, req)
+		schedule.UpdatedAt = time.Now()
+		return invalid
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			status = http.StatusNotFound
+		case invalid != nil:
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule 删除定时工作流（运行中的工作流继续执行）
+// DELETE /api/schedules/:id
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.store.Delete(id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	h.scheduler.Forget(id)
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted successfully"})
+}
+
+// RunSchedule 立即运行一次，上一次运行尚未结束时返回 409
+// POST /api/schedules/:id/run
+func (h *ScheduleHandler) RunSchedule(c *gin.Context) {
+	run, err := h.scheduler.RunNow(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, agentmgr.ErrScheduleBusy):
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, run)
+}
+
+// ListScheduleRuns 运行记录（最新的在前），?status= 按状态过滤
+// GET /api/schedules/:id/runs
+func (h *ScheduleHandler) ListScheduleRuns(c *gin.Context) {
+	schedule, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	status := c.Query("status")
+	runs := make([]models.ScheduleRun, 0, len(schedule.Runs))
+	for _, run := range schedule.Runs {
+		if status == "" || run.Status == status {
+			runs = append(runs, run)
+		}
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+// applyScheduleRequest 校验请求并写入计划，计算下一次运行时间
+func applyScheduleRequest(schedule *models.WorkflowSchedule, req models.ScheduleRequest) error {
+	switch req.CatchUp {
+	case "":
+		req.CatchUp = models.CatchUpSkip
+	case models.CatchUpSkip, models.CatchUpOnce, models.CatchUpAll:
+	default:
+		return fmt.Errorf("catch_up must be one of %s, %s, %s", models.CatchUpSkip, models.CatchUpOnce, models.CatchUpAll)
+	}
+	if req.JitterSeconds < 0 {
+		return fmt.Errorf("jitter_seconds must not be negative")
+	}
+
+	schedule.Name = req.Name
+	if schedule.Name == "" {
+		schedule.Name = req.Topic
+	}
+	schedule.Cron = req.Cron
+	schedule.Timezone = req.Timezone
+	schedule.Topic = req.Topic
+	schedule.Requirements = req.Requirements
+	schedule.Model = req.Model
+	schedule.Enabled = req.Enabled == nil || *req.Enabled
+	schedule.JitterSeconds = req.JitterSeconds
+	schedule.CatchUp = req.CatchUp
+	schedule.GuideRefs = req.GuideRefs
+
+	return agentmgr.PlanSchedule(schedule, time.Now())
+}
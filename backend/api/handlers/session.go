@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	agentmgr "github.com/coso/agentdemo/backend/agent"
 	"github.com/coso/agentdemo/backend/models"
 	"github.com/coso/agentdemo/backend/storage"
 	"github.com/gin-gonic/gin"
@@ -11,13 +17,19 @@ import (
 
 // SessionHandler 会话处理器
 type SessionHandler struct {
-	sessionStore *storage.SessionStore
+	sessionStore storage.SessionRepository
+	workspaces   *storage.WorkspaceStore
+	agentManager *agentmgr.Manager
+	queue        *agentmgr.MessageQueue
 }
 
 // NewSessionHandler 创建会话处理器
-func NewSessionHandler(sessionStore *storage.SessionStore) *SessionHandler {
+func NewSessionHandler(sessionStore storage.SessionRepository, workspaces *storage.WorkspaceStore, agentManager *agentmgr.Manager, queue *agentmgr.MessageQueue) *SessionHandler {
 	return &SessionHandler{
 		sessionStore: sessionStore,
+		workspaces:   workspaces,
+		agentManager: agentManager,
+		queue:        queue,
 	}
 }
 
@@ -25,7 +37,8 @@ func NewSessionHandler(sessionStore *storage.SessionStore) *SessionHandler {
 func (h *SessionHandler) CreateSession(c *gin.Context) {
 	var req struct {
 		Title     string `json:"title"`
-		AgentType string `json:"agent_type"` // "simple-chat" | "writing-assistant" | "code-analysis"
+		AgentType string `json:"agent_type"` // 已注册的模板 ID，见 GET /api/templates
+		models.GuideRefs
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -33,26 +46,39 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		return
 	}
 
+	// 校验引用的术语表与风格指南
+	if _, err := h.agentManager.LoadGuidance(req.GuideRefs); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// 生成会话 ID 和 Agent ID
 	sessionID := uuid.New().String()
 	agentID := "agt:" + uuid.New().String()
 
 	// 设置默认标题和 AgentType
-	title := req.Title
+	title := strings.TrimSpace(req.Title)
+	titleEdited := title != ""
 	if title == "" {
-		title = "新对话会话"
+		title = models.DefaultSessionTitle // 第一轮对话后自动生成标题
 	}
 
 	agentType := req.AgentType
 	if agentType == "" {
 		agentType = "simple-chat" // 默认为简单对话（支持 Skills 和 Commands）
 	}
+	if err := h.agentManager.Templates().CheckChat(agentType); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
 
 	session := &models.Session{
-		ID:        sessionID,
-		Title:     title,
-		AgentID:   agentID,
-		AgentType: agentType,
+		ID:          sessionID,
+		Title:       title,
+		TitleEdited: titleEdited,
+		AgentID:     agentID,
+		AgentType:   agentType,
+		GuideRefs:   req.GuideRefs,
 	}
 
 	if err := h.sessionStore.Create(session); err != nil {
@@ -76,26 +102,357 @@ func (h *SessionHandler) GetSession(c *gin.Context) {
 	c.JSON(http.StatusOK, session)
 }
 
-// ListSessions 列出所有会话
+// ListSessions 列出会话
+// 支持 ?tag= / ?agent_type= / ?archived=true|false|all（默认不含已归档会话）/ ?q= 全文搜索，
+// 分页参数 ?offset= / ?limit=，总数通过 X-Total-Count 响应头返回
+// GET /api/sessions
 func (h *SessionHandler) ListSessions(c *gin.Context) {
-	sessions, err := h.sessionStore.List()
+	filter := models.SessionFilter{
+		Tag:       c.Query("tag"),
+		AgentType: c.Query("agent_type"),
+		Query:     c.Query("q"),
+	}
+
+	switch archived := c.DefaultQuery("archived", "false"); archived {
+	case "all":
+	case "true", "false":
+		value := archived == "true"
+		filter.Archived = &value
+	default:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "archived must be true, false or all"})
+		return
+	}
+
+	var err error
+	if filter.Offset, err = parseNonNegative(c, "offset"); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if filter.Limit, err = parseNonNegative(c, "limit"); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sessions, total, err := h.sessionStore.Query(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	c.Header("X-Total-Count", strconv.Itoa(total))
 	c.JSON(http.StatusOK, sessions)
 }
 
-// DeleteSession 删除会话
+// UpdateSession 修改会话的标题、标签、置顶、归档状态和元数据
+// PATCH /api/sessions/:id
+func (h *SessionHandler) UpdateSession(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	var req models.UpdateSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	session, err := h.sessionStore.Get(sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "title must not be empty"})
+			return
+		}
+		session.Title = title
+		session.TitleEdited = true
+	}
+	if req.Tags != nil {
+		session.Tags = normalizeTags(*req.Tags)
+	}
+	if req.Pinned != nil {
+		session.Pinned = *req.Pinned
+	}
+	if req.Archived != nil {
+		session.Archived = *req.Archived
+	}
+	if req.Metadata != nil {
+		if session.Metadata == nil {
+			session.Metadata = make(map[string]interface{})
+		}
+		for key, value := range req.Metadata {
+			if value == nil {
+				delete(session.Metadata, key)
+			} else {
+				session.Metadata[key] = value
+			}
+		}
+	}
+
+	if err := h.sessionStore.Update(session); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// normalizeTags 去除空白和重复的标签
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// parseNonNegative 解析非负整数查询参数，缺省为 0
+func parseNonNegative(c *gin.Context, name string) (int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
+
+// DeleteSession 删除会话：关闭 Agent，删除 Agent 存储数据和工作区
+// ?archive=true 时改为归档到 .agentsdk/archive/
+// DELETE /api/sessions/:id
 func (h *SessionHandler) DeleteSession(c *gin.Context) {
 	sessionID := c.Param("id")
 
-	if err := h.sessionStore.Delete(sessionID); err != nil {
+	session, err := h.sessionStore.Get(sessionID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	archive := c.Query("archive") == "true"
+	archivePath, err := h.removeSession(session, archive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if archive {
+		c.JSON(http.StatusOK, gin.H{"message": "session archived", "archive": archivePath})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "session deleted"})
 }
 
+// BulkDeleteSessions 批量删除（或归档）会话
+// POST /api/sessions/bulk-delete
+func (h *SessionHandler) BulkDeleteSessions(c *gin.Context) {
+	var req models.BulkDeleteSessionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sessions := make([]*models.Session, 0, len(req.IDs))
+	failed := make(map[string]string)
+	for _, id := range req.IDs {
+		session, err := h.sessionStore.Get(id)
+		if err != nil {
+			failed[id] = err.Error()
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	resp := h.removeSessions(sessions, req.Archive)
+	for id, msg := range failed {
+		resp.Failed[id] = msg
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// PurgeSessions 清理 N 天内没有更新的会话
+// ?older_than_days=N 必填；?archive=true 归档而不是删除；?dry_run=true 只列出将被清理的会话
+// POST /api/admin/sessions/purge
+func (h *SessionHandler) PurgeSessions(c *gin.Context) {
+	days, err := strconv.Atoi(c.Query("older_than_days"))
+	if err != nil || days < 1 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "older_than_days must be a positive integer"})
+		return
+	}
+
+	all, err := h.sessionStore.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	stale := make([]*models.Session, 0)
+	for _, session := range all {
+		if session.UpdatedAt.Before(cutoff) {
+			stale = append(stale, session)
+		}
+	}
+
+	if c.Query("dry_run") == "true" {
+		ids := make([]string, 0, len(stale))
+		for _, session := range stale {
+			ids = append(ids, session.ID)
+		}
+		c.JSON(http.StatusOK, models.DeleteSessionsResponse{Deleted: ids, DryRun: true})
+		return
+	}
+
+	resp := h.removeSessions(stale, c.Query("archive") == "true")
+	log.Printf("[PurgeSessions] Purged %d sessions older than %d days (%d failed)", len(resp.Deleted), days, len(resp.Failed))
+	c.JSON(http.StatusOK, resp)
+}
+
+// removeSessions 依次删除会话，单个失败不影响其余会话
+func (h *SessionHandler) removeSessions(sessions []*models.Session, archive bool) models.DeleteSessionsResponse {
+	resp := models.DeleteSessionsResponse{
+		Deleted:  make([]string, 0, len(sessions)),
+		Failed:   make(map[string]string),
+		Archives: make(map[string]string),
+	}
+
+	for _, session := range sessions {
+		archivePath, err := h.removeSession(session, archive)
+		if err != nil {
+			resp.Failed[session.ID] = err.Error()
+			continue
+		}
+		resp.Deleted = append(resp.Deleted, session.ID)
+		if archive {
+			resp.Archives[session.ID] = archivePath
+		}
+	}
+	return resp
+}
+
+// removeSession 删除会话及其关联数据，archive 为 true 时归档并返回归档目录
+// 先清空消息队列并关闭 Agent 防止继续写入（否则排队的消息会重建 Agent 和工作区），
+// 最后才删除会话记录，中途失败时会话仍然可见、可以重试
+func (h *SessionHandler) removeSession(session *models.Session, archive bool) (string, error) {
+	h.queue.Clear(session.ID)
+	if err := h.agentManager.RemoveAgent(session.AgentID); err != nil {
+		return "", fmt.Errorf("remove agent: %w", err)
+	}
+
+	archivePath := ""
+	if archive {
+		path, err := storage.ArchiveSession(session, h.workspaces)
+		if err != nil {
+			return "", err
+		}
+		archivePath = path
+	} else {
+		if err := storage.PurgeAgentData(session.AgentID); err != nil {
+			return "", fmt.Errorf("purge agent data: %w", err)
+		}
+		if err := h.workspaces.RemoveAll(session.ID); err != nil {
+			return "", fmt.Errorf("remove workspace: %w", err)
+		}
+	}
+
+	if err := h.sessionStore.Delete(session.ID); err != nil {
+		return "", err
+	}
+	h.queue.Forget(session.ID)
+
+	log.Printf("[SessionHandler] Session %s removed (archive=%v)", session.ID, archive)
+	return archivePath, nil
+}
+
+// UpdateSessionGuides 为会话附加或移除术语表与风格指南
+// PUT /api/sessions/:id/guides
+func (h *SessionHandler) UpdateSessionGuides(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	var refs models.GuideRefs
+	if err := c.ShouldBindJSON(&refs); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	session, err := h.sessionStore.Get(sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// 与 WebSocket 切换模板一致：进行中或排队中的消息会用到当前 Agent，此时不能关闭它
+	if h.queue.Busy(session.ID) {
+		c.JSON(http.StatusConflict, models.ErrorResponse{Error: "cannot change guides while messages are being processed"})
+		return
+	}
+
+	if _, err := h.agentManager.LoadGuidance(refs); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	session.GuideRefs = refs
+	if err := h.sessionStore.Update(session); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// 关闭现有 Agent，下次对话时以新的规范重新创建（历史消息保留在存储中）
+	if err := h.agentManager.RemoveAgent(session.AgentID); err != nil {
+		log.Printf("[UpdateSessionGuides] Failed to remove agent %s: %v", session.AgentID, err)
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// SwitchTemplate 切换会话使用的模板，保留历史消息
+// Agent ID 不变，历史消息仍由 Agent Store 按 Agent ID 加载
+// PUT /api/sessions/:id/template
+func (h *SessionHandler) SwitchTemplate(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	var req models.SwitchTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	session, err := h.sessionStore.Get(sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if h.queue.Busy(session.ID) {
+		c.JSON(http.StatusConflict, models.ErrorResponse{Error: "cannot switch template while messages are being processed"})
+		return
+	}
+
+	previous := session.AgentType
+	if err := h.agentManager.SwitchSessionTemplate(session, req.AgentType); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if previous != session.AgentType {
+		log.Printf("[SwitchTemplate] Session %s: %s -> %s", sessionID, previous, session.AgentType)
+		if err := h.sessionStore.Update(session); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, session)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	agentmgr "github.com/coso/agentdemo/backend/agent"
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// 自定义模板 ID 规则：小写字母、数字和连字符
+var templateIDRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,63}$`)
+
+// TemplateHandler Agent 模板处理器
+type TemplateHandler struct {
+	templateStore *storage.TemplateStore
+	sessionStore  storage.SessionRepository
+	agentManager  *agentmgr.Manager
+}
+
+// NewTemplateHandler 创建 Agent 模板处理器
+func NewTemplateHandler(templateStore *storage.TemplateStore, sessionStore storage.SessionRepository, agentManager *agentmgr.Manager) *TemplateHandler {
+	return &TemplateHandler{
+		templateStore: templateStore,
+		sessionStore:  sessionStore,
+		agentManager:  agentManager,
+	}
+}
+
+// ListTemplates 列出所有已注册的模板（内置 + 自定义），包括说明、工具和适用场景
+// 可通过 ?suitability=chat|writing-tool|workflow 过滤
+// GET /api/templates
+func (h *TemplateHandler) ListTemplates(c *gin.Context) {
+	c.JSON(http.StatusOK, h.agentManager.Templates().List(c.Query("suitability")))
+}
+
+// GetTemplate 获取模板详情
+// GET /api/templates/:id
+func (h *TemplateHandler) GetTemplate(c *gin.Context) {
+	info, ok := h.agentManager.Templates().Info(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "template not found: " + c.Param("id")})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// CreateTemplate 创建自定义模板，并立即注册到运行时
+// POST /api/templates
+func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
+	var req models.TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !templateIDRegexp.MatchString(req.ID) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "id must be 2-64 characters of lowercase letters, digits and hyphens"})
+		return
+	}
+	if err := validateSuitability(req.Suitability); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if _, exists := h.agentManager.Templates().Get(req.ID); exists {
+		c.JSON(http.StatusConflict, models.ErrorResponse{Error: fmt.Sprintf("template already exists: %s", req.ID)})
+		return
+	}
+
+	template := templateFromRequest(req.ID, req)
+	if err := h.templateStore.Create(template); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.agentManager.Templates().RegisterCustom(template); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	log.Printf("[TemplateHandler] Custom template created: %s", template.ID)
+	c.JSON(http.StatusOK, template)
+}
+
+// UpdateTemplate 更新自定义模板（内置模板只读）
+// 已创建的 Agent 保持原有配置，新建或重建的 Agent 使用新模板
+// PUT /api/templates/:id
+func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
+	templateID := c.Param("id")
+	if h.agentManager.Templates().IsBuiltin(templateID) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "built-in templates are read-only"})
+		return
+	}
+
+	var req models.TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := validateSuitability(req.Suitability); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	template := templateFromRequest(templateID, req)
+	if err := h.templateStore.Update(template); err != nil {
+		c.JSON(statusForStoreError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.agentManager.Templates().RegisterCustom(template); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	log.Printf("[TemplateHandler] Custom template updated: %s", template.ID)
+	c.JSON(http.StatusOK, template)
+}
+
+// DeleteTemplate 删除自定义模板（内置模板只读，仍被会话使用的模板不可删除）
+// DELETE /api/templates/:id
+func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
+	templateID := c.Param("id")
+	if h.agentManager.Templates().IsBuiltin(templateID) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "built-in templates are read-only"})
+		return
+	}
+
+	sessions, err := h.sessionStore.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	for _, session := range sessions {
+		if session.AgentType == templateID {
+			c.JSON(http.StatusConflict, models.ErrorResponse{Error: fmt.Sprintf("template %s is used by session %s", templateID, session.ID)})
+			return
+		}
+	}
+
+	if err := h.templateStore.Delete(templateID); err != nil {
+		c.JSON(statusForStoreError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.agentManager.Templates().Unregister(templateID); err != nil {
+		log.Printf("[TemplateHandler] Failed to unregister template %s: %v", templateID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "template deleted"})
+}
+
+// validateSuitability 校验适用场景取值
+func validateSuitability(suitability []string) error {
+	for _, s := range suitability {
+		switch s {
+		case models.SuitabilityChat, models.SuitabilityWritingTool, models.SuitabilityWorkflow:
+		default:
+			return fmt.Errorf("invalid suitability %q, expected chat, writing-tool or workflow", s)
+		}
+	}
+	return nil
+}
+
+// templateFromRequest 由请求构建自定义模板
+func templateFromRequest(templateID string, req models.TemplateRequest) *models.CustomTemplate {
+	tools := req.Tools
+	if tools == nil {
+		tools = []string{}
+	}
+
+	return &models.CustomTemplate{
+		ID:           templateID,
+		Name:         req.Name,
+		Description:  req.Description,
+		SystemPrompt: req.SystemPrompt,
+		Tools:        tools,
+		Model:        req.Model,
+		Suitability:  req.Suitability,
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 代码占位符格式，与 text-translator 模板中的约定保持一致
+const codePlaceholderFormat = "[[CODE_%d]]"
+
+var (
+	// 围栏代码块（``` 或 ~~~），需要整体保护
+	fencedCodeRegexp = regexp.MustCompile("(?ms)^[ \t]*(```|~~~)[^\n]*\n.*?^[ \t]*(```|~~~)[ \t]*$")
+	// 行内代码
+	inlineCodeRegexp = regexp.MustCompile("`[^`\n]+`")
+)
+
+// protectCodeBlocks 将代码块替换为占位符，避免被模型翻译
+func protectCodeBlocks(text string) (string, []string) {
+	var blocks []string
+	replace := func(code string) string {
+		blocks = append(blocks, code)
+		return fmt.Sprintf(codePlaceholderFormat, len(blocks)-1)
+	}
+
+	text = fencedCodeRegexp.ReplaceAllStringFunc(text, replace)
+	text = inlineCodeRegexp.ReplaceAllStringFunc(text, replace)
+	return text, blocks
+}
+
+// restoreCodeBlocks 将占位符还原为原始代码
+func restoreCodeBlocks(text string, blocks []string) string {
+	for i := range blocks {
+		placeholder := fmt.Sprintf(codePlaceholderFormat, i)
+		if !strings.Contains(text, placeholder) {
+			log.Printf("[restoreCodeBlocks] Placeholder %s missing from translation", placeholder)
+			continue
+		}
+		text = strings.ReplaceAll(text, placeholder, blocks[i])
+	}
+	return text
+}
+
+// buildTranslatePrompt 构建翻译提示词
+func buildTranslatePrompt(text, targetLanguage, sourceLanguage string, glossary map[string]string) string {
+	var b strings.Builder
+
+	b.WriteString("翻译要求：\n")
+	b.WriteString("- 目标语言：" + targetLanguage + "\n")
+	if sourceLanguage != "" {
+		b.WriteString("- 源语言：" + sourceLanguage + "\n")
+	} else {
+		b.WriteString("- 源语言：自动识别\n")
+	}
+
+	if len(glossary) > 0 {
+		terms := make([]string, 0, len(glossary))
+		for term := range glossary {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+
+		b.WriteString("\n术语表（必须使用以下译法）：\n")
+		for _, term := range terms {
+			b.WriteString(fmt.Sprintf("- %s => %s\n", term, glossary[term]))
+		}
+	}
+
+	b.WriteString("\n待翻译文本：\n")
+	b.WriteString(text)
+	return b.String()
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	agentmgr "github.com/coso/agentdemo/backend/agent"
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultDeliveriesLimit = 50 // 投递日志默认返回的条数
+
+// WebhookHandler Webhook 订阅处理器
+type WebhookHandler struct {
+	store      *storage.WebhookStore
+	dispatcher *agentmgr.WebhookDispatcher
+}
+
+// NewWebhookHandler 创建 Webhook 订阅处理器
+func NewWebhookHandler(store *storage.WebhookStore, dispatcher *agentmgr.WebhookDispatcher) *WebhookHandler {
+	return &WebhookHandler{
+		store:      store,
+		dispatcher: dispatcher,
+	}
+}
+
+// CreateWebhook 创建 Webhook 订阅，未提供密钥时自动生成；响应中包含密钥（之后不再返回）
+// POST /api/webhooks
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := validateWebhook(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	webhook := &models.Webhook{
+		ID:          uuid.New().String(),
+		URL:         req.URL,
+		Events:      req.Events,
+		Secret:      req.Secret,
+		Description: req.Description,
+		Active:      req.Active == nil || *req.Active,
+	}
+	if webhook.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		webhook.Secret = secret
+	}
+	if err := h.store.Create(webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("[WebhookHandler] Webhook %s created for %v -> %s", webhook.ID, webhook.Events, webhook.URL)
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// ListWebhooks 列出 Webhook 订阅（不含密钥）
+// GET /api/webhooks
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	webhooks := h.store.List()
+	for _, w := range webhooks {
+		w.Secret = ""
+	}
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// GetWebhook 获取 Webhook 订阅（不含密钥）
+// GET /api/webhooks/:id
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	webhook, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	webhook.Secret = ""
+	c.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook 更新 Webhook 订阅，secret 留空时保持不变
+// PUT /api/webhooks/:id
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	webhook, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := validateWebhook(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	webhook.URL = req.URL
+	webhook.Events = req.Events
+	webhook.Description = req.Description
+	if req.Secret != "" {
+		webhook.Secret = req.Secret
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	if err := h.store.Update(webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	webhook.Secret = ""
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook 删除 Webhook 订阅，等待重试的投递不再继续（投递日志保留）
+// DELETE /api/webhooks/:id
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	if err := h.store.Delete(c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// PingWebhook 发送一次 ping 事件并返回投递结果（不重试）
+// POST /api/webhooks/:id/ping
+func (h *WebhookHandler) PingWebhook(c *gin.Context) {
+	delivery, err := h.dispatcher.Ping(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// ListDeliveries 投递日志（最新的在前），每条记录包含全部尝试的状态码、错误和耗时
+// ?webhook_id= 或路径中的 :id 按 Webhook 过滤，?status=pending|succeeded|failed 按状态过滤，?limit= 条数（默认 50）
+// GET /api/webhooks/deliveries，GET /api/webhooks/:id/deliveries
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	webhookID := c.Param("id")
+	if webhookID == "" {
+		webhookID = c.Query("webhook_id")
+	}
+	status := c.Query("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliverySucceeded, models.DeliveryFailed:
+	default:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: fmt.Sprintf("unknown status %q", status)})
+		return
+	}
+	limit, err := parseNonNegative(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if limit == 0 {
+		limit = defaultDeliveriesLimit
+	}
+
+	c.JSON(http.StatusOK, h.store.Deliveries(webhookID, status, limit))
+}
+
+// GetDelivery 获取一条投递记录（包含请求体）
+// GET /api/webhooks/deliveries/:deliveryId
+func (h *WebhookHandler) GetDelivery(c *gin.Context) {
+	delivery, err := h.store.Delivery(c.Param("deliveryId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// Redeliver 重新投递一条记录中的事件，返回新的投递记录
+// POST /api/webhooks/deliveries/:deliveryId/redeliver
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	delivery, err := h.dispatcher.Redeliver(c.Param("deliveryId"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, agentmgr.ErrWebhookInactive):
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// validateWebhook 检查地址和订阅的事件
+func validateWebhook(req models.WebhookRequest) error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	if len(req.Events) == 0 {
+		return fmt.Errorf("events must not be empty")
+	}
+	for _, event := range req.Events {
+		if event == "*" {
+			continue
+		}
+		known := false
+		for _, e := range models.WebhookEvents {
+			if e == event {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q, supported: %v", event, models.WebhookEvents)
+		}
+	}
+	return nil
+}
+
+// newWebhookSecret 生成随机的签名密钥
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
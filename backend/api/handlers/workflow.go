@@ -4,24 +4,30 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"strings"
 
 	agentmgr "github.com/coso/agentdemo/backend/agent"
 	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/wordflowlab/agentsdk/pkg/types"
 )
 
 // WorkflowHandler 工作流处理器
 type WorkflowHandler struct {
 	orchestrator *agentmgr.WorkflowOrchestrator
+	agentManager *agentmgr.Manager
+	presetStore  *storage.PresetStore
+	presets      *agentmgr.PresetLibrary
 }
 
 // NewWorkflowHandler 创建工作流处理器
-func NewWorkflowHandler(orchestrator *agentmgr.WorkflowOrchestrator) *WorkflowHandler {
+func NewWorkflowHandler(orchestrator *agentmgr.WorkflowOrchestrator, agentManager *agentmgr.Manager, presetStore *storage.PresetStore, presets *agentmgr.PresetLibrary) *WorkflowHandler {
 	return &WorkflowHandler{
 		orchestrator: orchestrator,
+		agentManager: agentManager,
+		presetStore:  presetStore,
+		presets:      presets,
 	}
 }
 
@@ -36,86 +42,81 @@ func (h *WorkflowHandler) StartWorkflow(c *gin.Context) {
 		return
 	}
 
-	log.Printf("[WorkflowHandler] Request received - Topic: %s, Requirements: %s", req.Topic, req.Requirements)
+	log.Printf("[WorkflowHandler] Request received - Topic: %s, Requirements: %s, Preset: %s", req.Topic, req.Requirements, req.Preset)
 
-	// 生成工作流 ID
-	workflowID := uuid.New().String()
-	log.Printf("[WorkflowHandler] Generated workflow ID: %s", workflowID)
-
-	// 获取模型配置
-	providerType := os.Getenv("PROVIDER")
-	if providerType == "" {
-		providerType = "anthropic" // 默认使用 anthropic
-	}
-
-	// 根据 Provider 类型优先选择对应的 API Key
-	var apiKey string
-	switch providerType {
-	case "anthropic":
-		apiKey = os.Getenv("ANTHROPIC_API_KEY")
-	case "glm", "zhipu", "bigmodel":
-		apiKey = os.Getenv("GLM_API_KEY")
-	case "deepseek":
-		apiKey = os.Getenv("DEEPSEEK_API_KEY")
-	default:
-		// 默认尝试所有 API Key
-		apiKey = os.Getenv("ANTHROPIC_API_KEY")
-		if apiKey == "" {
-			apiKey = os.Getenv("GLM_API_KEY")
+	// 使用预设时渲染主题和要求
+	var preset *models.WorkflowPreset
+	var presetStart *agentmgr.PresetStart
+	if req.Preset != "" {
+		var err error
+		preset, err = h.presetStore.Get(req.Preset)
+		if err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+			return
 		}
-		if apiKey == "" {
-			apiKey = os.Getenv("DEEPSEEK_API_KEY")
+		presetStart, err = h.presets.Render(preset, req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
 		}
+		req.Topic = presetStart.Topic
+		req.Requirements = presetStart.Requirements
+		req.Model = presetStart.Model
+		req.GuideRefs = presetStart.GuideRefs
+	} else if len(req.Params) > 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "params require a preset"})
+		return
 	}
-	if apiKey == "" {
-		apiKey = "sk-default"
+	if strings.TrimSpace(req.Topic) == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "topic is required"})
+		return
 	}
 
-	model := os.Getenv("MODEL")
-	if model == "" {
-		if providerType == "glm" {
-			model = "glm-4" // GLM 默认模型
-		} else if providerType == "deepseek" {
-			model = "deepseek-chat" // Deepseek 默认模型
-		} else {
-			model = "claude-3-haiku-20240307" // Anthropic 默认模型
-		}
+	// 加载术语表与风格指南
+	guidance, err := h.agentManager.LoadGuidance(req.GuideRefs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
 	}
 
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		if providerType == "anthropic" {
-			baseURL = "http://yunwu.ai" // Anthropic 使用 yunwu.ai 中转
-		} else if providerType == "glm" {
-			baseURL = "https://open.bigmodel.cn/api/paas/v4" // GLM 默认地址
-		} else if providerType == "deepseek" {
-			baseURL = "https://api.deepseek.com" // Deepseek 默认地址
-		}
-	}
+	// 生成工作流 ID
+	workflowID := uuid.New().String()
+	log.Printf("[WorkflowHandler] Generated workflow ID: %s", workflowID)
 
-	log.Printf("[WorkflowHandler] Model config - Provider: %s, Model: %s, APIKey: %s...", providerType, model, apiKey[:min(10, len(apiKey))])
+	// 获取模型配置
+	modelConfig := agentmgr.WorkflowModelConfig(req.Model)
+	log.Printf("[WorkflowHandler] Model config - Provider: %s, Model: %s, APIKey: %s...", modelConfig.Provider, modelConfig.Model, modelConfig.APIKey[:min(10, len(modelConfig.APIKey))])
 
-	modelConfig := &types.ModelConfig{
-		Provider: providerType,
-		Model:    model,
-		APIKey:   apiKey,
-		BaseURL:  baseURL,
+	// 记录预设的使用（在启动前登记，确保能收到工作流结束事件）
+	if preset != nil {
+		if err := h.presets.RecordStart(preset.ID, workflowID, presetStart); err != nil {
+			log.Printf("[WorkflowHandler] Failed to record run of preset %s: %v", preset.ID, err)
+		}
 	}
 
 	// 启动工作流
 	log.Printf("[WorkflowHandler] Calling orchestrator.StartWorkflow for workflow: %s", workflowID)
-	err := h.orchestrator.StartWorkflow(c.Request.Context(), workflowID, req.Topic, req.Requirements, modelConfig)
+	err = h.orchestrator.StartWorkflow(c.Request.Context(), workflowID, req.Topic, req.Requirements, modelConfig, guidance)
 	if err != nil {
 		log.Printf("[WorkflowHandler] StartWorkflow error: %v", err)
+		if preset != nil {
+			h.presets.RecordFailure(workflowID, err)
+		}
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
 	log.Printf("[WorkflowHandler] Workflow started successfully: %s", workflowID)
-	c.JSON(http.StatusOK, models.WorkflowStartResponse{
+	resp := models.WorkflowStartResponse{
 		WorkflowID: workflowID,
 		Status:     "started",
-	})
+	}
+	if preset != nil {
+		resp.Preset = preset.ID
+		resp.Topic = req.Topic
+		resp.Requirements = req.Requirements
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func min(a, b int) int {
@@ -138,6 +139,9 @@ func (h *WorkflowHandler) GetWorkflowStatus(c *gin.Context) {
 	// 转换为响应格式
 	response := models.WorkflowStatusResponse{
 		WorkflowID:       status.WorkflowID,
+		Topic:            status.Topic,
+		Requirements:     status.Requirements,
+		Model:            status.Model,
 		Stage:            string(status.Stage),
 		Progress:         status.Progress,
 		StartTime:        status.StartTime,
@@ -146,19 +150,27 @@ func (h *WorkflowHandler) GetWorkflowStatus(c *gin.Context) {
 		WriterStatus:     status.WriterStatus,
 		EditorStatus:     status.EditorStatus,
 		Error:            status.Error,
+		GuideViolations:  status.GuideViolations,
+		PendingApprovals: status.PendingApprovals,
 	}
 
-	// 转换事件
-	events := make([]models.WorkflowEventData, len(status.Events))
-	for i, evt := range status.Events {
-		events[i] = models.WorkflowEventData{
+	response.Events = workflowEvents(status.Events)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// workflowEvents 转换工作流事件为响应格式
+func workflowEvents(events []agentmgr.WorkflowEvent) []models.WorkflowEventData {
+	result := make([]models.WorkflowEventData, len(events))
+	for i, evt := range events {
+		result[i] = models.WorkflowEventData{
 			Time:      evt.Time,
 			Stage:     string(evt.Stage),
 			EventType: evt.EventType,
 			Message:   evt.Message,
 		}
 		if evt.ToolCall != nil {
-			events[i].ToolCall = &models.ToolCallData{
+			result[i].ToolCall = &models.ToolCallData{
 				Name:   evt.ToolCall.Name,
 				Input:  evt.ToolCall.Input,
 				Output: evt.ToolCall.Output,
@@ -166,9 +178,7 @@ func (h *WorkflowHandler) GetWorkflowStatus(c *gin.Context) {
 			}
 		}
 	}
-	response.Events = events
-
-	c.JSON(http.StatusOK, response)
+	return result
 }
 
 // GetWorkflowArtifacts 获取工作流产物
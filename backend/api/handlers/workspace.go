@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/coso/agentdemo/backend/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// WorkspaceHandler 会话工作区处理器
+type WorkspaceHandler struct {
+	sessionStore storage.SessionRepository
+	workspaces   *storage.WorkspaceStore
+}
+
+// NewWorkspaceHandler 创建会话工作区处理器
+func NewWorkspaceHandler(sessionStore storage.SessionRepository, workspaces *storage.WorkspaceStore) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		sessionStore: sessionStore,
+		workspaces:   workspaces,
+	}
+}
+
+// ListFiles 列出会话工作区中的文件及用量
+// GET /api/sessions/:id/files
+func (h *WorkspaceHandler) ListFiles(c *gin.Context) {
+	sessionID, ok := h.checkSession(c)
+	if !ok {
+		return
+	}
+
+	listing, err := h.workspaces.List(sessionID)
+	if err != nil {
+		c.JSON(statusForWorkspaceError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, listing)
+}
+
+// DownloadFile 下载工作区文件
+// GET /api/sessions/:id/files/*path
+func (h *WorkspaceHandler) DownloadFile(c *gin.Context) {
+	sessionID, ok := h.checkSession(c)
+	if !ok {
+		return
+	}
+
+	relPath := strings.TrimPrefix(c.Param("path"), "/")
+	full, err := h.workspaces.Resolve(sessionID, relPath)
+	if err != nil {
+		c.JSON(statusForWorkspaceError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	info, err := os.Stat(full)
+	if err != nil || !info.Mode().IsRegular() {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "file not found: " + relPath})
+		return
+	}
+
+	c.FileAttachment(full, filepath.Base(full))
+}
+
+// UploadFile 上传文件到工作区（multipart 表单字段 file；path 可选，缺省为原文件名）
+// POST /api/sessions/:id/files
+func (h *WorkspaceHandler) UploadFile(c *gin.Context) {
+	sessionID, ok := h.checkSession(c)
+	if !ok {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	relPath := c.PostForm("path")
+	if relPath == "" {
+		relPath = filepath.Base(fileHeader.Filename)
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	defer src.Close()
+
+	file, err := h.workspaces.Write(sessionID, relPath, src, fileHeader.Size)
+	if err != nil {
+		c.JSON(statusForWorkspaceError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, file)
+}
+
+// DeleteFile 删除工作区文件或目录
+// DELETE /api/sessions/:id/files/*path
+func (h *WorkspaceHandler) DeleteFile(c *gin.Context) {
+	sessionID, ok := h.checkSession(c)
+	if !ok {
+		return
+	}
+
+	if err := h.workspaces.Remove(sessionID, strings.TrimPrefix(c.Param("path"), "/")); err != nil {
+		c.JSON(statusForWorkspaceError(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "file deleted"})
+}
+
+// checkSession 检查会话是否存在
+func (h *WorkspaceHandler) checkSession(c *gin.Context) (string, bool) {
+	sessionID := c.Param("id")
+	if _, err := h.sessionStore.Get(sessionID); err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "session not found"})
+		return "", false
+	}
+	return sessionID, true
+}
+
+// statusForWorkspaceError 将工作区错误映射为 HTTP 状态码
+func statusForWorkspaceError(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrInvalidPath):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -29,7 +29,13 @@ func (h *WritingHandler) PolishText(c *gin.Context) {
 		return
 	}
 
-	result, err := h.processText(c.Request.Context(), "text-polisher", req.Text, "")
+	guidance, err := h.agentManager.LoadGuidance(req.GuideRefs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	result, err := h.processText(c.Request.Context(), "text-polisher", req.Text, guidance)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
 		return
@@ -38,6 +44,7 @@ func (h *WritingHandler) PolishText(c *gin.Context) {
 	c.JSON(http.StatusOK, models.WritingToolResponse{
 		OriginalText:  req.Text,
 		ProcessedText: result,
+		Violations:    guidance.Check(result),
 		Action:        "polish",
 	})
 }
@@ -50,13 +57,19 @@ func (h *WritingHandler) RewriteText(c *gin.Context) {
 		return
 	}
 
+	guidance, err := h.agentManager.LoadGuidance(req.GuideRefs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// 构建提示词
 	prompt := req.Text
 	if req.Style != "" {
 		prompt = "请将以下文本改写为" + req.Style + "风格：\n\n" + req.Text
 	}
 
-	result, err := h.processText(c.Request.Context(), "text-rewriter", prompt, "")
+	result, err := h.processText(c.Request.Context(), "text-rewriter", prompt, guidance)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
 		return
@@ -65,6 +78,7 @@ func (h *WritingHandler) RewriteText(c *gin.Context) {
 	c.JSON(http.StatusOK, models.WritingToolResponse{
 		OriginalText:  req.Text,
 		ProcessedText: result,
+		Violations:    guidance.Check(result),
 		Action:        "rewrite",
 	})
 }
@@ -77,7 +91,13 @@ func (h *WritingHandler) ExpandText(c *gin.Context) {
 		return
 	}
 
-	result, err := h.processText(c.Request.Context(), "text-expander", req.Text, "")
+	guidance, err := h.agentManager.LoadGuidance(req.GuideRefs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	result, err := h.processText(c.Request.Context(), "text-expander", req.Text, guidance)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
 		return
@@ -86,6 +106,7 @@ func (h *WritingHandler) ExpandText(c *gin.Context) {
 	c.JSON(http.StatusOK, models.WritingToolResponse{
 		OriginalText:  req.Text,
 		ProcessedText: result,
+		Violations:    guidance.Check(result),
 		Action:        "expand",
 	})
 }
@@ -98,7 +119,13 @@ func (h *WritingHandler) SummarizeText(c *gin.Context) {
 		return
 	}
 
-	result, err := h.processText(c.Request.Context(), "text-summarizer", req.Text, "")
+	guidance, err := h.agentManager.LoadGuidance(req.GuideRefs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	result, err := h.processText(c.Request.Context(), "text-summarizer", req.Text, guidance)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
 		return
@@ -107,6 +134,7 @@ func (h *WritingHandler) SummarizeText(c *gin.Context) {
 	c.JSON(http.StatusOK, models.WritingToolResponse{
 		OriginalText:  req.Text,
 		ProcessedText: result,
+		Violations:    guidance.Check(result),
 		Action:        "summarize",
 	})
 }
@@ -119,33 +147,51 @@ func (h *WritingHandler) TranslateText(c *gin.Context) {
 		return
 	}
 
+	guidance, err := h.agentManager.LoadGuidance(req.GuideRefs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// 默认翻译为英文
 	language := req.Language
 	if language == "" {
 		language = "英文"
 	}
 
-	result, err := h.processText(c.Request.Context(), "text-translator", req.Text, language)
+	// 保护代码块，翻译完成后原样还原
+	text, codeBlocks := protectCodeBlocks(req.Text)
+	prompt := buildTranslatePrompt(text, language, req.SourceLanguage, req.Glossary)
+
+	result, err := h.processText(c.Request.Context(), "text-translator", prompt, guidance)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
 		return
 	}
+	result = restoreCodeBlocks(result, codeBlocks)
 
 	c.JSON(http.StatusOK, models.WritingToolResponse{
 		OriginalText:  req.Text,
 		ProcessedText: result,
+		Violations:    guidance.Check(result),
 		Action:        "translate",
 	})
 }
 
 // processText 处理文本（通用方法）
-func (h *WritingHandler) processText(ctx context.Context, templateID string, text string, extraParam string) (string, error) {
+func (h *WritingHandler) processText(ctx context.Context, templateID string, text string, guidance *agentmgr.Guidance) (string, error) {
+	// 注入术语表与风格指南
+	templateID, err := h.agentManager.Templates().WithGuidance(templateID, guidance)
+	if err != nil {
+		return "", err
+	}
+
 	// 创建临时 Agent
-	ag, err := h.agentManager.CreateTemporaryAgent(ctx, templateID)
+	ag, release, err := h.agentManager.CreateTemporaryAgent(ctx, templateID, "")
 	if err != nil {
 		return "", err
 	}
-	defer ag.Close()
+	defer release()
 
 	// 发送消息并等待结果
 	result, err := ag.Chat(ctx, text)
@@ -155,4 +201,3 @@ func (h *WritingHandler) processText(ctx context.Context, templateID string, tex
 
 	return result.Text, nil
 }
-
@@ -12,27 +12,51 @@ import (
 // SetupRoutes 设置路由
 func SetupRoutes(
 	router *gin.Engine,
-	sessionStore *storage.SessionStore,
+	sessionStore storage.SessionRepository,
+	history *storage.HistoryStore,
+	workspaces *storage.WorkspaceStore,
+	guideStore *storage.GuideStore,
+	templateStore *storage.TemplateStore,
+	approvalPolicyStore *storage.ApprovalPolicyStore,
+	webhookStore *storage.WebhookStore,
+	scheduleStore *storage.ScheduleStore,
+	presetStore *storage.PresetStore,
 	agentManager *agentmgr.Manager,
+	titles *agentmgr.TitleGenerator,
+	queue *agentmgr.MessageQueue,
 	workflowOrchestrator *agentmgr.WorkflowOrchestrator,
+	webhooks *agentmgr.WebhookDispatcher,
+	scheduler *agentmgr.Scheduler,
+	presets *agentmgr.PresetLibrary,
 ) {
 	// CORS 配置
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:3000"}, // Vite 默认端口
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", handlers.OpenAISessionHeader},
+		ExposeHeaders:    []string{"Content-Length", "X-Total-Count", handlers.OpenAISessionHeader},
 		AllowCredentials: true,
 	}))
 
 	// 创建处理器
-	sessionHandler := handlers.NewSessionHandler(sessionStore)
-	messageHandler := handlers.NewMessageHandler(sessionStore, agentManager)
+	sessionHandler := handlers.NewSessionHandler(sessionStore, workspaces, agentManager, queue)
+	messageHandler := handlers.NewMessageHandler(sessionStore, history, agentManager, queue)
 	writingHandler := handlers.NewWritingHandler(agentManager)
-	workflowHandler := handlers.NewWorkflowHandler(workflowOrchestrator)
+	workflowHandler := handlers.NewWorkflowHandler(workflowOrchestrator, agentManager, presetStore, presets)
+	branchHandler := handlers.NewBranchHandler(sessionStore, history, agentManager, queue)
+	exportHandler := handlers.NewExportHandler(sessionStore, history, agentManager, workflowOrchestrator)
+	importHandler := handlers.NewImportHandler(sessionStore, history, agentManager)
+	workspaceHandler := handlers.NewWorkspaceHandler(sessionStore, workspaces)
+	guideHandler := handlers.NewGuideHandler(guideStore)
+	templateHandler := handlers.NewTemplateHandler(templateStore, sessionStore, agentManager)
+	approvalHandler := handlers.NewApprovalHandler(approvalPolicyStore, sessionStore, agentManager)
+	webhookHandler := handlers.NewWebhookHandler(webhookStore, webhooks)
+	scheduleHandler := handlers.NewScheduleHandler(scheduleStore, scheduler)
+	presetHandler := handlers.NewPresetHandler(presetStore, presets)
 	skillsHandler := handlers.NewSkillsHandler("./skills-package")
 	middlewareHandler := handlers.NewMiddlewareHandler(agentManager)
-	wsHandler := ws.NewHandler(sessionStore, agentManager)
+	openAIHandler := handlers.NewOpenAIHandler(sessionStore, agentManager, queue)
+	wsHandler := ws.NewHandler(sessionStore, history, agentManager, titles, queue)
 
 	// API 路由组
 	api := router.Group("/api")
@@ -43,11 +67,36 @@ func SetupRoutes(
 			sessions.POST("", sessionHandler.CreateSession)
 			sessions.GET("", sessionHandler.ListSessions)
 			sessions.GET("/:id", sessionHandler.GetSession)
+			sessions.PATCH("/:id", sessionHandler.UpdateSession)
 			sessions.DELETE("/:id", sessionHandler.DeleteSession)
+			sessions.POST("/bulk-delete", sessionHandler.BulkDeleteSessions)
+			sessions.POST("/import", importHandler.ImportSession)
+			sessions.PUT("/:id/guides", sessionHandler.UpdateSessionGuides)
+			sessions.PUT("/:id/template", sessionHandler.SwitchTemplate)
 
 			// 消息相关
 			sessions.POST("/:id/chat", messageHandler.SendMessage)
 			sessions.GET("/:id/messages", messageHandler.GetMessages)
+			sessions.POST("/:id/stop", messageHandler.StopTurn)
+			sessions.GET("/:id/queue", messageHandler.GetQueue)
+			sessions.DELETE("/:id/queue/:itemId", messageHandler.CancelQueued)
+
+			// 编辑历史消息与分支
+			sessions.POST("/:id/messages/:messageId/edit", branchHandler.EditMessage)
+			sessions.GET("/:id/branches", branchHandler.ListBranches)
+			sessions.POST("/:id/branches/:branchId/checkout", branchHandler.CheckoutBranch)
+			sessions.POST("/:id/regenerate", branchHandler.Regenerate)
+			sessions.GET("/:id/variants", branchHandler.ListVariants)
+			sessions.POST("/:id/fork", branchHandler.ForkSession)
+
+			// 导出
+			sessions.GET("/:id/export", exportHandler.ExportSession)
+
+			// 会话工作区
+			sessions.GET("/:id/files", workspaceHandler.ListFiles)
+			sessions.POST("/:id/files", workspaceHandler.UploadFile)
+			sessions.GET("/:id/files/*path", workspaceHandler.DownloadFile)
+			sessions.DELETE("/:id/files/*path", workspaceHandler.DeleteFile)
 		}
 
 		// 写作工具
@@ -60,12 +109,94 @@ func SetupRoutes(
 			writing.POST("/translate", writingHandler.TranslateText)
 		}
 
+		// Agent 模板（内置模板只读，自定义模板可增删改）
+		templates := api.Group("/templates")
+		{
+			templates.GET("", templateHandler.ListTemplates)
+			templates.GET("/:id", templateHandler.GetTemplate)
+			templates.POST("", templateHandler.CreateTemplate)
+			templates.PUT("/:id", templateHandler.UpdateTemplate)
+			templates.DELETE("/:id", templateHandler.DeleteTemplate)
+		}
+
+		// 术语表与风格指南
+		glossaries := api.Group("/glossaries")
+		{
+			glossaries.POST("", guideHandler.CreateGlossary)
+			glossaries.GET("", guideHandler.ListGlossaries)
+			glossaries.GET("/:id", guideHandler.GetGlossary)
+			glossaries.GET("/:id/versions", guideHandler.ListGlossaryVersions)
+			glossaries.PUT("/:id", guideHandler.UpdateGlossary)
+			glossaries.DELETE("/:id", guideHandler.DeleteGlossary)
+		}
+
+		styleGuides := api.Group("/style-guides")
+		{
+			styleGuides.POST("", guideHandler.CreateStyleGuide)
+			styleGuides.GET("", guideHandler.ListStyleGuides)
+			styleGuides.GET("/:id", guideHandler.GetStyleGuide)
+			styleGuides.GET("/:id/versions", guideHandler.ListStyleGuideVersions)
+			styleGuides.PUT("/:id", guideHandler.UpdateStyleGuide)
+			styleGuides.DELETE("/:id", guideHandler.DeleteStyleGuide)
+		}
+
+		// 工具调用审批
+		approvals := api.Group("/approvals")
+		{
+			approvals.GET("/policy", approvalHandler.GetPolicy)
+			approvals.PUT("/policy", approvalHandler.UpdatePolicy)
+			approvals.GET("", approvalHandler.ListPending)
+			approvals.POST("/:id", approvalHandler.Decide)
+		}
+
 		// 工作流协作（新功能）
 		workflow := api.Group("/workflow")
 		{
 			workflow.POST("/start", workflowHandler.StartWorkflow)
 			workflow.GET("/:id/status", workflowHandler.GetWorkflowStatus)
 			workflow.GET("/:id/artifacts", workflowHandler.GetWorkflowArtifacts)
+			workflow.GET("/:id/export", exportHandler.ExportWorkflow)
+
+			// 工作流预设
+			workflow.POST("/presets", presetHandler.CreatePreset)
+			workflow.GET("/presets", presetHandler.ListPresets)
+			workflow.GET("/presets/:id", presetHandler.GetPreset)
+			workflow.PUT("/presets/:id", presetHandler.UpdatePreset)
+			workflow.DELETE("/presets/:id", presetHandler.DeletePreset)
+			workflow.POST("/presets/:id/render", presetHandler.RenderPreset)
+		}
+
+		// 定时工作流
+		schedules := api.Group("/schedules")
+		{
+			schedules.POST("", scheduleHandler.CreateSchedule)
+			schedules.GET("", scheduleHandler.ListSchedules)
+			schedules.GET("/:id", scheduleHandler.GetSchedule)
+			schedules.PUT("/:id", scheduleHandler.UpdateSchedule)
+			schedules.DELETE("/:id", scheduleHandler.DeleteSchedule)
+			schedules.POST("/:id/run", scheduleHandler.RunSchedule)
+			schedules.GET("/:id/runs", scheduleHandler.ListScheduleRuns)
+		}
+
+		// Webhook 订阅与投递日志
+		webhookRoutes := api.Group("/webhooks")
+		{
+			webhookRoutes.POST("", webhookHandler.CreateWebhook)
+			webhookRoutes.GET("", webhookHandler.ListWebhooks)
+			webhookRoutes.GET("/deliveries", webhookHandler.ListDeliveries)
+			webhookRoutes.GET("/deliveries/:deliveryId", webhookHandler.GetDelivery)
+			webhookRoutes.POST("/deliveries/:deliveryId/redeliver", webhookHandler.Redeliver)
+			webhookRoutes.GET("/:id", webhookHandler.GetWebhook)
+			webhookRoutes.PUT("/:id", webhookHandler.UpdateWebhook)
+			webhookRoutes.DELETE("/:id", webhookHandler.DeleteWebhook)
+			webhookRoutes.POST("/:id/ping", webhookHandler.PingWebhook)
+			webhookRoutes.GET("/:id/deliveries", webhookHandler.ListDeliveries)
+		}
+
+		// 管理操作
+		admin := api.Group("/admin")
+		{
+			admin.POST("/sessions/purge", sessionHandler.PurgeSessions)
 		}
 
 		// Skills 管理
@@ -90,6 +221,14 @@ func SetupRoutes(
 		}
 	}
 
+	// OpenAI 兼容接口（model 为模板 ID，可附加 "/模型"）
+	v1 := router.Group("/v1")
+	{
+		v1.GET("/models", openAIHandler.ListModels)
+		v1.GET("/models/:model", openAIHandler.GetModel)
+		v1.POST("/chat/completions", openAIHandler.ChatCompletions)
+	}
+
 	// WebSocket 路由
 	router.GET("/ws/:sessionId", wsHandler.HandleWebSocket)
 	router.GET("/ping", wsHandler.PingHandler)
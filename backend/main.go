@@ -31,34 +31,101 @@ func main() {
 	}
 	log.Printf("Using Model: %s", model)
 
-	// 创建会话存储
-	sessionStore, err := storage.NewSessionStore()
+	// 创建会话存储（SESSION_STORE=json|sqlite|postgres，默认 json）
+	sessionStore, err := storage.OpenSessionRepository(os.Getenv("SESSION_STORE"), os.Getenv("SESSION_STORE_DSN"))
 	if err != nil {
 		log.Fatalf("Failed to create session store: %v", err)
 	}
+	defer sessionStore.Close()
+
+	// 创建术语表与风格指南存储
+	guideStore, err := storage.NewGuideStore()
+	if err != nil {
+		log.Fatalf("Failed to create guide store: %v", err)
+	}
+
+	// 创建自定义模板存储
+	templateStore, err := storage.NewTemplateStore()
+	if err != nil {
+		log.Fatalf("Failed to create template store: %v", err)
+	}
+
+	// 创建会话工作区（每个会话独立目录）
+	workspaces, err := storage.NewWorkspaceStore("./workspace")
+	if err != nil {
+		log.Fatalf("Failed to create workspace store: %v", err)
+	}
+
+	// 创建工具审批策略存储和审批管理器
+	approvalPolicyStore, err := storage.NewApprovalPolicyStore(agent.ValidatePolicy)
+	if err != nil {
+		log.Fatalf("Failed to create approval policy store: %v", err)
+	}
+	approvals := agent.NewApprovalManager(approvalPolicyStore)
 
 	// 创建 Agent 管理器（用于简单对话）
-	agentManager, err := agent.NewManager()
+	agentManager, err := agent.NewManager(guideStore, templateStore, approvals, workspaces)
 	if err != nil {
 		log.Fatalf("Failed to create agent manager: %v", err)
 	}
 	defer agentManager.Close()
 
+	// 创建消息历史（记录每条消息的 ID 和时间戳）
+	history := storage.NewHistoryStore()
+	agent.RecordHistory(agentManager, history)
+
+	// 创建会话标题生成器（第一轮对话后自动生成标题）
+	titles := agent.NewTitleGenerator(agentManager, sessionStore)
+
+	// 创建会话消息队列（同一会话的消息逐条处理）
+	queue, err := agent.NewMessageQueue(agentManager, sessionStore, history)
+	if err != nil {
+		log.Fatalf("Failed to create message queue: %v", err)
+	}
+
 	// 创建 Pool 管理器（用于工作流协作）
-	poolManager, err := agent.NewPoolManager(agentManager.GetDependencies())
+	poolManager, err := agent.NewPoolManager(agentManager.GetDependencies(), approvals)
 	if err != nil {
 		log.Fatalf("Failed to create pool manager: %v", err)
 	}
 	defer poolManager.Shutdown()
 
 	// 创建工作流编排器
-	workflowOrchestrator := agent.NewWorkflowOrchestrator(poolManager)
+	workflowOrchestrator := agent.NewWorkflowOrchestrator(poolManager, agentManager.Templates(), approvals)
+
+	// 创建 Webhook 投递器（工作流生命周期和会话对话完成事件）
+	webhookStore, err := storage.NewWebhookStore()
+	if err != nil {
+		log.Fatalf("Failed to create webhook store: %v", err)
+	}
+	webhooks, err := agent.NewWebhookDispatcher(webhookStore)
+	if err != nil {
+		log.Fatalf("Failed to create webhook dispatcher: %v", err)
+	}
+	webhooks.WatchWorkflows(workflowOrchestrator)
+	webhooks.WatchSessions(agentManager, sessionStore, history)
+
+	// 创建定时工作流调度器
+	scheduleStore, err := storage.NewScheduleStore()
+	if err != nil {
+		log.Fatalf("Failed to create schedule store: %v", err)
+	}
+	scheduler := agent.NewScheduler(scheduleStore, workflowOrchestrator, agentManager)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	// 创建工作流预设库
+	presetStore, err := storage.NewPresetStore()
+	if err != nil {
+		log.Fatalf("Failed to create preset store: %v", err)
+	}
+	presets := agent.NewPresetLibrary(presetStore, workflowOrchestrator)
 
 	// 创建 Gin 路由
 	router := gin.Default()
 
 	// 设置路由
-	api.SetupRoutes(router, sessionStore, agentManager, workflowOrchestrator)
+	api.SetupRoutes(router, sessionStore, history, workspaces, guideStore, templateStore, approvalPolicyStore, webhookStore, scheduleStore, presetStore, agentManager, titles, queue, workflowOrchestrator, webhooks, scheduler, presets)
 
 	// 启动服务器
 	port := os.Getenv("PORT")
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// 审批策略动作
+const (
+	ApprovalActionAllow   = "allow"            // 自动放行
+	ApprovalActionRequire = "require_approval" // 需要人工审批
+	ApprovalActionDeny    = "deny"             // 直接拒绝
+)
+
+// 审批规则的适用范围
+const (
+	ApprovalContextSession  = "session"  // 会话 Agent（包括 OpenAI 兼容接口的临时 Agent）
+	ApprovalContextWorkflow = "workflow" // 工作流 Agent（包括定时任务启动的工作流）
+)
+
+// 审批请求状态
+const (
+	ApprovalStatusPending = "pending"
+	ApprovalStatusAllowed = "allowed"
+	ApprovalStatusDenied  = "denied"
+	ApprovalStatusTimeout = "timeout"
+)
+
+// ApprovalRule 审批规则
+type ApprovalRule struct {
+	Tool       string `json:"tool"`                  // 工具名称，"*" 匹配所有工具
+	ArgPattern string `json:"arg_pattern,omitempty"` // 正则表达式，匹配 JSON 序列化后的工具参数；留空匹配任意参数
+	Action     string `json:"action"`                // "allow" | "require_approval" | "deny"
+	Context    string `json:"context,omitempty"`     // "session" | "workflow"，留空适用于所有 Agent
+}
+
+// ApprovalPolicy 工具审批策略：按顺序匹配规则，第一条命中的规则生效
+type ApprovalPolicy struct {
+	Rules          []ApprovalRule `json:"rules"`
+	DefaultAction  string         `json:"default_action"`  // 没有规则命中时的动作
+	TimeoutSeconds int            `json:"timeout_seconds"` // 等待审批的超时时间，超时视为拒绝
+}
+
+// ApprovalRequest 待审批的工具调用
+type ApprovalRequest struct {
+	ID         string     `json:"id"`
+	AgentID    string     `json:"agent_id"`
+	WorkflowID string     `json:"workflow_id,omitempty"`
+	Tool       string     `json:"tool"`
+	Arguments  string     `json:"arguments"`
+	Rule       string     `json:"rule,omitempty"` // 命中的规则说明
+	Status     string     `json:"status"`
+	Note       string     `json:"note,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	DecidedAt  *time.Time `json:"decided_at,omitempty"`
+}
+
+// ApprovalDecisionRequest 审批决定请求
+type ApprovalDecisionRequest struct {
+	Decision string `json:"decision" binding:"required"` // "allow" | "deny"
+	Note     string `json:"note,omitempty"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// 分支的来源
+const (
+	BranchEdit       = "edit"       // 编辑历史消息
+	BranchRegenerate = "regenerate" // 重新生成最后一轮回复
+)
+
+// Branch 会话分支
+// 编辑历史中的用户消息会从该消息处分出新分支，原来的后续对话保留在旧分支中，会话因此成为一棵树
+type Branch struct {
+	ID            string             `json:"id"`
+	ParentID      string             `json:"parent_id,omitempty"`       // 分出该分支的父分支，根分支为空
+	ForkMessageID string             `json:"fork_message_id,omitempty"` // 父分支中被编辑的消息
+	ForkIndex     int                `json:"fork_index"`                // 与父分支共享的消息条数
+	Preview       string             `json:"preview,omitempty"`         // 分叉处的用户消息（编辑后的内容）
+	Kind          string             `json:"kind,omitempty"`            // edit | regenerate，根分支为空
+	Params        *RegenerateRequest `json:"params,omitempty"`          // 重新生成时使用的参数
+	MessageCount  int                `json:"message_count"`
+	Active        bool               `json:"active"`
+	CreatedAt     time.Time          `json:"created_at"`
+
+	BranchParams // 分支使用的模板和模型
+}
+
+// BranchParams 分支使用的模板和模型，切换到该分支时恢复到会话上
+// 活动分支以会话当前的设置为准，离开时记录；AgentType 为空表示没有记录
+type BranchParams struct {
+	AgentType string `json:"agent_type,omitempty"`
+	Model     string `json:"model,omitempty"`
+}
+
+// BranchList 会话的全部分支
+type BranchList struct {
+	Active   string   `json:"active"`
+	Branches []Branch `json:"branches"`
+}
+
+// EditMessageRequest 编辑消息请求
+type EditMessageRequest struct {
+	Message string `json:"message" binding:"required"`
+}
+
+// RegenerateRequest 重新生成请求，字段均可选
+type RegenerateRequest struct {
+	Model       string   `json:"model,omitempty"`       // 使用其他模型，之后的对话沿用
+	Temperature *float64 `json:"temperature,omitempty"` // Agent 的模型配置不支持设置温度，指定时返回 400
+	AgentType   string   `json:"agent_type,omitempty"`  // 使用其他模板，之后的对话沿用
+}
+
+// VariantList 同一轮回复的全部变体（原回复及其重新生成的版本）
+type VariantList struct {
+	Active    string   `json:"active"`
+	ForkIndex int      `json:"fork_index"` // 变体共享的消息条数（不含该轮的用户消息）
+	Variants  []Branch `json:"variants"`
+}
+
+// ForkSessionRequest 分叉会话请求，字段均可选，缺省时沿用原会话
+type ForkSessionRequest struct {
+	Title     string `json:"title,omitempty"`
+	AgentType string `json:"agent_type,omitempty"`
+	Model     string `json:"model,omitempty"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// 导出格式标识与版本（格式说明见 docs/EXPORT_FORMAT.md）
+// 只新增字段时版本不变；删除、重命名字段或改变含义时递增版本
+const (
+	SessionExportSchema  = "agentdemo.session"
+	WorkflowExportSchema = "agentdemo.workflow"
+	ExportVersion        = 1
+)
+
+// 导出格式
+const (
+	ExportMarkdown = "md"
+	ExportJSON     = "json"
+	ExportJSONL    = "jsonl"
+	ExportHTML     = "html"
+)
+
+// SessionExport 会话导出（json 格式）
+// jsonl 格式的首行为不含 messages 的本结构（"type": "session"），之后每行一条消息（"type": "message"）
+type SessionExport struct {
+	Schema     string           `json:"schema"`
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Session    *Session         `json:"session"`
+	Model      string           `json:"model"`    // 会话 Agent 使用的模型
+	Branch     string           `json:"branch"`   // 导出的分支（会话当前所在分支）
+	Messages   []HistoryMessage `json:"messages"` // 按时间正序
+}
+
+// WorkflowExport 工作流导出（json 格式）
+// jsonl 格式的首行为不含 events 的本结构（"type": "workflow"），之后每行一个事件（"type": "event"）
+type WorkflowExport struct {
+	Schema     string                    `json:"schema"`
+	Version    int                       `json:"version"`
+	ExportedAt time.Time                 `json:"exported_at"`
+	Workflow   WorkflowSummary           `json:"workflow"`
+	Artifacts  WorkflowArtifactsResponse `json:"artifacts"`
+	Events     []WorkflowEventData       `json:"events"`
+}
+
+// WorkflowSummary 工作流概要
+type WorkflowSummary struct {
+	WorkflowID      string           `json:"workflow_id"`
+	Topic           string           `json:"topic"`
+	Requirements    string           `json:"requirements,omitempty"`
+	Model           string           `json:"model,omitempty"`
+	Stage           string           `json:"stage"`
+	Progress        int              `json:"progress"`
+	StartTime       time.Time        `json:"start_time"`
+	EndTime         *time.Time       `json:"end_time,omitempty"`
+	Error           string           `json:"error,omitempty"`
+	GuideViolations []GuideViolation `json:"guide_violations,omitempty"`
+}
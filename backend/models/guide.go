@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// 术语类型
+const (
+	TermTypePreferred = "preferred" // 推荐用语
+	TermTypeBanned    = "banned"    // 禁用词
+	TermTypeProduct   = "product"   // 产品名称（大小写与写法必须一致）
+)
+
+// GlossaryTerm 术语条目
+type GlossaryTerm struct {
+	Term      string `json:"term" binding:"required"`
+	Type      string `json:"type"`                // "preferred" | "banned" | "product"
+	Preferred string `json:"preferred,omitempty"` // 禁用词的推荐替代写法
+	Note      string `json:"note,omitempty"`
+}
+
+// Glossary 术语表（每次更新都会生成一个新版本）
+type Glossary struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Version   int            `json:"version"`
+	Terms     []GlossaryTerm `json:"terms"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// StyleGuide 风格指南（每次更新都会生成一个新版本）
+type StyleGuide struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	Content   string    `json:"content"` // Markdown 格式的风格规范
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GlossaryRequest 创建/更新术语表请求
+type GlossaryRequest struct {
+	Name  string         `json:"name" binding:"required"`
+	Terms []GlossaryTerm `json:"terms"`
+}
+
+// StyleGuideRequest 创建/更新风格指南请求
+type StyleGuideRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Content string `json:"content" binding:"required"`
+}
+
+// GuideRefs 术语表与风格指南引用
+type GuideRefs struct {
+	GlossaryID   string `json:"glossary_id,omitempty"`
+	StyleGuideID string `json:"style_guide_id,omitempty"`
+}
+
+// GuideViolation 输出中仍然出现的禁用词
+type GuideViolation struct {
+	Term      string `json:"term"`
+	Preferred string `json:"preferred,omitempty"`
+	Count     int    `json:"count"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 消息内容块类型
+const (
+	BlockText       = "text"
+	BlockToolUse    = "tool_use"
+	BlockToolResult = "tool_result"
+)
+
+// ContentBlock 消息内容块
+type ContentBlock struct {
+	Type string `json:"type"` // text | tool_use | tool_result，无法识别的块保留原始类型
+
+	Text string `json:"text,omitempty"` // text
+
+	ID    string          `json:"id,omitempty"`    // tool_use：工具调用 ID
+	Name  string          `json:"name,omitempty"`  // tool_use：工具名
+	Input json.RawMessage `json:"input,omitempty"` // tool_use：调用参数
+
+	ToolUseID string      `json:"tool_use_id,omitempty"` // tool_result：对应的工具调用 ID
+	Output    interface{} `json:"content,omitempty"`     // tool_result：工具输出
+	IsError   bool        `json:"is_error,omitempty"`    // tool_result：是否为错误结果
+
+	Raw json.RawMessage `json:"raw,omitempty"` // 无法识别的块的原始内容
+}
+
+// HistoryMessage 历史消息
+type HistoryMessage struct {
+	ID        string         `json:"id"`
+	Role      string         `json:"role"`    // user | assistant
+	Content   string         `json:"content"` // 文本块拼接后的内容
+	Blocks    []ContentBlock `json:"blocks"`
+	Timestamp time.Time      `json:"timestamp"`
+	Stopped   bool           `json:"stopped,omitempty"` // 回复被用户中止，内容为中止前已生成的部分
+}
+
+// HistoryQuery 历史消息分页参数
+// Before / After 为消息 ID 游标，都为空时返回最新的一页
+type HistoryQuery struct {
+	Before string
+	After  string
+	Limit  int
+}
+
+// MessagePage 历史消息分页结果（按时间正序）
+type MessagePage struct {
+	Messages []HistoryMessage `json:"messages"`
+	Total    int              `json:"total"`
+	HasMore  bool             `json:"has_more"`         // 游标方向上是否还有更多消息
+	Before   string           `json:"before,omitempty"` // 加载更早消息的游标（本页第一条消息 ID）
+	After    string           `json:"after,omitempty"`  // 加载更新消息的游标（本页最后一条消息 ID）
+}
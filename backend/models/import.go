@@ -0,0 +1,31 @@
+package models
+
+// 导入来源格式
+const (
+	ImportAgentdemo = "agentdemo" // 本系统的 json / jsonl 导出（见 docs/EXPORT_FORMAT.md）
+	ImportMessages  = "messages"  // role / content 消息数组（OpenAI、Anthropic 等聊天记录）
+)
+
+// ImportIssue 导入时无法转换的内容
+type ImportIssue struct {
+	Message int    `json:"message"`         // 输入中的消息序号
+	Block   *int   `json:"block,omitempty"` // 消息中的内容块序号，整条消息无法导入时为空
+	Type    string `json:"type"`            // 内容块类型或消息角色
+	Reason  string `json:"reason"`
+}
+
+// ImportResponse 导入结果
+type ImportResponse struct {
+	Session  *Session      `json:"session"`
+	Format   string        `json:"format"`             // agentdemo | messages
+	Messages int           `json:"messages"`           // 写入的消息条数（连续的同角色消息会被合并）
+	Skipped  []ImportIssue `json:"skipped,omitempty"`  // 未导入的内容
+	Warnings []string      `json:"warnings,omitempty"` // 如导出中的模板或指南在本系统中不存在
+}
+
+// ImportErrorResponse 输入包含无法导入的内容
+// 确认丢弃这些内容时使用 ?skip_unsupported=true 重新导入
+type ImportErrorResponse struct {
+	Error       string        `json:"error"`
+	Unsupported []ImportIssue `json:"unsupported"`
+}
@@ -0,0 +1,109 @@
+package models
+
+import "encoding/json"
+
+// OpenAI 兼容接口（/v1）的请求与响应，字段与 OpenAI Chat Completions API 一致，未列出的请求字段会被忽略
+
+// OpenAIChatRequest Chat Completions 请求
+type OpenAIChatRequest struct {
+	Model         string               `json:"model" binding:"required"` // 模板 ID，或 "模板 ID/模型"
+	Messages      []OpenAIMessage      `json:"messages" binding:"required"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+	Tools         []json.RawMessage    `json:"tools,omitempty"`     // 不支持，Agent 只使用模板自身的工具
+	Functions     []json.RawMessage    `json:"functions,omitempty"` // 同上（旧版写法）
+	User          string               `json:"user,omitempty"`
+}
+
+// OpenAIStreamOptions 流式输出选项
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"` // 结束前额外发送一个带 usage 的分片
+}
+
+// OpenAIMessage 对话消息，content 为字符串或内容片段数组
+type OpenAIMessage struct {
+	Role       string          `json:"role"` // system | developer | user | assistant
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  json.RawMessage `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+// OpenAIChatCompletion 非流式响应
+type OpenAIChatCompletion struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"` // chat.completion
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []OpenAIChoice `json:"choices"`
+	Usage   *OpenAIUsage   `json:"usage,omitempty"`
+}
+
+// OpenAIChoice 非流式响应的候选回复
+type OpenAIChoice struct {
+	Index        int                `json:"index"`
+	Message      OpenAIReplyMessage `json:"message"`
+	FinishReason string             `json:"finish_reason"` // stop | length
+}
+
+// OpenAIReplyMessage 助手回复
+type OpenAIReplyMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// OpenAIChatChunk 流式响应分片（SSE data）
+type OpenAIChatChunk struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"` // chat.completion.chunk
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []OpenAIChunkChoice `json:"choices"`
+	Usage   *OpenAIUsage        `json:"usage,omitempty"`
+}
+
+// OpenAIChunkChoice 流式分片的候选回复
+type OpenAIChunkChoice struct {
+	Index        int         `json:"index"`
+	Delta        OpenAIDelta `json:"delta"`
+	FinishReason *string     `json:"finish_reason"` // 最后一个分片之前为 null
+}
+
+// OpenAIDelta 流式分片的增量内容
+type OpenAIDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// OpenAIUsage Token 用量
+type OpenAIUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// OpenAIModel 模型列表中的一项（对应一个模板）
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"` // model
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// OpenAIModelList 模型列表
+type OpenAIModelList struct {
+	Object string        `json:"object"` // list
+	Data   []OpenAIModel `json:"data"`
+}
+
+// OpenAIErrorResponse 错误响应，OpenAI SDK 从 error.message 读取错误信息
+type OpenAIErrorResponse struct {
+	Error OpenAIError `json:"error"`
+}
+
+// OpenAIError 错误详情
+type OpenAIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"` // invalid_request_error | not_found_error | server_error ...
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
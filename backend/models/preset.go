@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// 预设运行状态
+const (
+	PresetRunRunning     = "running"     // 工作流运行中
+	PresetRunComplete    = "complete"    // 工作流已完成
+	PresetRunFailed      = "failed"      // 工作流失败
+	PresetRunInterrupted = "interrupted" // 运行期间服务重启
+)
+
+// WorkflowPreset 工作流预设：可复用的主题与要求模板，{{name}} 占位符在启动时替换为参数值
+// 内置占位符：{{topic}} 最终主题，{{target_length}} 目标长度
+type WorkflowPreset struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description,omitempty"`
+	Topic        string            `json:"topic,omitempty"` // 默认主题（可含占位符），启动时可被 topic 覆盖
+	Requirements string            `json:"requirements"`
+	Parameters   []PresetParameter `json:"parameters"`
+	Model        string            `json:"model,omitempty"`         // 默认模型，启动时可被 model 覆盖
+	TargetLength int               `json:"target_length,omitempty"` // 目标长度（字），0 为不限
+	UsageCount   int               `json:"usage_count"`
+	LastUsedAt   *time.Time        `json:"last_used_at,omitempty"`
+	Runs         []PresetRun       `json:"runs"` // 最近的运行记录，最新的在前
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+
+	GuideRefs // 默认附加的术语表与风格指南
+}
+
+// PresetParameter 预设参数
+type PresetParameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"` // 必填且没有默认值时，启动请求必须提供
+}
+
+// PresetRun 预设的一次运行
+type PresetRun struct {
+	WorkflowID  string            `json:"workflow_id"`
+	Topic       string            `json:"topic"`
+	Params      map[string]string `json:"params,omitempty"`
+	Model       string            `json:"model,omitempty"`
+	Status      string            `json:"status"` // running | complete | failed | interrupted
+	StartedAt   time.Time         `json:"started_at"`
+	FinishedAt  *time.Time        `json:"finished_at,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	FinalLength int               `json:"final_length,omitempty"` // 终稿字数
+}
+
+// WorkflowPresetRequest 创建 / 更新工作流预设请求
+type WorkflowPresetRequest struct {
+	Name         string            `json:"name" binding:"required"`
+	Description  string            `json:"description,omitempty"`
+	Topic        string            `json:"topic,omitempty"`
+	Requirements string            `json:"requirements" binding:"required"`
+	Parameters   []PresetParameter `json:"parameters,omitempty"`
+	Model        string            `json:"model,omitempty"`
+	TargetLength int               `json:"target_length,omitempty"`
+
+	GuideRefs
+}
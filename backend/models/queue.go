@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// 排队消息的状态
+const (
+	QueueStatusQueued    = "queued"    // 等待前面的消息处理完成
+	QueueStatusRunning   = "running"   // Agent 正在处理
+	QueueStatusDone      = "done"      // 已完成
+	QueueStatusFailed    = "failed"    // 处理出错
+	QueueStatusStopped   = "stopped"   // 处理中被用户停止，已生成的部分回复保留在历史中
+	QueueStatusCancelled = "cancelled" // 排队中被取消，或处理中因编辑消息、切换分支被中止
+)
+
+// QueuedMessage 会话消息队列中的一条消息
+type QueuedMessage struct {
+	ID         string          `json:"id"`
+	SessionID  string          `json:"session_id"`
+	Message    string          `json:"message"`
+	Status     string          `json:"status"`                // queued | running | done | failed | stopped | cancelled
+	Position   int             `json:"position"`              // 排队位置，1 为下一条；不在排队时为 0
+	Error      string          `json:"error,omitempty"`       // failed 时的错误信息
+	Reply      *HistoryMessage `json:"reply,omitempty"`       // stopped 时保存的（部分）助手消息
+	Usage      *TokenUsage     `json:"usage,omitempty"`       // 结束后为本轮消耗的 Token
+	StopReason string          `json:"stop_reason,omitempty"` // 结束后为 Agent 结束本轮的原因
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// MessageQueueState 会话消息队列的状态
+type MessageQueueState struct {
+	SessionID string          `json:"session_id"`
+	Running   *QueuedMessage  `json:"running,omitempty"`
+	Queued    []QueuedMessage `json:"queued"`   // 按排队顺序
+	Finished  []QueuedMessage `json:"finished"` // 最近结束的消息，最新的在前
+	MaxDepth  int             `json:"max_depth"`
+
+	Changed *QueuedMessage `json:"changed,omitempty"` // WebSocket 推送时为状态发生变化的消息
+}
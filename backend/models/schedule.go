@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// 错过运行的补跑策略（服务停止期间到期的运行）
+const (
+	CatchUpSkip = "skip" // 不补跑，记录一条 skipped 运行
+	CatchUpOnce = "once" // 启动后补跑一次
+	CatchUpAll  = "all"  // 依次补跑每一次错过的运行（有上限）
+)
+
+// 计划运行状态
+const (
+	ScheduleRunRunning     = "running"     // 工作流运行中
+	ScheduleRunComplete    = "complete"    // 工作流已完成
+	ScheduleRunFailed      = "failed"      // 启动失败或工作流失败
+	ScheduleRunSkipped     = "skipped"     // 上一次运行尚未结束，或按补跑策略跳过
+	ScheduleRunInterrupted = "interrupted" // 运行期间服务重启
+)
+
+// WorkflowSchedule 定时工作流
+type WorkflowSchedule struct {
+	ID            string        `json:"id"`
+	Name          string        `json:"name"`
+	Cron          string        `json:"cron"`               // 5 字段 cron 表达式或 @daily 等简写
+	Timezone      string        `json:"timezone,omitempty"` // IANA 时区名，默认服务器本地时区
+	Topic         string        `json:"topic"`
+	Requirements  string        `json:"requirements,omitempty"`
+	Model         string        `json:"model,omitempty"` // 默认为 MODEL 环境变量
+	Enabled       bool          `json:"enabled"`
+	JitterSeconds int           `json:"jitter_seconds,omitempty"` // 每次运行在计划时间后随机延迟 0~N 秒
+	CatchUp       string        `json:"catch_up"`                 // skip | once | all
+	NextRunAt     *time.Time    `json:"next_run_at,omitempty"`    // 下一次计划时间
+	NextStartAt   *time.Time    `json:"next_start_at,omitempty"`  // 下一次实际启动时间（计划时间 + 抖动）
+	LastRunAt     *time.Time    `json:"last_run_at,omitempty"`
+	Runs          []ScheduleRun `json:"runs"` // 最近的运行记录，最新的在前
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+
+	GuideRefs // 附加的术语表与风格指南
+}
+
+// ScheduleRun 定时工作流的一次运行
+type ScheduleRun struct {
+	ID          string     `json:"id"`
+	ScheduledAt time.Time  `json:"scheduled_at"` // 计划时间（手动运行时为触发时间）
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	WorkflowID  string     `json:"workflow_id,omitempty"`
+	Status      string     `json:"status"`           // running | complete | failed | skipped | interrupted
+	Reason      string     `json:"reason,omitempty"` // 跳过或失败的原因
+	CatchUp     bool       `json:"catch_up,omitempty"`
+	Manual      bool       `json:"manual,omitempty"`
+}
+
+// ScheduleRequest 创建 / 更新定时工作流请求
+type ScheduleRequest struct {
+	Name          string `json:"name"`
+	Cron          string `json:"cron" binding:"required"`
+	Timezone      string `json:"timezone,omitempty"`
+	Topic         string `json:"topic" binding:"required"`
+	Requirements  string `json:"requirements,omitempty"`
+	Model         string `json:"model,omitempty"`
+	Enabled       *bool  `json:"enabled,omitempty"` // 默认 true
+	JitterSeconds int    `json:"jitter_seconds,omitempty"`
+	CatchUp       string `json:"catch_up,omitempty"` // 默认 skip
+
+	GuideRefs
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// 模板适用场景
+const (
+	SuitabilityChat        = "chat"         // 可作为会话的 agent_type
+	SuitabilityWritingTool = "writing-tool" // 写作工具（单次文本处理）
+	SuitabilityWorkflow    = "workflow"     // 协作工作流中的角色
+)
+
+// CustomTemplate 用户自定义 Agent 模板
+type CustomTemplate struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	SystemPrompt string    `json:"system_prompt"`
+	Tools        []string  `json:"tools"`
+	Model        string    `json:"model,omitempty"` // 默认模型，留空则使用环境变量 MODEL
+	Suitability  []string  `json:"suitability"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TemplateRequest 创建/更新自定义模板请求
+type TemplateRequest struct {
+	ID           string   `json:"id"` // 仅创建时使用
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	SystemPrompt string   `json:"system_prompt" binding:"required"`
+	Tools        []string `json:"tools"`
+	Model        string   `json:"model"`
+	Suitability  []string `json:"suitability"` // 留空默认为 ["chat"]
+}
+
+// TemplateInfo 模板信息
+type TemplateInfo struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	SystemPrompt string   `json:"system_prompt"`
+	Tools        []string `json:"tools"`
+	Model        string   `json:"model,omitempty"`
+	Suitability  []string `json:"suitability"` // 适用场景：chat | writing-tool | workflow
+	Builtin      bool     `json:"builtin"`     // 内置模板只读
+}
+
+// SwitchTemplateRequest 切换会话模板请求
+type SwitchTemplateRequest struct {
+	AgentType string `json:"agent_type" binding:"required"`
+}
@@ -1,15 +1,66 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// DefaultSessionTitle 未设置标题的会话的默认标题，第一轮对话后会自动生成标题
+const DefaultSessionTitle = "新对话会话"
 
 // Session 会话信息
 type Session struct {
 	ID        string    `json:"id"`
 	Title     string    `json:"title"`
 	AgentID   string    `json:"agent_id"`
-	AgentType string    `json:"agent_type"` // "simple-chat" | "writing-assistant" | "code-analysis"
+	AgentType string    `json:"agent_type"`      // 已注册的模板 ID，如 "simple-chat" | "writing-assistant"
+	Model     string    `json:"model,omitempty"` // 会话使用的模型，为空时使用模板或全局默认模型
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	TitleEdited bool   `json:"title_edited,omitempty"` // 用户设置过标题，不再自动生成
+	ForkedFrom  string `json:"forked_from,omitempty"`  // 分叉来源会话 ID
+
+	Tags     []string               `json:"tags,omitempty"`
+	Pinned   bool                   `json:"pinned,omitempty"`
+	Archived bool                   `json:"archived,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"` // 自由格式的元数据
+
+	GuideRefs // 附加的术语表与风格指南
+}
+
+// UpdateSessionRequest 更新会话请求（PATCH 语义：只修改出现的字段）
+type UpdateSessionRequest struct {
+	Title    *string   `json:"title"`
+	Tags     *[]string `json:"tags"`
+	Pinned   *bool     `json:"pinned"`
+	Archived *bool     `json:"archived"`
+	// 与现有元数据合并，值为 null 的键会被删除
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// SessionFilter 会话列表查询条件
+type SessionFilter struct {
+	Tag       string
+	AgentType string
+	Archived  *bool  // nil 表示不按归档状态过滤
+	Query     string // 在标题和消息内容中全文搜索（不区分大小写）
+	Offset    int
+	Limit     int // 0 表示不限制
+}
+
+// BulkDeleteSessionsRequest 批量删除会话请求
+type BulkDeleteSessionsRequest struct {
+	IDs     []string `json:"ids" binding:"required"`
+	Archive bool     `json:"archive"` // 归档而不是删除
+}
+
+// DeleteSessionsResponse 批量删除 / 清理会话的结果
+type DeleteSessionsResponse struct {
+	Deleted  []string          `json:"deleted"`
+	Failed   map[string]string `json:"failed,omitempty"`   // sessionID -> 错误信息
+	Archives map[string]string `json:"archives,omitempty"` // sessionID -> 归档目录
+	DryRun   bool              `json:"dry_run,omitempty"`
 }
 
 // Message 消息
@@ -24,10 +75,33 @@ type ChatRequest struct {
 	Message string `json:"message" binding:"required"`
 }
 
-// ChatResponse 聊天响应
+// ChatResponse 同步聊天响应（发送消息时 ?wait=true），包含一轮对话的完整结果
 type ChatResponse struct {
-	SessionID string  `json:"session_id"`
-	Message   Message `json:"message"`
+	SessionID  string           `json:"session_id"`
+	ItemID     string           `json:"item_id"`               // 队列中的消息 ID
+	Status     string           `json:"status"`                // done | failed | stopped | cancelled；等待超时时为 queued 或 running
+	Message    *HistoryMessage  `json:"message"`               // 最终的助手消息，没有时为 null
+	Messages   []HistoryMessage `json:"messages"`              // 本轮写入历史的全部消息（用户消息、工具调用与结果、助手回复）
+	ToolCalls  []ChatToolCall   `json:"tool_calls"`            // 本轮的工具调用
+	Usage      *TokenUsage      `json:"usage,omitempty"`       // 本轮消耗的 Token
+	StopReason string           `json:"stop_reason,omitempty"` // Agent 结束本轮的原因；停止、取消、出错时分别为 stopped、cancelled、error
+	Error      string           `json:"error,omitempty"`
+}
+
+// ChatToolCall 一轮对话中的工具调用及其结果
+type ChatToolCall struct {
+	ID      string          `json:"id"`
+	Name    string          `json:"name"`
+	Input   json.RawMessage `json:"input,omitempty"`
+	Output  interface{}     `json:"output,omitempty"` // 没有结果（本轮被中止）时为空
+	IsError bool            `json:"is_error,omitempty"`
+}
+
+// TokenUsage Token 用量
+type TokenUsage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	TotalTokens  int64 `json:"total_tokens"`
 }
 
 // WritingToolRequest 写作工具请求
@@ -35,7 +109,13 @@ type WritingToolRequest struct {
 	Text      string `json:"text" binding:"required"`
 	SessionID string `json:"session_id,omitempty"`
 	Style     string `json:"style,omitempty"`    // 用于 rewrite
-	Language  string `json:"language,omitempty"` // 用于 translate
+	Language  string `json:"language,omitempty"` // 用于 translate，目标语言
+
+	GuideRefs // 附加的术语表与风格指南
+
+	// 以下字段仅用于 translate
+	SourceLanguage string            `json:"source_language,omitempty"` // 源语言，留空则自动识别
+	Glossary       map[string]string `json:"glossary,omitempty"`        // 术语表：原文术语 -> 强制译法
 }
 
 // WritingToolResponse 写作工具响应
@@ -43,6 +123,8 @@ type WritingToolResponse struct {
 	OriginalText  string `json:"original_text"`
 	ProcessedText string `json:"processed_text"`
 	Action        string `json:"action"` // polish, rewrite, expand, summarize, translate
+
+	Violations []GuideViolation `json:"violations,omitempty"` // 输出中仍然出现的禁用词
 }
 
 // ErrorResponse 错误响应
@@ -56,6 +138,55 @@ type WSMessage struct {
 	Data interface{} `json:"data"`
 }
 
+// 客户端发送的 WebSocket 帧类型
+const (
+	WSFrameUserMessage  = "user_message"  // 发送用户消息
+	WSFrameCancel       = "cancel"        // 取消排队中的消息，未指定消息时同 stop
+	WSFrameStop         = "stop"          // 停止当前轮次，保留已生成的部分回复
+	WSFrameToolApproval = "tool_approval" // 回复工具审批请求
+	WSFrameSettings     = "settings"      // 修改连接/会话设置
+)
+
+// WSClientFrame 客户端发送的 WebSocket 帧
+type WSClientFrame struct {
+	ID   string          `json:"id"` // 客户端生成的关联 ID，服务端在 ack 中原样返回
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// WSAckData 客户端帧确认数据
+type WSAckData struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+
+	Result interface{} `json:"result,omitempty"` // 帧的处理结果，如 user_message 进入队列后的消息
+}
+
+// WSUserMessageData 用户消息帧数据
+type WSUserMessageData struct {
+	Message string `json:"message"`
+}
+
+// WSCancelData 取消帧数据，item_id 为空时停止当前轮次
+type WSCancelData struct {
+	ItemID string `json:"item_id,omitempty"`
+}
+
+// WSToolApprovalData 工具审批帧数据
+type WSToolApprovalData struct {
+	RequestID string `json:"request_id"`
+	Decision  string `json:"decision"` // "allow" | "deny"
+	Note      string `json:"note,omitempty"`
+}
+
+// WSSettingsData 设置帧数据（只修改提供的字段）
+type WSSettingsData struct {
+	AgentType      *string `json:"agent_type,omitempty"`      // 切换会话模板
+	ForwardMonitor *bool   `json:"forward_monitor,omitempty"` // 是否推送 monitor 事件（状态、用量、错误）
+}
+
 // TextChunkData 文本块数据
 type TextChunkData struct {
 	Delta string `json:"delta"`
@@ -73,6 +204,11 @@ type DoneData struct {
 	Reason string `json:"reason"`
 }
 
+// GuideViolationData 规范检查数据
+type GuideViolationData struct {
+	Violations []GuideViolation `json:"violations"`
+}
+
 // CommandExecutedData 命令执行数据
 type CommandExecutedData struct {
 	CommandName string `json:"command_name"`
@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+// Webhook 事件类型
+const (
+	WebhookWorkflowStarted         = "workflow.started"          // 工作流已启动
+	WebhookWorkflowStageCompleted  = "workflow.stage_completed"  // 工作流的一个阶段（研究、写作、编辑）已完成
+	WebhookWorkflowCompleted       = "workflow.completed"        // 工作流已完成，data 中包含全部产物
+	WebhookWorkflowFailed          = "workflow.failed"           // 工作流失败
+	WebhookSessionMessageCompleted = "session.message_completed" // 会话的一轮对话已完成
+	WebhookPing                    = "ping"                      // 测试投递（POST /api/webhooks/:id/ping）
+)
+
+// WebhookEvents 可订阅的事件类型
+var WebhookEvents = []string{
+	WebhookWorkflowStarted,
+	WebhookWorkflowStageCompleted,
+	WebhookWorkflowCompleted,
+	WebhookWorkflowFailed,
+	WebhookSessionMessageCompleted,
+}
+
+// 投递状态
+const (
+	DeliveryPending   = "pending"   // 投递中或等待重试
+	DeliverySucceeded = "succeeded" // 接收方返回 2xx
+	DeliveryFailed    = "failed"    // 重试次数用完仍未成功
+)
+
+// Webhook 订阅
+type Webhook struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"` // 订阅的事件类型，"*" 为全部
+	Secret      string    `json:"secret"` // HMAC 签名密钥，只在创建时返回，之后为空
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookRequest 创建 / 更新 Webhook 请求
+type WebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events" binding:"required"`
+	Secret      string   `json:"secret,omitempty"` // 留空时创建自动生成，更新保持不变
+	Description string   `json:"description,omitempty"`
+	Active      *bool    `json:"active,omitempty"` // 默认 true
+}
+
+// WebhookPayload 投递的请求体
+type WebhookPayload struct {
+	ID        string      `json:"id"` // 事件 ID，重试和重新投递时不变，接收方可用于去重
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDelivery 一次事件投递的记录
+type WebhookDelivery struct {
+	ID          string           `json:"id"`
+	WebhookID   string           `json:"webhook_id"`
+	EventID     string           `json:"event_id"`
+	EventType   string           `json:"event_type"`
+	URL         string           `json:"url"`
+	Status      string           `json:"status"` // pending | succeeded | failed
+	Attempts    []WebhookAttempt `json:"attempts"`
+	Payload     WebhookPayload   `json:"payload"`
+	CreatedAt   time.Time        `json:"created_at"`
+	NextRetryAt *time.Time       `json:"next_retry_at,omitempty"`
+	FinishedAt  *time.Time       `json:"finished_at,omitempty"`
+}
+
+// WebhookAttempt 一次投递尝试
+type WebhookAttempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"` // 没有收到响应时为 0
+	Error      string    `json:"error,omitempty"`
+	Response   string    `json:"response,omitempty"` // 响应体开头的一部分
+	DurationMs int64     `json:"duration_ms"`
+}
@@ -3,21 +3,33 @@ package models
 import "time"
 
 // WorkflowStartRequest 启动工作流请求
+// 使用预设时 topic、model 可省略（默认取预设），requirements 追加在预设渲染出的要求之后
 type WorkflowStartRequest struct {
-	Topic        string `json:"topic" binding:"required"`
-	Requirements string `json:"requirements"`
-	SessionID    string `json:"session_id"`
+	Topic        string            `json:"topic"` // 不使用预设时必填
+	Requirements string            `json:"requirements"`
+	Model        string            `json:"model,omitempty"` // 使用的模型，默认为预设的模型或 MODEL 环境变量
+	SessionID    string            `json:"session_id"`
+	Preset       string            `json:"preset,omitempty"` // 工作流预设的 ID 或名称
+	Params       map[string]string `json:"params,omitempty"` // 预设参数值
+
+	GuideRefs // 附加的术语表与风格指南（注入作家和编辑）
 }
 
 // WorkflowStartResponse 启动工作流响应
 type WorkflowStartResponse struct {
-	WorkflowID string `json:"workflow_id"`
-	Status     string `json:"status"`
+	WorkflowID   string `json:"workflow_id"`
+	Status       string `json:"status"`
+	Preset       string `json:"preset,omitempty"`       // 使用的预设 ID
+	Topic        string `json:"topic,omitempty"`        // 使用预设时渲染后的主题
+	Requirements string `json:"requirements,omitempty"` // 使用预设时渲染后的要求
 }
 
 // WorkflowStatusResponse 工作流状态响应
 type WorkflowStatusResponse struct {
 	WorkflowID       string              `json:"workflow_id"`
+	Topic            string              `json:"topic"`
+	Requirements     string              `json:"requirements,omitempty"`
+	Model            string              `json:"model,omitempty"`
 	Stage            string              `json:"stage"`
 	Progress         int                 `json:"progress"`
 	StartTime        time.Time           `json:"start_time"`
@@ -27,6 +39,8 @@ type WorkflowStatusResponse struct {
 	EditorStatus     interface{}         `json:"editor_status,omitempty"`
 	Events           []WorkflowEventData `json:"events"`
 	Error            string              `json:"error,omitempty"`
+	GuideViolations  []GuideViolation    `json:"guide_violations,omitempty"`
+	PendingApprovals []ApprovalRequest   `json:"pending_approvals,omitempty"`
 }
 
 // WorkflowEventData 工作流事件数据
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// WorkspaceFile 工作区文件
+type WorkspaceFile struct {
+	Path    string    `json:"path"` // 相对于会话工作区的路径，使用 / 分隔
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// WorkspaceUsage 工作区用量与配额
+type WorkspaceUsage struct {
+	Bytes    int64 `json:"bytes"`
+	Files    int   `json:"files"`
+	MaxBytes int64 `json:"max_bytes"`
+	MaxFiles int   `json:"max_files"`
+}
+
+// WorkspaceListing 工作区文件列表
+type WorkspaceListing struct {
+	Files []WorkspaceFile `json:"files"`
+	Usage WorkspaceUsage  `json:"usage"`
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/coso/agentdemo/backend/models"
+)
+
+const approvalPolicyFile = ".agentsdk/approval_policy.json"
+
+// DefaultApprovalPolicy 默认审批策略：会话 Agent 执行命令和写文件需要审批，其余工具自动放行；
+// 工作流 Agent 无人值守（定时任务），各阶段必须用 fs_write 保存产物，因此不受这两条规则限制
+func DefaultApprovalPolicy() *models.ApprovalPolicy {
+	return &models.ApprovalPolicy{
+		Rules: []models.ApprovalRule{
+			{Tool: "bash_run", Action: models.ApprovalActionRequire, Context: models.ApprovalContextSession},
+			{Tool: "fs_write", Action: models.ApprovalActionRequire, Context: models.ApprovalContextSession},
+		},
+		DefaultAction:  models.ApprovalActionAllow,
+		TimeoutSeconds: 300,
+	}
+}
+
+// PolicyValidator 校验审批策略，返回每条规则编译后的 arg_pattern（未设置时为 nil）
+type PolicyValidator func(policy *models.ApprovalPolicy) ([]*regexp.Regexp, error)
+
+// ApprovalPolicyStore 审批策略存储，与策略一起保存编译好的 arg_pattern
+type ApprovalPolicyStore struct {
+	mu       sync.RWMutex
+	policy   *models.ApprovalPolicy
+	patterns []*regexp.Regexp
+	filePath string
+}
+
+// NewApprovalPolicyStore 创建审批策略存储，文件不存在时使用默认策略；文件中的策略无效时返回错误
+func NewApprovalPolicyStore(validate PolicyValidator) (*ApprovalPolicyStore, error) {
+	store := &ApprovalPolicyStore{
+		policy:   DefaultApprovalPolicy(),
+		filePath: approvalPolicyFile,
+	}
+
+	var policy models.ApprovalPolicy
+	if err := readJSONFile(store.filePath, &policy); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		store.policy = &policy
+	}
+
+	patterns, err := validate(store.policy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid approval policy %s: %w", store.filePath, err)
+	}
+	store.patterns = patterns
+
+	return store, nil
+}
+
+// Get 获取当前策略
+func (s *ApprovalPolicyStore) Get() *models.ApprovalPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.policy
+}
+
+// GetCompiled 获取当前策略及其编译好的 arg_pattern（与 Rules 一一对应）
+func (s *ApprovalPolicyStore) GetCompiled() (*models.ApprovalPolicy, []*regexp.Regexp) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.policy, s.patterns
+}
+
+// Set 替换策略，patterns 为 PolicyValidator 返回的编译结果
+func (s *ApprovalPolicyStore) Set(policy *models.ApprovalPolicy, patterns []*regexp.Regexp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := writeJSONFile(s.filePath, policy); err != nil {
+		return err
+	}
+	s.policy = policy
+	s.patterns = patterns
+	return nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+)
+
+const (
+	agentDataRoot = ".agentsdk"
+	archiveRoot   = ".agentsdk/archive"
+)
+
+// AgentDataPath Agent 在 Store 中的数据目录（消息、状态等）
+func AgentDataPath(agentID string) string {
+	return filepath.Join(agentDataRoot, agentID)
+}
+
+// PurgeAgentData 删除 Agent 的全部存储数据
+func PurgeAgentData(agentID string) error {
+	if agentID == "" || filepath.Base(agentID) != agentID {
+		return fmt.Errorf("%w: agent id %q", ErrInvalidPath, agentID)
+	}
+	return os.RemoveAll(AgentDataPath(agentID))
+}
+
+// ArchiveSession 归档会话：会话元数据、Agent 数据和工作区移动到
+// .agentsdk/archive/<sessionID>-<时间戳>/ 下，返回归档目录
+func ArchiveSession(session *models.Session, workspaces *WorkspaceStore) (string, error) {
+	if session.AgentID == "" || filepath.Base(session.AgentID) != session.AgentID {
+		return "", fmt.Errorf("%w: agent id %q", ErrInvalidPath, session.AgentID)
+	}
+	workspaceDir, err := workspaces.sessionPath(session.ID)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(archiveRoot, fmt.Sprintf("%s-%s", session.ID, time.Now().Format("20060102-150405")))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create archive directory: %w", err)
+	}
+
+	if err := writeJSONFile(filepath.Join(dir, "session.json"), session); err != nil {
+		return "", err
+	}
+	if err := moveIfExists(AgentDataPath(session.AgentID), filepath.Join(dir, "agent")); err != nil {
+		return "", fmt.Errorf("archive agent data: %w", err)
+	}
+	if err := moveIfExists(workspaceDir, filepath.Join(dir, "workspace")); err != nil {
+		return "", fmt.Errorf("archive workspace: %w", err)
+	}
+
+	return dir, nil
+}
+
+// moveIfExists 移动目录，源目录不存在时忽略
+func moveIfExists(src, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	return os.Rename(src, dst)
+}
@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/google/uuid"
+)
+
+const (
+	branchesFile = "branches.json" // 会话分支记录（Agent 数据目录下）
+
+	// RootBranchID 会话第一次分叉前所在的分支
+	RootBranchID = "main"
+
+	branchPreviewLimit = 100 // 分支预览的最大字符数
+)
+
+var (
+	// ErrNotEditable 消息不能被编辑（只能编辑用户发送的文本消息）
+	ErrNotEditable = errors.New("only user text messages can be edited")
+	// ErrNothingToRegenerate 最后一条用户消息之后还没有回复
+	ErrNothingToRegenerate = errors.New("no assistant reply to regenerate")
+	// ErrInvalidForkPoint 分叉位置超出范围或落在工具调用与其结果之间
+	ErrInvalidForkPoint = errors.New("invalid fork point")
+)
+
+// branchRecord 分支记录，非活动分支保存其消息快照
+// 活动分支的消息就是 Agent 当前的消息文件
+type branchRecord struct {
+	models.Branch
+	Messages []json.RawMessage `json:"messages,omitempty"`
+	Meta     []messageMeta     `json:"meta,omitempty"`
+}
+
+// branchState 会话的分支树
+type branchState struct {
+	Active   string          `json:"active"`
+	Branches []*branchRecord `json:"branches"`
+}
+
+// Branches 列出 Agent 的全部分支
+func (s *HistoryStore) Branches(agentID string) (*models.BranchList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := loadHistory(agentID, true)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadBranches(agentID, current)
+	if err != nil {
+		return nil, err
+	}
+	return state.list(len(current.raws)), nil
+}
+
+// Fork 从指定的用户消息处分出新分支并切换过去，spec 提供分支的 Preview、Kind、Params 和新分支的模板与模型
+// 当前分支的完整历史和 active（会话当前的模板与模型）保存为快照，Agent 的消息截断到该消息之前，由调用方发送编辑后的消息重新生成。
+// 调用前需关闭 Agent，之后重新创建
+func (s *HistoryStore) Fork(agentID, messageID string, active models.BranchParams, spec models.Branch) (*models.Branch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := loadHistory(agentID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	index := indexOfMessage(current.messages, messageID)
+	if index < 0 {
+		return nil, fmt.Errorf("message %w: %s", ErrNotFound, messageID)
+	}
+	if !isEditable(current.messages[index]) {
+		return nil, ErrNotEditable
+	}
+
+	return fork(agentID, current, index, active, spec)
+}
+
+// ForkLastTurn 从最后一条用户消息处分出新分支（丢弃最后一轮回复），返回需要重新发送的用户消息
+// 调用前需关闭 Agent，之后重新创建
+func (s *HistoryStore) ForkLastTurn(agentID string, active models.BranchParams, spec models.Branch) (*models.Branch, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := loadHistory(agentID, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	index := lastUserMessage(current.messages)
+	if index < 0 || index == len(current.messages)-1 {
+		return nil, "", ErrNothingToRegenerate
+	}
+
+	message := current.messages[index].Content
+	spec.Preview = message
+	branch, err := fork(agentID, current, index, active, spec)
+	if err != nil {
+		return nil, "", err
+	}
+	return branch, message, nil
+}
+
+// Variants 列出当前这一轮回复的全部变体
+// 当前分支是重新生成出来的时，变体为其最初的分支及从同一位置重新生成的全部分支；
+// 否则以当前最后一条用户消息为准，包括从该消息重新生成过的分支
+func (s *HistoryStore) Variants(agentID string) (*models.VariantList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := loadHistory(agentID, true)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadBranches(agentID, current)
+	if err != nil {
+		return nil, err
+	}
+
+	active := state.find(state.Active)
+	index := lastUserMessage(current.messages)
+	if active != nil && active.Kind == models.BranchRegenerate {
+		index = active.ForkIndex
+	}
+
+	isVariant := func(record *branchRecord) bool {
+		return record.Kind == models.BranchRegenerate && record.ForkIndex == index
+	}
+
+	// 向上找到最初的分支
+	origin := active
+	for origin != nil && isVariant(origin) {
+		parent := state.find(origin.ParentID)
+		if parent == nil {
+			break
+		}
+		origin = parent
+	}
+
+	all := state.list(len(current.raws))
+	byID := make(map[string]models.Branch, len(all.Branches))
+	for _, branch := range all.Branches {
+		byID[branch.ID] = branch
+	}
+
+	list := &models.VariantList{Active: state.Active, ForkIndex: index, Variants: []models.Branch{}}
+	if origin == nil {
+		return list, nil
+	}
+
+	// 按创建顺序收集从最初分支重新生成出的全部后代
+	included := map[string]bool{origin.ID: true}
+	list.Variants = append(list.Variants, byID[origin.ID])
+	for _, record := range state.Branches {
+		if !isVariant(record) || !included[record.ParentID] {
+			continue
+		}
+		included[record.ID] = true
+		list.Variants = append(list.Variants, byID[record.ID])
+	}
+	return list, nil
+}
+
+// Copy 将源 Agent 的前 count 条消息复制为目标 Agent 的历史（用于分叉出独立会话）
+// 复制的消息保留原时间戳，使用新的消息 ID；count 不能截在工具调用和其结果之间
+func (s *HistoryStore) Copy(srcAgentID, dstAgentID string, count int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source, err := loadHistory(srcAgentID, true)
+	if err != nil {
+		return err
+	}
+	if count < 0 || count > len(source.raws) {
+		return fmt.Errorf("%w: %d (session has %d messages)", ErrInvalidForkPoint, count, len(source.raws))
+	}
+	if count > 0 {
+		for _, block := range source.messages[count-1].Blocks {
+			if block.Type == models.BlockToolUse {
+				return fmt.Errorf("%w: message %d is a tool call waiting for its result", ErrInvalidForkPoint, count-1)
+			}
+		}
+	}
+
+	metas := make([]messageMeta, count)
+	for i, meta := range source.metas[:count] {
+		meta.ID = uuid.New().String()
+		metas[i] = meta
+	}
+	return writeHistory(dstAgentID, source.raws[:count], metas)
+}
+
+// fork 保存当前分支快照，创建新分支并把 Agent 的消息截断到 index 之前
+func fork(agentID string, current *agentHistory, index int, active models.BranchParams, spec models.Branch) (*models.Branch, error) {
+	state, err := loadBranches(agentID, current)
+	if err != nil {
+		return nil, err
+	}
+	state.snapshot(current, active)
+
+	preview := spec.Preview
+	runes := []rune(preview)
+	if len(runes) > branchPreviewLimit {
+		preview = string(runes[:branchPreviewLimit])
+	}
+	branch := &branchRecord{Branch: models.Branch{
+		ID:            uuid.New().String(),
+		ParentID:      state.Active,
+		ForkMessageID: current.messages[index].ID,
+		ForkIndex:     index,
+		Preview:       preview,
+		Kind:          spec.Kind,
+		Params:        spec.Params,
+		BranchParams:  spec.BranchParams,
+		CreatedAt:     time.Now(),
+	}}
+	state.Branches = append(state.Branches, branch)
+	state.Active = branch.ID
+
+	// 先保存快照再截断，中途失败不会丢失原分支
+	if err := saveBranches(agentID, state); err != nil {
+		return nil, err
+	}
+	if err := writeHistory(agentID, current.raws[:index], current.metas[:index]); err != nil {
+		return nil, err
+	}
+
+	result := branch.Branch
+	result.Active = true
+	result.MessageCount = index
+	return &result, nil
+}
+
+// Checkout 切换到指定分支：保存当前分支的快照（包括 active，即会话当前的模板与模型），并用目标分支的快照替换 Agent 的消息
+// 目标分支记录的模板与模型在返回的列表中，由调用方恢复到会话上。调用前需关闭 Agent，之后重新创建
+func (s *HistoryStore) Checkout(agentID, branchID string, active models.BranchParams) (*models.BranchList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := loadHistory(agentID, true)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadBranches(agentID, current)
+	if err != nil {
+		return nil, err
+	}
+
+	target := state.find(branchID)
+	if target == nil {
+		return nil, fmt.Errorf("branch %w: %s", ErrNotFound, branchID)
+	}
+	if branchID == state.Active {
+		return state.list(len(current.raws)), nil
+	}
+
+	state.snapshot(current, active)
+	state.Active = branchID
+	if err := saveBranches(agentID, state); err != nil {
+		return nil, err
+	}
+	if err := writeHistory(agentID, target.Messages, target.Meta); err != nil {
+		return nil, err
+	}
+
+	// 目标分支已成为活动分支，消息以 Agent 的消息文件为准
+	count := len(target.Messages)
+	target.Messages, target.Meta = nil, nil
+	if err := saveBranches(agentID, state); err != nil {
+		return nil, err
+	}
+	return state.list(count), nil
+}
+
+// snapshot 将当前消息和模板、模型保存为活动分支的快照
+func (st *branchState) snapshot(current *agentHistory, params models.BranchParams) {
+	if active := st.find(st.Active); active != nil {
+		active.BranchParams = params
+		active.Messages = current.raws
+		active.Meta = current.metas
+		if active.Messages == nil {
+			active.Messages = []json.RawMessage{}
+		}
+	}
+}
+
+// find 查找分支
+func (st *branchState) find(branchID string) *branchRecord {
+	for _, record := range st.Branches {
+		if record.ID == branchID {
+			return record
+		}
+	}
+	return nil
+}
+
+// list 生成分支列表，activeCount 为活动分支当前的消息数
+func (st *branchState) list(activeCount int) *models.BranchList {
+	list := &models.BranchList{
+		Active:   st.Active,
+		Branches: make([]models.Branch, 0, len(st.Branches)),
+	}
+	for _, record := range st.Branches {
+		branch := record.Branch
+		branch.Active = record.ID == st.Active
+		if branch.Active {
+			branch.MessageCount = activeCount
+		} else {
+			branch.MessageCount = len(record.Messages)
+		}
+		list.Branches = append(list.Branches, branch)
+	}
+	return list
+}
+
+// loadBranches 加载分支树，尚未分叉过的会话只有根分支
+func loadBranches(agentID string, current *agentHistory) (*branchState, error) {
+	var state branchState
+	err := readJSONFile(filepath.Join(AgentDataPath(agentID), branchesFile), &state)
+	if err == nil {
+		return &state, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read branches: %w", err)
+	}
+
+	createdAt := time.Now()
+	if len(current.metas) > 0 {
+		createdAt = current.metas[0].Timestamp
+	}
+	return &branchState{
+		Active: RootBranchID,
+		Branches: []*branchRecord{
+			{Branch: models.Branch{ID: RootBranchID, CreatedAt: createdAt}},
+		},
+	}, nil
+}
+
+// saveBranches 保存分支树
+func saveBranches(agentID string, state *branchState) error {
+	if err := writeJSONFile(filepath.Join(AgentDataPath(agentID), branchesFile), state); err != nil {
+		return fmt.Errorf("failed to save branches: %w", err)
+	}
+	return nil
+}
+
+// lastUserMessage 最后一条用户文本消息的位置，不存在时返回 -1
+func lastUserMessage(messages []models.HistoryMessage) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if isEditable(messages[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isEditable 是否为用户发送的文本消息（不含工具结果）
+func isEditable(msg models.HistoryMessage) bool {
+	if msg.Role != "user" {
+		return false
+	}
+	hasText := false
+	for _, block := range msg.Blocks {
+		switch block.Type {
+		case models.BlockText:
+			hasText = true
+		case models.BlockToolResult:
+			return false
+		}
+	}
+	return hasText
+}
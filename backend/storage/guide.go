@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/google/uuid"
+)
+
+const guidesFile = ".agentsdk/guides.json"
+
+// guideData 持久化结构：ID -> 按版本递增排列的历史
+type guideData struct {
+	Glossaries  map[string][]*models.Glossary   `json:"glossaries"`
+	StyleGuides map[string][]*models.StyleGuide `json:"style_guides"`
+}
+
+// GuideStore 术语表与风格指南存储（带版本）
+type GuideStore struct {
+	mu       sync.RWMutex
+	data     guideData
+	filePath string
+}
+
+// NewGuideStore 创建术语表与风格指南存储
+func NewGuideStore() (*GuideStore, error) {
+	store := &GuideStore{
+		data: guideData{
+			Glossaries:  make(map[string][]*models.Glossary),
+			StyleGuides: make(map[string][]*models.StyleGuide),
+		},
+		filePath: guidesFile,
+	}
+
+	if err := readJSONFile(store.filePath, &store.data); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if store.data.Glossaries == nil {
+		store.data.Glossaries = make(map[string][]*models.Glossary)
+	}
+	if store.data.StyleGuides == nil {
+		store.data.StyleGuides = make(map[string][]*models.StyleGuide)
+	}
+
+	return store, nil
+}
+
+// CreateGlossary 创建术语表（版本 1）
+func (s *GuideStore) CreateGlossary(name string, terms []models.GlossaryTerm) (*models.Glossary, error) {
+	terms, err := normalizeTerms(terms)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	glossary := &models.Glossary{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Version:   1,
+		Terms:     terms,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.data.Glossaries[glossary.ID] = []*models.Glossary{glossary}
+
+	return glossary, s.save()
+}
+
+// UpdateGlossary 更新术语表，生成新版本
+func (s *GuideStore) UpdateGlossary(id, name string, terms []models.GlossaryTerm) (*models.Glossary, error) {
+	terms, err := normalizeTerms(terms)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions, ok := s.data.Glossaries[id]
+	if !ok {
+		return nil, fmt.Errorf("glossary %w: %s", ErrNotFound, id)
+	}
+
+	latest := versions[len(versions)-1]
+	glossary := &models.Glossary{
+		ID:        id,
+		Name:      name,
+		Version:   latest.Version + 1,
+		Terms:     terms,
+		CreatedAt: latest.CreatedAt,
+		UpdatedAt: time.Now(),
+	}
+	s.data.Glossaries[id] = append(versions, glossary)
+
+	return glossary, s.save()
+}
+
+// GetGlossary 获取术语表，version 为 0 时返回最新版本
+func (s *GuideStore) GetGlossary(id string, version int) (*models.Glossary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions, ok := s.data.Glossaries[id]
+	if !ok {
+		return nil, fmt.Errorf("glossary %w: %s", ErrNotFound, id)
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, g := range versions {
+		if g.Version == version {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("glossary %s version %d %w", id, version, ErrNotFound)
+}
+
+// ListGlossaries 列出所有术语表的最新版本
+func (s *GuideStore) ListGlossaries() []*models.Glossary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	glossaries := make([]*models.Glossary, 0, len(s.data.Glossaries))
+	for _, versions := range s.data.Glossaries {
+		glossaries = append(glossaries, versions[len(versions)-1])
+	}
+
+	sort.Slice(glossaries, func(i, j int) bool {
+		return glossaries[i].UpdatedAt.After(glossaries[j].UpdatedAt)
+	})
+	return glossaries
+}
+
+// GlossaryVersions 列出术语表的全部版本
+func (s *GuideStore) GlossaryVersions(id string) ([]*models.Glossary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions, ok := s.data.Glossaries[id]
+	if !ok {
+		return nil, fmt.Errorf("glossary %w: %s", ErrNotFound, id)
+	}
+	return versions, nil
+}
+
+// DeleteGlossary 删除术语表（包括所有版本）
+func (s *GuideStore) DeleteGlossary(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.Glossaries[id]; !ok {
+		return fmt.Errorf("glossary %w: %s", ErrNotFound, id)
+	}
+	delete(s.data.Glossaries, id)
+
+	return s.save()
+}
+
+// CreateStyleGuide 创建风格指南（版本 1）
+func (s *GuideStore) CreateStyleGuide(name, content string) (*models.StyleGuide, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	guide := &models.StyleGuide{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Version:   1,
+		Content:   content,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.data.StyleGuides[guide.ID] = []*models.StyleGuide{guide}
+
+	return guide, s.save()
+}
+
+// UpdateStyleGuide 更新风格指南，生成新版本
+func (s *GuideStore) UpdateStyleGuide(id, name, content string) (*models.StyleGuide, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions, ok := s.data.StyleGuides[id]
+	if !ok {
+		return nil, fmt.Errorf("style guide %w: %s", ErrNotFound, id)
+	}
+
+	latest := versions[len(versions)-1]
+	guide := &models.StyleGuide{
+		ID:        id,
+		Name:      name,
+		Version:   latest.Version + 1,
+		Content:   content,
+		CreatedAt: latest.CreatedAt,
+		UpdatedAt: time.Now(),
+	}
+	s.data.StyleGuides[id] = append(versions, guide)
+
+	return guide, s.save()
+}
+
+// GetStyleGuide 获取风格指南，version 为 0 时返回最新版本
+func (s *GuideStore) GetStyleGuide(id string, version int) (*models.StyleGuide, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions, ok := s.data.StyleGuides[id]
+	if !ok {
+		return nil, fmt.Errorf("style guide %w: %s", ErrNotFound, id)
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, g := range versions {
+		if g.Version == version {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("style guide %s version %d %w", id, version, ErrNotFound)
+}
+
+// ListStyleGuides 列出所有风格指南的最新版本
+func (s *GuideStore) ListStyleGuides() []*models.StyleGuide {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	guides := make([]*models.StyleGuide, 0, len(s.data.StyleGuides))
+	for _, versions := range s.data.StyleGuides {
+		guides = append(guides, versions[len(versions)-1])
+	}
+
+	sort.Slice(guides, func(i, j int) bool {
+		return guides[i].UpdatedAt.After(guides[j].UpdatedAt)
+	})
+	return guides
+}
+
+// StyleGuideVersions 列出风格指南的全部版本
+func (s *GuideStore) StyleGuideVersions(id string) ([]*models.StyleGuide, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions, ok := s.data.StyleGuides[id]
+	if !ok {
+		return nil, fmt.Errorf("style guide %w: %s", ErrNotFound, id)
+	}
+	return versions, nil
+}
+
+// DeleteStyleGuide 删除风格指南（包括所有版本）
+func (s *GuideStore) DeleteStyleGuide(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.StyleGuides[id]; !ok {
+		return fmt.Errorf("style guide %w: %s", ErrNotFound, id)
+	}
+	delete(s.data.StyleGuides, id)
+
+	return s.save()
+}
+
+// save 保存到文件（调用方需持有写锁）
+func (s *GuideStore) save() error {
+	return writeJSONFile(s.filePath, s.data)
+}
+
+// normalizeTerms 校验术语条目并补全默认类型
+func normalizeTerms(terms []models.GlossaryTerm) ([]models.GlossaryTerm, error) {
+	normalized := make([]models.GlossaryTerm, 0, len(terms))
+	for _, term := range terms {
+		term.Term = strings.TrimSpace(term.Term)
+		if term.Term == "" {
+			return nil, fmt.Errorf("glossary term must not be empty")
+		}
+
+		switch term.Type {
+		case "":
+			term.Type = models.TermTypePreferred
+		case models.TermTypePreferred, models.TermTypeBanned, models.TermTypeProduct:
+		default:
+			return nil, fmt.Errorf("invalid term type %q for %q", term.Type, term.Term)
+		}
+		normalized = append(normalized, term)
+	}
+	return normalized, nil
+}
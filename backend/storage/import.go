@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/google/uuid"
+)
+
+// ErrInvalidImport 导入的消息不能构成有效的对话历史
+var ErrInvalidImport = errors.New("invalid import")
+
+// Import 将消息写入为 Agent 的历史（用于导入外部对话记录），Agent 下次创建时即从这些消息继续对话
+// 消息只能包含文本、工具调用和工具结果块；连续的同角色消息会被合并。
+// 缺少时间戳的消息沿用前一条消息的时间（都没有时为导入时间）。返回写入的消息条数
+func (s *HistoryStore) Import(agentID string, messages []models.HistoryMessage) (int, error) {
+	messages, err := normalizeImport(messages)
+	if err != nil {
+		return 0, err
+	}
+
+	raws := make([]json.RawMessage, 0, len(messages))
+	metas := make([]messageMeta, 0, len(messages))
+	for _, msg := range messages {
+		content := make([]interface{}, 0, len(msg.Blocks))
+		for _, block := range msg.Blocks {
+			content = append(content, rawBlock(block))
+		}
+		raw, err := json.Marshal(map[string]interface{}{"role": msg.Role, "content": content})
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal message: %w", err)
+		}
+		raws = append(raws, raw)
+		metas = append(metas, messageMeta{
+			ID:          uuid.New().String(),
+			Fingerprint: messageFingerprint(raw),
+			Timestamp:   msg.Timestamp,
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeHistory(agentID, raws, metas); err != nil {
+		return 0, err
+	}
+	return len(raws), nil
+}
+
+// normalizeImport 合并连续的同角色消息、补齐时间戳，并检查对话结构：
+// 第一条为用户消息；每个工具调用的结果都在紧随其后的用户消息中
+func normalizeImport(messages []models.HistoryMessage) ([]models.HistoryMessage, error) {
+	var merged []models.HistoryMessage
+	for i, msg := range messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return nil, fmt.Errorf("%w: message %d has unsupported role %q", ErrInvalidImport, i, msg.Role)
+		}
+		for j, block := range msg.Blocks {
+			switch block.Type {
+			case models.BlockText:
+			case models.BlockToolUse:
+				if block.ID == "" || block.Name == "" {
+					return nil, fmt.Errorf("%w: message %d block %d: tool_use requires id and name", ErrInvalidImport, i, j)
+				}
+			case models.BlockToolResult:
+				if block.ToolUseID == "" {
+					return nil, fmt.Errorf("%w: message %d block %d: tool_result requires tool_use_id", ErrInvalidImport, i, j)
+				}
+			default:
+				return nil, fmt.Errorf("%w: message %d block %d: unsupported block type %q", ErrInvalidImport, i, j, block.Type)
+			}
+		}
+		if len(msg.Blocks) == 0 {
+			continue
+		}
+
+		if n := len(merged); n > 0 && merged[n-1].Role == msg.Role {
+			merged[n-1].Blocks = append(merged[n-1].Blocks, msg.Blocks...)
+			continue
+		}
+		msg.Blocks = append([]models.ContentBlock(nil), msg.Blocks...)
+		merged = append(merged, msg)
+	}
+
+	if len(merged) == 0 {
+		return nil, fmt.Errorf("%w: no messages", ErrInvalidImport)
+	}
+	if merged[0].Role != "user" {
+		return nil, fmt.Errorf("%w: the first message must be from the user", ErrInvalidImport)
+	}
+
+	for i, msg := range merged {
+		pending := map[string]bool{}
+		if i > 0 && merged[i-1].Role == "assistant" {
+			for _, block := range merged[i-1].Blocks {
+				if block.Type == models.BlockToolUse {
+					pending[block.ID] = true
+				}
+			}
+		}
+		for _, block := range msg.Blocks {
+			switch {
+			case block.Type == models.BlockToolUse && msg.Role != "assistant":
+				return nil, fmt.Errorf("%w: tool_use %s must be sent by the assistant", ErrInvalidImport, block.ID)
+			case block.Type == models.BlockToolResult && msg.Role != "user":
+				return nil, fmt.Errorf("%w: tool_result for %s must be sent by the user", ErrInvalidImport, block.ToolUseID)
+			case block.Type == models.BlockToolResult && !pending[block.ToolUseID]:
+				return nil, fmt.Errorf("%w: tool_result for %s does not follow its tool_use", ErrInvalidImport, block.ToolUseID)
+			case block.Type == models.BlockToolResult:
+				delete(pending, block.ToolUseID)
+			}
+		}
+		if msg.Role == "user" {
+			for id := range pending {
+				return nil, fmt.Errorf("%w: tool_use %s has no tool_result in the next message", ErrInvalidImport, id)
+			}
+		}
+	}
+	if last := merged[len(merged)-1]; last.Role == "assistant" {
+		for _, block := range last.Blocks {
+			if block.Type == models.BlockToolUse {
+				return nil, fmt.Errorf("%w: tool_use %s has no tool_result", ErrInvalidImport, block.ID)
+			}
+		}
+	}
+
+	// 补齐时间戳：沿用前一条，开头缺少的取第一个已知时间
+	var known time.Time
+	for _, msg := range merged {
+		if !msg.Timestamp.IsZero() {
+			known = msg.Timestamp
+			break
+		}
+	}
+	if known.IsZero() {
+		known = time.Now()
+	}
+	for i := range merged {
+		if merged[i].Timestamp.IsZero() {
+			merged[i].Timestamp = known
+		}
+		known = merged[i].Timestamp
+	}
+	return merged, nil
+}
+
+// rawBlock 将内容块转换为 Agent Store 的格式
+func rawBlock(block models.ContentBlock) map[string]interface{} {
+	switch block.Type {
+	case models.BlockToolUse:
+		input := block.Input
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		return map[string]interface{}{"type": block.Type, "id": block.ID, "name": block.Name, "input": input}
+	case models.BlockToolResult:
+		output := block.Output
+		if output == nil {
+			output = ""
+		}
+		result := map[string]interface{}{"type": block.Type, "tool_use_id": block.ToolUseID, "content": output}
+		if block.IsError {
+			result["is_error"] = true
+		}
+		return result
+	default:
+		return map[string]interface{}{"type": models.BlockText, "text": block.Text}
+	}
+}
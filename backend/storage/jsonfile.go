@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotFound 记录不存在
+var ErrNotFound = errors.New("not found")
+
+// readJSONFile 从文件读取 JSON，文件不存在时返回 os.ErrNotExist
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unmarshal %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// writeJSONFile 将数据以 JSON 格式原子写入文件
+// 先写入同目录的临时文件并 fsync，再重命名覆盖目标文件，写入中途崩溃不会留下截断的文件
+func writeJSONFile(path string, v interface{}) error {
+	return writeJSONFileWithBackups(path, v, 0)
+}
+
+// writeJSONFileWithBackups 原子写入文件，并保留最近 backups 个旧版本（path.bak.1 最新）
+func writeJSONFileWithBackups(path string, v interface{}, backups int) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", filepath.Base(path), err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // 重命名成功后为空操作
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+
+	if backups > 0 {
+		if err := rotateBackups(path, backups); err != nil {
+			// 备份失败不影响本次写入
+			log.Printf("[Storage] Failed to rotate backups of %s: %v", path, err)
+		}
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("replace %s: %w", filepath.Base(path), err)
+	}
+	syncDir(dir)
+	return nil
+}
+
+// readJSONFileWithRecovery 读取 JSON 文件；主文件损坏或丢失时从最新的有效备份恢复
+// 恢复时损坏的主文件保留为 path.corrupt-<时间戳>，并用备份内容重写主文件
+func readJSONFileWithRecovery(path string, v interface{}, backups int) error {
+	err := readJSONFile(path, v)
+	if err == nil {
+		return nil
+	}
+	mainMissing := errors.Is(err, os.ErrNotExist)
+
+	for i := 1; i <= backups; i++ {
+		backup := backupPath(path, i)
+		data, readErr := os.ReadFile(backup)
+		if readErr != nil {
+			continue
+		}
+		if json.Unmarshal(data, v) != nil {
+			log.Printf("[Storage] Backup %s is also corrupt, skipping", backup)
+			continue
+		}
+
+		if mainMissing {
+			log.Printf("[Storage] %s is missing, recovered from %s", path, backup)
+		} else {
+			corrupt := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+			if renameErr := os.Rename(path, corrupt); renameErr != nil {
+				return fmt.Errorf("%v (and failed to set corrupt file aside: %w)", err, renameErr)
+			}
+			log.Printf("[Storage] %s is corrupt (%v), moved to %s and recovered from %s", path, err, corrupt, backup)
+		}
+
+		if err := copyFile(backup, path); err != nil {
+			return fmt.Errorf("restore %s from %s: %w", filepath.Base(path), backup, err)
+		}
+		return nil
+	}
+
+	return err
+}
+
+// rotateBackups 轮转备份：path.bak.N-1 -> path.bak.N ... path -> path.bak.1
+func rotateBackups(path string, backups int) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	os.Remove(backupPath(path, backups))
+	for i := backups - 1; i >= 1; i-- {
+		if err := os.Rename(backupPath(path, i), backupPath(path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// 主文件随后会被重命名覆盖，这里用硬链接保留旧版本，不支持时退回复制
+	if err := os.Link(path, backupPath(path, 1)); err != nil {
+		return copyFile(path, backupPath(path, 1))
+	}
+	return nil
+}
+
+// backupPath 第 n 个备份的路径
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", path, n)
+}
+
+// copyFile 复制文件（先写临时文件再重命名）
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// syncDir fsync 目录，确保重命名落盘（部分平台不支持，忽略错误）
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
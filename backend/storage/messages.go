@@ -0,0 +1,439 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/google/uuid"
+)
+
+const (
+	messagesFile     = "messages.json"      // Agent Store 写入的消息文件
+	messagesMetaFile = "messages_meta.json" // 消息 ID 和时间戳的旁路文件
+
+	// DefaultHistoryLimit 历史消息默认每页条数
+	DefaultHistoryLimit = 50
+	// MaxHistoryLimit 历史消息每页最大条数
+	MaxHistoryLimit = 200
+
+	// StoppedPlaceholder 轮次在生成任何内容前被中止时保存的助手消息
+	StoppedPlaceholder = "(stopped)"
+)
+
+// rawMessage Agent Store 中的消息（content 块按原样保留）
+type rawMessage struct {
+	Role    string            `json:"role"`
+	Content []json.RawMessage `json:"content"`
+}
+
+// messageMeta 消息的 ID 和时间戳
+// Fingerprint 为消息内容的摘要，用于识别 Agent 历史被截断或改写后的消息
+type messageMeta struct {
+	ID          string    `json:"id"`
+	Fingerprint string    `json:"fingerprint"`
+	Timestamp   time.Time `json:"timestamp"`
+	Stopped     bool      `json:"stopped,omitempty"`
+}
+
+// HistoryStore 会话消息历史
+// 消息内容仍由 Agent Store 保存；HistoryStore 在旁路文件中为每条消息记录稳定的 ID 和首次写入的时间
+type HistoryStore struct {
+	mu sync.Mutex
+}
+
+// NewHistoryStore 创建消息历史存储
+func NewHistoryStore() *HistoryStore {
+	return &HistoryStore{}
+}
+
+// Sync 读取 Agent 的全部消息，为新消息分配 ID 和时间戳并保存
+func (s *HistoryStore) Sync(agentID string) ([]models.HistoryMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, err := loadHistory(agentID, true)
+	if err != nil {
+		return nil, err
+	}
+	return h.messages, nil
+}
+
+// Page 按游标分页获取消息历史（按时间正序）
+func (s *HistoryStore) Page(agentID string, query models.HistoryQuery) (*models.MessagePage, error) {
+	messages, err := s.Sync(agentID)
+	if err != nil {
+		return nil, err
+	}
+	return paginate(messages, query)
+}
+
+// LoadAgentMessages 加载 Agent 的消息文本（只读，不分配新的消息 ID）
+func LoadAgentMessages(agentID string) ([]models.Message, error) {
+	history, err := loadHistory(agentID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]models.Message, 0, len(history.messages))
+	for _, msg := range history.messages {
+		messages = append(messages, models.Message{
+			Role:      msg.Role,
+			Content:   msg.Content,
+			Timestamp: msg.Timestamp,
+		})
+	}
+	return messages, nil
+}
+
+// agentHistory Agent 的原始消息及对齐后的元数据
+type agentHistory struct {
+	raws     []json.RawMessage
+	metas    []messageMeta
+	messages []models.HistoryMessage
+}
+
+// loadHistory 解析 Agent 的消息文件，并与旁路文件中的 ID 和时间戳对齐
+// 新消息的时间戳取消息文件的修改时间（即 Agent 写入该消息的时间）；
+// 某条消息的内容与记录不一致时（历史被截断或改写），从该条起重新分配 ID
+func loadHistory(agentID string, persist bool) (*agentHistory, error) {
+	messagesPath := filepath.Join(AgentDataPath(agentID), messagesFile)
+	info, err := os.Stat(messagesPath)
+	if os.IsNotExist(err) {
+		return &agentHistory{messages: []models.HistoryMessage{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var raws []json.RawMessage
+	if err := readJSONFile(messagesPath, &raws); err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	metaPath := filepath.Join(AgentDataPath(agentID), messagesMetaFile)
+	var metas []messageMeta
+	if err := readJSONFile(metaPath, &metas); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read message metadata: %w", err)
+	}
+
+	history := make([]models.HistoryMessage, 0, len(raws))
+	updated := make([]messageMeta, 0, len(raws))
+	changed := len(metas) != len(raws)
+	matching := true
+	for i, raw := range raws {
+		var msg rawMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal message %d: %w", i, err)
+		}
+
+		fingerprint := messageFingerprint(raw)
+		if !matching || i >= len(metas) || metas[i].Fingerprint != fingerprint {
+			matching = false
+			changed = true
+		}
+
+		var meta messageMeta
+		if matching {
+			meta = metas[i]
+		} else {
+			meta = messageMeta{ID: uuid.New().String(), Fingerprint: fingerprint, Timestamp: info.ModTime()}
+		}
+		updated = append(updated, meta)
+
+		blocks := parseBlocks(msg.Content)
+		history = append(history, models.HistoryMessage{
+			ID:        meta.ID,
+			Role:      msg.Role,
+			Content:   blockText(blocks),
+			Blocks:    blocks,
+			Timestamp: meta.Timestamp,
+			Stopped:   meta.Stopped,
+		})
+	}
+
+	if persist && changed {
+		if err := writeJSONFile(metaPath, updated); err != nil {
+			return nil, fmt.Errorf("failed to save message metadata: %w", err)
+		}
+	}
+
+	return &agentHistory{raws: raws, metas: updated, messages: history}, nil
+}
+
+// Stop 在被中止的轮次末尾整理历史，使 Agent 可以继续对话，返回标记为已停止的助手消息
+// message 为该轮的用户消息，Agent 尚未保存时补上；没有结果的工具调用补上错误结果；
+// 中止前已生成但尚未保存的回复（partial）保存为助手消息，什么都没有生成时保存 StoppedPlaceholder。
+// 调用前需关闭 Agent，之后重新创建
+func (s *HistoryStore) Stop(agentID, message, partial string) (*models.HistoryMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := loadHistory(agentID, true)
+	if err != nil {
+		return nil, err
+	}
+	raws, metas := current.raws, current.metas
+	add := func(role string, blocks ...models.ContentBlock) error {
+		content := make([]interface{}, 0, len(blocks))
+		for _, block := range blocks {
+			content = append(content, rawBlock(block))
+		}
+		raw, err := json.Marshal(map[string]interface{}{"role": role, "content": content})
+		if err != nil {
+			return err
+		}
+		raws = append(raws, raw)
+		metas = append(metas, messageMeta{ID: uuid.New().String(), Fingerprint: messageFingerprint(raw), Timestamp: time.Now()})
+		return nil
+	}
+
+	reply := partial
+	if strings.TrimSpace(reply) == "" {
+		reply = StoppedPlaceholder
+	}
+	text := models.ContentBlock{Type: models.BlockText, Text: reply}
+
+	saved := false
+	if i := lastUserMessage(current.messages); i >= 0 {
+		saved = strings.TrimSpace(current.messages[i].Content) == strings.TrimSpace(message)
+	}
+
+	var last models.HistoryMessage
+	if len(current.messages) > 0 {
+		last = current.messages[len(current.messages)-1]
+	}
+	var pending []models.ContentBlock
+	if saved && last.Role == "assistant" {
+		for _, block := range last.Blocks {
+			if block.Type == models.BlockToolUse {
+				pending = append(pending, models.ContentBlock{
+					Type:      models.BlockToolResult,
+					ToolUseID: block.ID,
+					Output:    "interrupted: the user stopped this turn",
+					IsError:   true,
+				})
+			}
+		}
+	}
+
+	switch {
+	case !saved:
+		// 中止时 Agent 还没有保存本轮的用户消息
+		if err := add("user", models.ContentBlock{Type: models.BlockText, Text: message}); err != nil {
+			return nil, err
+		}
+		err = add("assistant", text)
+	case len(pending) > 0:
+		// 中止在工具调用中：补上工具结果，再保存部分回复
+		if err := add("user", pending...); err != nil {
+			return nil, err
+		}
+		err = add("assistant", text)
+	case last.Role == "assistant":
+		// 回复已由 Agent 保存，只在缺少中止前的内容时补充
+		if strings.TrimSpace(partial) == "" || strings.HasSuffix(strings.TrimSpace(last.Content), strings.TrimSpace(partial)) {
+			break
+		}
+		var msg rawMessage
+		if err := json.Unmarshal(raws[len(raws)-1], &msg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+		}
+		block, _ := json.Marshal(rawBlock(text))
+		msg.Content = append(msg.Content, block)
+		raw, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		raws = append(raws[:len(raws)-1:len(raws)-1], raw)
+		meta := metas[len(metas)-1]
+		meta.Fingerprint = messageFingerprint(raw)
+		metas = append(metas[:len(metas)-1:len(metas)-1], meta)
+	default:
+		err = add("assistant", text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	metas[len(metas)-1].Stopped = true
+	if err := writeHistory(agentID, raws, metas); err != nil {
+		return nil, err
+	}
+
+	updated, err := loadHistory(agentID, false)
+	if err != nil {
+		return nil, err
+	}
+	stopped := updated.messages[len(updated.messages)-1]
+	return &stopped, nil
+}
+
+// writeHistory 用给定的原始消息和元数据替换 Agent 的消息文件（调用方需先关闭 Agent）
+func writeHistory(agentID string, raws []json.RawMessage, metas []messageMeta) error {
+	if raws == nil {
+		raws = []json.RawMessage{}
+	}
+	if metas == nil {
+		metas = []messageMeta{}
+	}
+
+	dir := AgentDataPath(agentID)
+	if err := writeJSONFile(filepath.Join(dir, messagesFile), raws); err != nil {
+		return fmt.Errorf("failed to write messages: %w", err)
+	}
+	if err := writeJSONFile(filepath.Join(dir, messagesMetaFile), metas); err != nil {
+		return fmt.Errorf("failed to write message metadata: %w", err)
+	}
+	return nil
+}
+
+// paginate 按游标截取一页消息
+func paginate(messages []models.HistoryMessage, query models.HistoryQuery) (*models.MessagePage, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+
+	start, end := len(messages)-limit, len(messages)
+	hasMore := start > 0
+	switch {
+	case query.Before != "":
+		i := indexOfMessage(messages, query.Before)
+		if i < 0 {
+			return nil, fmt.Errorf("message %w: %s", ErrNotFound, query.Before)
+		}
+		start, end = i-limit, i
+		hasMore = start > 0
+	case query.After != "":
+		i := indexOfMessage(messages, query.After)
+		if i < 0 {
+			return nil, fmt.Errorf("message %w: %s", ErrNotFound, query.After)
+		}
+		start, end = i+1, i+1+limit
+		hasMore = end < len(messages)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > len(messages) {
+		end = len(messages)
+	}
+
+	page := &models.MessagePage{
+		Messages: messages[start:end],
+		Total:    len(messages),
+		HasMore:  hasMore,
+	}
+	if len(page.Messages) > 0 {
+		page.Before = page.Messages[0].ID
+		page.After = page.Messages[len(page.Messages)-1].ID
+	}
+	return page, nil
+}
+
+// indexOfMessage 查找消息位置，不存在时返回 -1
+func indexOfMessage(messages []models.HistoryMessage, id string) int {
+	for i, msg := range messages {
+		if msg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseBlocks 解析消息内容块
+// 块类型优先取 type 字段，缺省时按字段推断（text / name / tool_use_id）
+func parseBlocks(content []json.RawMessage) []models.ContentBlock {
+	blocks := make([]models.ContentBlock, 0, len(content))
+	for _, raw := range content {
+		var block struct {
+			Type      string          `json:"type"`
+			Text      *string         `json:"text"`
+			ID        string          `json:"id"`
+			Name      string          `json:"name"`
+			Input     json.RawMessage `json:"input"`
+			ToolUseID string          `json:"tool_use_id"`
+			Content   interface{}     `json:"content"`
+			IsError   bool            `json:"is_error"`
+		}
+		if err := json.Unmarshal(raw, &block); err != nil {
+			blocks = append(blocks, models.ContentBlock{Type: "unknown", Raw: raw})
+			continue
+		}
+
+		blockType := block.Type
+		if blockType == "" {
+			switch {
+			case block.Text != nil:
+				blockType = models.BlockText
+			case block.ToolUseID != "":
+				blockType = models.BlockToolResult
+			case block.Name != "":
+				blockType = models.BlockToolUse
+			}
+		}
+
+		switch blockType {
+		case models.BlockText:
+			text := ""
+			if block.Text != nil {
+				text = *block.Text
+			}
+			blocks = append(blocks, models.ContentBlock{Type: models.BlockText, Text: text})
+		case models.BlockToolUse:
+			blocks = append(blocks, models.ContentBlock{
+				Type:  models.BlockToolUse,
+				ID:    block.ID,
+				Name:  block.Name,
+				Input: block.Input,
+			})
+		case models.BlockToolResult:
+			blocks = append(blocks, models.ContentBlock{
+				Type:      models.BlockToolResult,
+				ToolUseID: block.ToolUseID,
+				Output:    block.Content,
+				IsError:   block.IsError,
+			})
+		default:
+			if blockType == "" {
+				blockType = "unknown"
+			}
+			blocks = append(blocks, models.ContentBlock{Type: blockType, Raw: raw})
+		}
+	}
+	return blocks
+}
+
+// blockText 拼接消息中的文本块
+func blockText(blocks []models.ContentBlock) string {
+	var parts []string
+	for _, block := range blocks {
+		if block.Type == models.BlockText && block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// messageFingerprint 计算消息内容摘要（忽略 JSON 格式差异）
+func messageFingerprint(raw json.RawMessage) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		compact.Reset()
+		compact.Write(raw)
+	}
+	sum := sha256.Sum256(compact.Bytes())
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+)
+
+const (
+	presetsFile    = ".agentsdk/workflow_presets.json"
+	presetRunsKeep = 20 // 每个预设保留的最近运行记录数
+)
+
+// ErrPresetNameTaken 预设名称已被使用
+var ErrPresetNameTaken = errors.New("preset name already in use")
+
+// PresetStore 工作流预设存储
+type PresetStore struct {
+	mu       sync.RWMutex
+	presets  map[string]*models.WorkflowPreset
+	filePath string
+}
+
+// NewPresetStore 创建工作流预设存储
+func NewPresetStore() (*PresetStore, error) {
+	store := &PresetStore{
+		presets:  make(map[string]*models.WorkflowPreset),
+		filePath: presetsFile,
+	}
+
+	var presets []*models.WorkflowPreset
+	if err := readJSONFile(store.filePath, &presets); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, p := range presets {
+		store.presets[p.ID] = p
+	}
+
+	return store, nil
+}
+
+// Create 保存新的预设，名称不能重复
+func (s *PresetStore) Create(preset *models.WorkflowPreset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.presets[preset.ID]; ok {
+		return fmt.Errorf("preset already exists: %s", preset.ID)
+	}
+	if err := s.checkName(preset); err != nil {
+		return err
+	}
+
+	preset.CreatedAt = time.Now()
+	preset.UpdatedAt = preset.CreatedAt
+	if preset.Runs == nil {
+		preset.Runs = []models.PresetRun{}
+	}
+	s.presets[preset.ID] = copyPreset(preset)
+
+	return s.save()
+}
+
+// Get 按 ID 或名称获取预设
+func (s *PresetStore) Get(idOrName string) (*models.WorkflowPreset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if preset, ok := s.presets[idOrName]; ok {
+		return copyPreset(preset), nil
+	}
+	for _, preset := range s.presets {
+		if preset.Name == idOrName {
+			return copyPreset(preset), nil
+		}
+	}
+	return nil, fmt.Errorf("preset %w: %s", ErrNotFound, idOrName)
+}
+
+// List 列出所有预设（按创建时间排序）
+func (s *PresetStore) List() []*models.WorkflowPreset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	presets := make([]*models.WorkflowPreset, 0, len(s.presets))
+	for _, p := range s.presets {
+		presets = append(presets, copyPreset(p))
+	}
+
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].CreatedAt.Before(presets[j].CreatedAt)
+	})
+	return presets
+}
+
+// Modify 在写锁内修改预设并保存，运行记录只保留最近的若干条；fn 返回错误时不保存
+func (s *PresetStore) Modify(id string, fn func(preset *models.WorkflowPreset) error) (*models.WorkflowPreset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.presets[id]
+	if !ok {
+		return nil, fmt.Errorf("preset %w: %s", ErrNotFound, id)
+	}
+
+	preset := copyPreset(existing)
+	if err := fn(preset); err != nil {
+		return nil, err
+	}
+	preset.ID = existing.ID
+	preset.CreatedAt = existing.CreatedAt
+	if err := s.checkName(preset); err != nil {
+		return nil, err
+	}
+	if len(preset.Runs) > presetRunsKeep {
+		preset.Runs = preset.Runs[:presetRunsKeep]
+	}
+	s.presets[id] = preset
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return copyPreset(preset), nil
+}
+
+// Delete 删除预设
+func (s *PresetStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.presets[id]; !ok {
+		return fmt.Errorf("preset %w: %s", ErrNotFound, id)
+	}
+	delete(s.presets, id)
+
+	return s.save()
+}
+
+// checkName 检查名称是否被其他预设使用（调用方需持有写锁）
+func (s *PresetStore) checkName(preset *models.WorkflowPreset) error {
+	for _, p := range s.presets {
+		if p.ID != preset.ID && p.Name == preset.Name {
+			return fmt.Errorf("%w: %s", ErrPresetNameTaken, preset.Name)
+		}
+	}
+	return nil
+}
+
+// copyPreset 复制预设（包括参数和运行记录），避免与调用方共享切片
+func copyPreset(preset *models.WorkflowPreset) *models.WorkflowPreset {
+	result := *preset
+	result.Parameters = append([]models.PresetParameter{}, preset.Parameters...)
+	result.Runs = append([]models.PresetRun{}, preset.Runs...)
+	return &result
+}
+
+// save 保存到文件（调用方需持有写锁）
+func (s *PresetStore) save() error {
+	presets := make([]*models.WorkflowPreset, 0, len(s.presets))
+	for _, p := range s.presets {
+		presets = append(presets, p)
+	}
+	return writeJSONFile(s.filePath, presets)
+}
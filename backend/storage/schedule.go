@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+)
+
+const (
+	schedulesFile    = ".agentsdk/schedules.json"
+	scheduleRunsKeep = 50 // 每个定时工作流保留的最近运行记录数
+)
+
+// ScheduleStore 定时工作流存储
+type ScheduleStore struct {
+	mu        sync.RWMutex
+	schedules map[string]*models.WorkflowSchedule
+	filePath  string
+}
+
+// NewScheduleStore 创建定时工作流存储
+func NewScheduleStore() (*ScheduleStore, error) {
+	store := &ScheduleStore{
+		schedules: make(map[string]*models.WorkflowSchedule),
+		filePath:  schedulesFile,
+	}
+
+	var schedules []*models.WorkflowSchedule
+	if err := readJSONFile(store.filePath, &schedules); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, s := range schedules {
+		store.schedules[s.ID] = s
+	}
+
+	return store, nil
+}
+
+// Create 保存新的定时工作流
+func (s *ScheduleStore) Create(schedule *models.WorkflowSchedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[schedule.ID]; ok {
+		return fmt.Errorf("schedule already exists: %s", schedule.ID)
+	}
+
+	schedule.CreatedAt = time.Now()
+	schedule.UpdatedAt = schedule.CreatedAt
+	if schedule.Runs == nil {
+		schedule.Runs = []models.ScheduleRun{}
+	}
+	s.schedules[schedule.ID] = copySchedule(schedule)
+
+	return s.save()
+}
+
+// Get 获取定时工作流
+func (s *ScheduleStore) Get(id string) (*models.WorkflowSchedule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return nil, fmt.Errorf("schedule %w: %s", ErrNotFound, id)
+	}
+	return copySchedule(schedule), nil
+}
+
+// List 列出所有定时工作流（按创建时间排序）
+func (s *ScheduleStore) List() []*models.WorkflowSchedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedules := make([]*models.WorkflowSchedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, copySchedule(schedule))
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+	return schedules
+}
+
+// Modify 在写锁内修改定时工作流并保存，运行记录只保留最近的若干条；fn 返回错误时不保存
+func (s *ScheduleStore) Modify(id string, fn func(schedule *models.WorkflowSchedule) error) (*models.WorkflowSchedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.schedules[id]
+	if !ok {
+		return nil, fmt.Errorf("schedule %w: %s", ErrNotFound, id)
+	}
+
+	schedule := copySchedule(existing)
+	if err := fn(schedule); err != nil {
+		return nil, err
+	}
+	schedule.ID = existing.ID
+	schedule.CreatedAt = existing.CreatedAt
+	if len(schedule.Runs) > scheduleRunsKeep {
+		schedule.Runs = schedule.Runs[:scheduleRunsKeep]
+	}
+	s.schedules[id] = schedule
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return copySchedule(schedule), nil
+}
+
+// Delete 删除定时工作流
+func (s *ScheduleStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[id]; !ok {
+		return fmt.Errorf("schedule %w: %s", ErrNotFound, id)
+	}
+	delete(s.schedules, id)
+
+	return s.save()
+}
+
+// copySchedule 复制定时工作流（包括运行记录），避免与调用方共享切片
+func copySchedule(schedule *models.WorkflowSchedule) *models.WorkflowSchedule {
+	result := *schedule
+	result.Runs = append([]models.ScheduleRun{}, schedule.Runs...)
+	return &result
+}
+
+// save 保存到文件（调用方需持有写锁）
+func (s *ScheduleStore) save() error {
+	schedules := make([]*models.WorkflowSchedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule)
+	}
+	return writeJSONFile(s.filePath, schedules)
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+)
+
+// DefaultSessionsFile JSON 会话存储的默认文件
+const DefaultSessionsFile = ".agentsdk/sessions.json"
+
+// 会话文件保留的备份数（sessions.json.bak.1 ~ .bak.N）
+const sessionBackups = 5
+
+// JSONSessionStore 基于单个 JSON 文件的会话存储（默认后端）
+// 每次写入都会重写整个文件，适合单进程、会话数量不多的场景
+type JSONSessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*models.Session
+	filePath string
+}
+
+// NewJSONSessionStore 创建 JSON 会话存储，filePath 为空时使用默认文件
+func NewJSONSessionStore(filePath string) (*JSONSessionStore, error) {
+	if filePath == "" {
+		filePath = DefaultSessionsFile
+	}
+	store := &JSONSessionStore{
+		sessions: make(map[string]*models.Session),
+		filePath: filePath,
+	}
+
+	// 确保目录存在
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create sessions directory: %w", err)
+	}
+
+	// 加载现有会话
+	if err := store.load(); err != nil {
+		// 如果文件不存在，忽略错误
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+// Create 创建新会话
+func (s *JSONSessionStore) Create(session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.CreatedAt = time.Now()
+	session.UpdatedAt = time.Now()
+	s.sessions[session.ID] = session
+
+	return s.save()
+}
+
+// Get 获取会话
+func (s *JSONSessionStore) Get(id string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("session %w: %s", ErrNotFound, id)
+	}
+
+	// 向后兼容：为旧会话设置默认 AgentType
+	if session.AgentType == "" {
+		session.AgentType = "simple-chat"
+	}
+
+	return session, nil
+}
+
+// List 列出所有会话
+func (s *JSONSessionStore) List() ([]*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]*models.Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+
+	// 按更新时间倒序排序
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+// Query 按条件查询会话，返回当前页和符合条件的总数
+func (s *JSONSessionStore) Query(filter models.SessionFilter) ([]*models.Session, int, error) {
+	sessions, err := s.List()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matched, total := filterSessions(sessions, filter)
+	return matched, total, nil
+}
+
+// Import 导入会话，保留原有的创建和更新时间；同 ID 的会话会被覆盖
+func (s *JSONSessionStore) Import(session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = session
+	return s.save()
+}
+
+// Update 更新会话
+func (s *JSONSessionStore) Update(session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; !ok {
+		return fmt.Errorf("session %w: %s", ErrNotFound, session.ID)
+	}
+
+	session.UpdatedAt = time.Now()
+	s.sessions[session.ID] = session
+
+	return s.save()
+}
+
+// Delete 删除会话
+func (s *JSONSessionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[id]; !ok {
+		return fmt.Errorf("session %w: %s", ErrNotFound, id)
+	}
+
+	delete(s.sessions, id)
+
+	return s.save()
+}
+
+// Close 关闭存储（JSON 存储无需释放资源）
+func (s *JSONSessionStore) Close() error {
+	return nil
+}
+
+// load 从文件加载会话，文件损坏时自动从最新的有效备份恢复
+func (s *JSONSessionStore) load() error {
+	var sessions []*models.Session
+	if err := readJSONFileWithRecovery(s.filePath, &sessions, sessionBackups); err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		s.sessions[session.ID] = session
+	}
+
+	return nil
+}
+
+// save 原子写入会话文件，并轮转备份
+func (s *JSONSessionStore) save() error {
+	sessions := make([]*models.Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+
+	return writeJSONFileWithBackups(s.filePath, sessions, sessionBackups)
+}
@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+	_ "github.com/lib/pq"  // Postgres 驱动
+	_ "modernc.org/sqlite" // SQLite 驱动（纯 Go，无需 CGO）
+)
+
+// DefaultSessionsDB SQLite 会话存储的默认数据库文件
+const DefaultSessionsDB = ".agentsdk/sessions.db"
+
+// 会话表：常用过滤和排序字段单独成列，完整会话以 JSON 保存在 data 列
+const sessionsSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id         TEXT PRIMARY KEY,
+	agent_type TEXT NOT NULL,
+	pinned     BOOLEAN NOT NULL DEFAULT FALSE,
+	archived   BOOLEAN NOT NULL DEFAULT FALSE,
+	updated_at BIGINT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_order ON sessions (pinned DESC, updated_at DESC);
+CREATE TABLE IF NOT EXISTS session_tags (
+	session_id TEXT NOT NULL,
+	tag        TEXT NOT NULL,
+	PRIMARY KEY (session_id, tag)
+);
+CREATE INDEX IF NOT EXISTS idx_session_tags_tag ON session_tags (tag);
+`
+
+// likeEscaper 转义 LIKE 模式中的通配符（配合 ESCAPE '\'）
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SQLSessionStore 基于 database/sql 的会话存储，支持 SQLite 和 Postgres
+type SQLSessionStore struct {
+	db       *sql.DB
+	postgres bool // Postgres 使用 $n 占位符
+}
+
+// NewSQLiteSessionStore 创建 SQLite 会话存储，path 为空时使用默认数据库文件
+func NewSQLiteSessionStore(path string) (*SQLSessionStore, error) {
+	if path == "" {
+		path = DefaultSessionsDB
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create sessions directory: %w", err)
+	}
+
+	// WAL + busy_timeout 允许多个进程同时访问
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+
+	return newSQLSessionStore(db, false)
+}
+
+// NewPostgresSessionStore 创建 Postgres 会话存储
+func NewPostgresSessionStore(dsn string) (*SQLSessionStore, error) {
+	if dsn == "" {
+		return nil, errors.New("postgres session store requires a DSN")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres: %w", err)
+	}
+
+	return newSQLSessionStore(db, true)
+}
+
+// newSQLSessionStore 检查连接并初始化表结构
+func newSQLSessionStore(db *sql.DB, postgres bool) (*SQLSessionStore, error) {
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect session database: %w", err)
+	}
+
+	for _, stmt := range strings.Split(sessionsSchema, ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create sessions table: %w", err)
+		}
+	}
+
+	store := &SQLSessionStore{db: db, postgres: postgres}
+	if err := store.backfillTags(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// backfillTags 标签表为空时从会话数据中补全（标签表加入之前创建的数据库）
+func (s *SQLSessionStore) backfillTags() error {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM session_tags`).Scan(&count); err != nil {
+		return fmt.Errorf("count session tags: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	sessions, err := s.List()
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if len(session.Tags) == 0 {
+			continue
+		}
+		if err := s.exec(func(tx *sql.Tx) error {
+			return s.writeTags(tx, session.ID, session.Tags)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create 创建新会话
+func (s *SQLSessionStore) Create(session *models.Session) error {
+	now := time.Now()
+	session.CreatedAt = now
+	session.UpdatedAt = now
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("marshal session: %w", err)
+	}
+
+	return s.exec(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.rebind(`INSERT INTO sessions (id, agent_type, pinned, archived, updated_at, data) VALUES (?, ?, ?, ?, ?, ?)`),
+			session.ID, session.AgentType, session.Pinned, session.Archived, session.UpdatedAt.UnixNano(), string(data))
+		if err != nil {
+			return fmt.Errorf("insert session: %w", err)
+		}
+		return s.writeTags(tx, session.ID, session.Tags)
+	})
+}
+
+// Get 获取会话
+func (s *SQLSessionStore) Get(id string) (*models.Session, error) {
+	var data string
+	err := s.db.QueryRow(s.rebind(`SELECT data FROM sessions WHERE id = ?`), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("session %w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query session: %w", err)
+	}
+
+	return decodeSession(data)
+}
+
+// List 列出所有会话
+func (s *SQLSessionStore) List() ([]*models.Session, error) {
+	return s.query(`SELECT data FROM sessions ORDER BY updated_at DESC`)
+}
+
+// Query 按条件查询会话，过滤和分页都在数据库中完成
+// 关键词只搜索标题（不读取消息文件），全文搜索仅 JSON 后端支持
+func (s *SQLSessionStore) Query(filter models.SessionFilter) ([]*models.Session, int, error) {
+	where := make([]string, 0, 4)
+	args := make([]interface{}, 0, 4)
+	if filter.AgentType != "" {
+		where = append(where, "agent_type = ?")
+		args = append(args, filter.AgentType)
+	}
+	if filter.Archived != nil {
+		where = append(where, "archived = ?")
+		args = append(args, *filter.Archived)
+	}
+	if filter.Tag != "" {
+		where = append(where, "id IN (SELECT session_id FROM session_tags WHERE tag = ?)")
+		args = append(args, filter.Tag)
+	}
+	if query := strings.ToLower(strings.TrimSpace(filter.Query)); query != "" {
+		title := "json_extract(data, '$.title')"
+		if s.postgres {
+			title = "(data::jsonb ->> 'title')"
+		}
+		where = append(where, "LOWER("+title+`) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(query)+"%")
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow(s.rebind(`SELECT COUNT(*) FROM sessions`+cond), args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count sessions: %w", err)
+	}
+
+	page := `SELECT data FROM sessions` + cond + ` ORDER BY pinned DESC, updated_at DESC`
+	if filter.Limit > 0 {
+		page += " LIMIT " + strconv.Itoa(filter.Limit)
+	} else if !s.postgres {
+		page += " LIMIT -1" // SQLite 的 OFFSET 必须跟在 LIMIT 之后
+	}
+	page += " OFFSET " + strconv.Itoa(filter.Offset)
+
+	sessions, err := s.query(page, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return sessions, total, nil
+}
+
+// Update 更新会话
+func (s *SQLSessionStore) Update(session *models.Session) error {
+	session.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("marshal session: %w", err)
+	}
+
+	return s.exec(func(tx *sql.Tx) error {
+		result, err := tx.Exec(s.rebind(`UPDATE sessions SET agent_type = ?, pinned = ?, archived = ?, updated_at = ?, data = ? WHERE id = ?`),
+			session.AgentType, session.Pinned, session.Archived, session.UpdatedAt.UnixNano(), string(data), session.ID)
+		if err != nil {
+			return fmt.Errorf("update session: %w", err)
+		}
+		if err := checkAffected(result, session.ID); err != nil {
+			return err
+		}
+		return s.writeTags(tx, session.ID, session.Tags)
+	})
+}
+
+// Delete 删除会话
+func (s *SQLSessionStore) Delete(id string) error {
+	return s.exec(func(tx *sql.Tx) error {
+		result, err := tx.Exec(s.rebind(`DELETE FROM sessions WHERE id = ?`), id)
+		if err != nil {
+			return fmt.Errorf("delete session: %w", err)
+		}
+		if err := checkAffected(result, id); err != nil {
+			return err
+		}
+		return s.writeTags(tx, id, nil)
+	})
+}
+
+// Import 导入会话，保留原有的创建和更新时间
+func (s *SQLSessionStore) Import(session *models.Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("marshal session: %w", err)
+	}
+
+	return s.exec(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.rebind(`INSERT INTO sessions (id, agent_type, pinned, archived, updated_at, data) VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET agent_type = excluded.agent_type, pinned = excluded.pinned, archived = excluded.archived, updated_at = excluded.updated_at, data = excluded.data`),
+			session.ID, session.AgentType, session.Pinned, session.Archived, session.UpdatedAt.UnixNano(), string(data))
+		if err != nil {
+			return fmt.Errorf("import session: %w", err)
+		}
+		return s.writeTags(tx, session.ID, session.Tags)
+	})
+}
+
+// Close 关闭数据库连接
+func (s *SQLSessionStore) Close() error {
+	return s.db.Close()
+}
+
+// exec 在事务中执行写操作，fn 返回错误时回滚
+func (s *SQLSessionStore) exec(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// writeTags 用 tags 替换会话在标签表中的记录
+func (s *SQLSessionStore) writeTags(tx *sql.Tx, id string, tags []string) error {
+	if _, err := tx.Exec(s.rebind(`DELETE FROM session_tags WHERE session_id = ?`), id); err != nil {
+		return fmt.Errorf("delete session tags: %w", err)
+	}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if _, err := tx.Exec(s.rebind(`INSERT INTO session_tags (session_id, tag) VALUES (?, ?)`), id, tag); err != nil {
+			return fmt.Errorf("insert session tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// query 执行查询并解码会话
+func (s *SQLSessionStore) query(query string, args ...interface{}) ([]*models.Session, error) {
+	rows, err := s.db.Query(s.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]*models.Session, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		session, err := decodeSession(data)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// rebind 将 ? 占位符转换为 Postgres 的 $n
+func (s *SQLSessionStore) rebind(query string) string {
+	if !s.postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// decodeSession 解码会话，并为旧会话设置默认 AgentType
+func decodeSession(data string) (*models.Session, error) {
+	var session models.Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, fmt.Errorf("unmarshal session: %w", err)
+	}
+	if session.AgentType == "" {
+		session.AgentType = "simple-chat"
+	}
+	return &session, nil
+}
+
+// checkAffected 没有行被修改时返回 ErrNotFound
+func checkAffected(result sql.Result, id string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("session %w: %s", ErrNotFound, id)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+)
+
+const templatesFile = ".agentsdk/templates.json"
+
+// TemplateStore 自定义模板存储
+type TemplateStore struct {
+	mu        sync.RWMutex
+	templates map[string]*models.CustomTemplate
+	filePath  string
+}
+
+// NewTemplateStore 创建自定义模板存储
+func NewTemplateStore() (*TemplateStore, error) {
+	store := &TemplateStore{
+		templates: make(map[string]*models.CustomTemplate),
+		filePath:  templatesFile,
+	}
+
+	var templates []*models.CustomTemplate
+	if err := readJSONFile(store.filePath, &templates); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, t := range templates {
+		store.templates[t.ID] = t
+	}
+
+	return store, nil
+}
+
+// Create 保存新模板
+func (s *TemplateStore) Create(template *models.CustomTemplate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[template.ID]; ok {
+		return fmt.Errorf("template already exists: %s", template.ID)
+	}
+
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = time.Now()
+	s.templates[template.ID] = template
+
+	return s.save()
+}
+
+// Get 获取模板
+func (s *TemplateStore) Get(id string) (*models.CustomTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	template, ok := s.templates[id]
+	if !ok {
+		return nil, fmt.Errorf("template %w: %s", ErrNotFound, id)
+	}
+	return template, nil
+}
+
+// List 列出所有模板（按 ID 排序）
+func (s *TemplateStore) List() []*models.CustomTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	templates := make([]*models.CustomTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		templates = append(templates, t)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].ID < templates[j].ID
+	})
+	return templates
+}
+
+// Update 更新模板
+func (s *TemplateStore) Update(template *models.CustomTemplate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.templates[template.ID]
+	if !ok {
+		return fmt.Errorf("template %w: %s", ErrNotFound, template.ID)
+	}
+
+	template.CreatedAt = existing.CreatedAt
+	template.UpdatedAt = time.Now()
+	s.templates[template.ID] = template
+
+	return s.save()
+}
+
+// Delete 删除模板
+func (s *TemplateStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[id]; !ok {
+		return fmt.Errorf("template %w: %s", ErrNotFound, id)
+	}
+	delete(s.templates, id)
+
+	return s.save()
+}
+
+// save 保存到文件（调用方需持有写锁）
+func (s *TemplateStore) save() error {
+	templates := make([]*models.CustomTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		templates = append(templates, t)
+	}
+	return writeJSONFile(s.filePath, templates)
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coso/agentdemo/backend/models"
+)
+
+const (
+	webhooksFile          = ".agentsdk/webhooks.json"
+	webhookDeliveriesFile = ".agentsdk/webhook_deliveries.json"
+	webhookDeliveriesKeep = 1000 // 投递日志保留的最近记录数
+)
+
+// WebhookStore Webhook 订阅与投递日志存储
+type WebhookStore struct {
+	mu           sync.RWMutex
+	webhooks     map[string]*models.Webhook
+	deliveries   []*models.WebhookDelivery // 最新的在前
+	filePath     string
+	deliveryPath string
+}
+
+// NewWebhookStore 创建 Webhook 存储
+func NewWebhookStore() (*WebhookStore, error) {
+	store := &WebhookStore{
+		webhooks:     make(map[string]*models.Webhook),
+		filePath:     webhooksFile,
+		deliveryPath: webhookDeliveriesFile,
+	}
+
+	var webhooks []*models.Webhook
+	if err := readJSONFile(store.filePath, &webhooks); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, w := range webhooks {
+		store.webhooks[w.ID] = w
+	}
+
+	if err := readJSONFile(store.deliveryPath, &store.deliveries); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Create 保存新的 Webhook
+func (s *WebhookStore) Create(webhook *models.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[webhook.ID]; ok {
+		return fmt.Errorf("webhook already exists: %s", webhook.ID)
+	}
+
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	stored := *webhook
+	s.webhooks[webhook.ID] = &stored
+
+	return s.save()
+}
+
+// Get 获取 Webhook（包含密钥）
+func (s *WebhookStore) Get(id string) (*models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return nil, fmt.Errorf("webhook %w: %s", ErrNotFound, id)
+	}
+	result := *webhook
+	return &result, nil
+}
+
+// List 列出所有 Webhook（按创建时间排序，包含密钥）
+func (s *WebhookStore) List() []*models.Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := make([]*models.Webhook, 0, len(s.webhooks))
+	for _, w := range s.webhooks {
+		result := *w
+		webhooks = append(webhooks, &result)
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks
+}
+
+// Update 更新 Webhook
+func (s *WebhookStore) Update(webhook *models.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.webhooks[webhook.ID]
+	if !ok {
+		return fmt.Errorf("webhook %w: %s", ErrNotFound, webhook.ID)
+	}
+
+	webhook.CreatedAt = existing.CreatedAt
+	webhook.UpdatedAt = time.Now()
+	stored := *webhook
+	s.webhooks[webhook.ID] = &stored
+
+	return s.save()
+}
+
+// Delete 删除 Webhook（投递日志保留）
+func (s *WebhookStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return fmt.Errorf("webhook %w: %s", ErrNotFound, id)
+	}
+	delete(s.webhooks, id)
+
+	return s.save()
+}
+
+// SaveDelivery 新增或更新投递记录，只保留最近的若干条
+func (s *WebhookStore) SaveDelivery(delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := copyDelivery(delivery)
+
+	found := false
+	for i, d := range s.deliveries {
+		if d.ID == delivery.ID {
+			s.deliveries[i] = stored
+			found = true
+			break
+		}
+	}
+	if !found {
+		s.deliveries = append([]*models.WebhookDelivery{stored}, s.deliveries...)
+		if len(s.deliveries) > webhookDeliveriesKeep {
+			s.deliveries = s.deliveries[:webhookDeliveriesKeep]
+		}
+	}
+
+	return writeJSONFile(s.deliveryPath, s.deliveries)
+}
+
+// Delivery 获取投递记录
+func (s *WebhookStore) Delivery(id string) (*models.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, d := range s.deliveries {
+		if d.ID == id {
+			return copyDelivery(d), nil
+		}
+	}
+	return nil, fmt.Errorf("delivery %w: %s", ErrNotFound, id)
+}
+
+// Deliveries 列出投递记录（最新的在前），webhookID、status 非空时过滤，limit 为 0 时不限
+func (s *WebhookStore) Deliveries(webhookID, status string, limit int) []*models.WebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := make([]*models.WebhookDelivery, 0)
+	for _, d := range s.deliveries {
+		if webhookID != "" && d.WebhookID != webhookID {
+			continue
+		}
+		if status != "" && d.Status != status {
+			continue
+		}
+		deliveries = append(deliveries, copyDelivery(d))
+		if limit > 0 && len(deliveries) >= limit {
+			break
+		}
+	}
+	return deliveries
+}
+
+// copyDelivery 复制投递记录（包括尝试记录），避免与调用方共享切片
+func copyDelivery(delivery *models.WebhookDelivery) *models.WebhookDelivery {
+	result := *delivery
+	result.Attempts = append([]models.WebhookAttempt{}, delivery.Attempts...)
+	return &result
+}
+
+// save 保存到文件（调用方需持有写锁）
+func (s *WebhookStore) save() error {
+	webhooks := make([]*models.Webhook, 0, len(s.webhooks))
+	for _, w := range s.webhooks {
+		webhooks = append(webhooks, w)
+	}
+	return writeJSONFile(s.filePath, webhooks)
+}
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/google/uuid"
+)
+
+// 工作区配额默认值，可通过环境变量 WORKSPACE_MAX_BYTES / WORKSPACE_MAX_FILES 覆盖
+const (
+	defaultWorkspaceMaxBytes = 100 << 20 // 100 MB
+	defaultWorkspaceMaxFiles = 1000
+)
+
+var (
+	// ErrInvalidPath 路径不合法（绝对路径、越出工作区等）
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrQuotaExceeded 超出工作区配额
+	ErrQuotaExceeded = errors.New("workspace quota exceeded")
+)
+
+// WorkspaceStore 会话工作区
+// 每个会话拥有独立的目录 <root>/sessions/<sessionID>，临时 Agent 使用 <root>/tmp/<uuid>
+type WorkspaceStore struct {
+	root     string
+	maxBytes int64
+	maxFiles int
+}
+
+// NewWorkspaceStore 创建工作区存储，root 为工作区根目录
+func NewWorkspaceStore(root string) (*WorkspaceStore, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("resolve workspace root: %w", err)
+	}
+
+	store := &WorkspaceStore{
+		root:     absRoot,
+		maxBytes: defaultWorkspaceMaxBytes,
+		maxFiles: defaultWorkspaceMaxFiles,
+	}
+
+	if v := os.Getenv("WORKSPACE_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid WORKSPACE_MAX_BYTES: %q", v)
+		}
+		store.maxBytes = n
+	}
+	if v := os.Getenv("WORKSPACE_MAX_FILES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid WORKSPACE_MAX_FILES: %q", v)
+		}
+		store.maxFiles = n
+	}
+
+	if err := os.MkdirAll(filepath.Join(absRoot, "sessions"), 0755); err != nil {
+		return nil, fmt.Errorf("create workspace root: %w", err)
+	}
+
+	return store, nil
+}
+
+// SessionDir 获取会话工作区目录（不存在时创建）
+func (s *WorkspaceStore) SessionDir(sessionID string) (string, error) {
+	dir, err := s.sessionPath(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create workspace: %w", err)
+	}
+	return dir, nil
+}
+
+// TempDir 为临时 Agent 创建独立目录，返回目录和清理函数
+func (s *WorkspaceStore) TempDir() (string, func(), error) {
+	dir := filepath.Join(s.root, "tmp", uuid.New().String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, fmt.Errorf("create temporary workspace: %w", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
+
+// Resolve 将工作区内的相对路径解析为绝对路径，拒绝越出工作区的路径
+func (s *WorkspaceStore) Resolve(sessionID, relPath string) (string, error) {
+	base, err := s.sessionPath(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	relPath = filepath.FromSlash(relPath)
+	if relPath == "" || filepath.IsAbs(relPath) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPath, relPath)
+	}
+	for _, part := range strings.Split(relPath, string(filepath.Separator)) {
+		if part == ".." {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPath, relPath)
+		}
+	}
+
+	full := filepath.Join(base, filepath.Clean(relPath))
+	if full == base || !strings.HasPrefix(full, base+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPath, relPath)
+	}
+
+	// 检查符号链接，防止通过链接跳出工作区（包括目标尚不存在但父目录是链接的情况）
+	if err := checkSymlinks(base, full); err != nil {
+		if errors.Is(err, ErrInvalidPath) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPath, relPath)
+		}
+		return "", err
+	}
+
+	return full, nil
+}
+
+// checkSymlinks 从 full 向上找到最近的已存在路径，解析符号链接后必须仍在 base 之内；
+// 途中遇到悬空的符号链接同样拒绝（之后创建目录或文件时会写到链接指向的位置）
+func checkSymlinks(base, full string) error {
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // 工作区尚未创建，其中不可能有链接
+		}
+		return err
+	}
+
+	for path := full; ; path = filepath.Dir(path) {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			if real != realBase && !strings.HasPrefix(real, realBase+string(filepath.Separator)) {
+				return ErrInvalidPath
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if _, err := os.Lstat(path); err == nil {
+			return ErrInvalidPath // 悬空的符号链接
+		}
+		if path == base {
+			return nil
+		}
+	}
+}
+
+// List 列出会话工作区中的文件及用量
+func (s *WorkspaceStore) List(sessionID string) (*models.WorkspaceListing, error) {
+	base, err := s.sessionPath(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &models.WorkspaceListing{
+		Files: make([]models.WorkspaceFile, 0),
+		Usage: models.WorkspaceUsage{MaxBytes: s.maxBytes, MaxFiles: s.maxFiles},
+	}
+
+	err = filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == base {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(base, path)
+		listing.Files = append(listing.Files, models.WorkspaceFile{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		listing.Usage.Bytes += info.Size()
+		listing.Usage.Files++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list workspace: %w", err)
+	}
+
+	sort.Slice(listing.Files, func(i, j int) bool {
+		return listing.Files[i].Path < listing.Files[j].Path
+	})
+	return listing, nil
+}
+
+// CheckQuota 检查写入 size 字节到 relPath 后是否仍在配额内（覆盖已有文件时扣除原大小）
+func (s *WorkspaceStore) CheckQuota(sessionID, relPath string, size int64) error {
+	full, err := s.Resolve(sessionID, relPath)
+	if err != nil {
+		return err
+	}
+
+	listing, err := s.List(sessionID)
+	if err != nil {
+		return err
+	}
+
+	bytes, files := listing.Usage.Bytes+size, listing.Usage.Files+1
+	if info, err := os.Stat(full); err == nil {
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%w: %q is not a regular file", ErrInvalidPath, relPath)
+		}
+		bytes -= info.Size()
+		files--
+	}
+
+	if bytes > s.maxBytes {
+		return fmt.Errorf("%w: %d bytes used of %d", ErrQuotaExceeded, bytes, s.maxBytes)
+	}
+	if files > s.maxFiles {
+		return fmt.Errorf("%w: %d files used of %d", ErrQuotaExceeded, files, s.maxFiles)
+	}
+	return nil
+}
+
+// Write 写入文件，超出配额时拒绝；size 为内容长度，未知时传 -1
+func (s *WorkspaceStore) Write(sessionID, relPath string, r io.Reader, size int64) (*models.WorkspaceFile, error) {
+	full, err := s.Resolve(sessionID, relPath)
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		size = 0 // 长度未知时先检查文件数，写入时再按剩余空间截断
+	}
+	if err := s.CheckQuota(sessionID, relPath, size); err != nil {
+		return nil, err
+	}
+
+	// 实际写入量以剩余配额为上限，防止 size 不准确
+	listing, err := s.List(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	remaining := s.maxBytes - listing.Usage.Bytes
+	if info, err := os.Stat(full); err == nil {
+		remaining += info.Size()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return nil, fmt.Errorf("create directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(full), ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, io.LimitReader(r, remaining+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write file: %w", err)
+	}
+	if written > remaining {
+		return nil, fmt.Errorf("%w: file exceeds remaining %d bytes", ErrQuotaExceeded, remaining)
+	}
+
+	if err := os.Rename(tmp.Name(), full); err != nil {
+		return nil, fmt.Errorf("write file: %w", err)
+	}
+
+	info, err := os.Stat(full)
+	if err != nil {
+		return nil, err
+	}
+	return &models.WorkspaceFile{
+		Path:    filepath.ToSlash(filepath.Clean(filepath.FromSlash(relPath))),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// Remove 删除工作区中的文件或目录
+func (s *WorkspaceStore) Remove(sessionID, relPath string) error {
+	full, err := s.Resolve(sessionID, relPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(full); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("file %w: %s", ErrNotFound, relPath)
+		}
+		return err
+	}
+	return os.RemoveAll(full)
+}
+
+// RemoveAll 删除整个会话工作区
+func (s *WorkspaceStore) RemoveAll(sessionID string) error {
+	dir, err := s.sessionPath(sessionID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// sessionPath 会话工作区路径（不创建）
+func (s *WorkspaceStore) sessionPath(sessionID string) (string, error) {
+	if sessionID == "" || sessionID == "." || sessionID == ".." || strings.ContainsAny(sessionID, `/\`) {
+		return "", fmt.Errorf("%w: session id %q", ErrInvalidPath, sessionID)
+	}
+	return filepath.Join(s.root, "sessions", sessionID), nil
+}
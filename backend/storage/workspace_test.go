@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestWorkspaceWriteThroughSymlinkedParent 父目录是指向工作区外的符号链接时，写入新文件必须被拒绝
+func TestWorkspaceWriteThroughSymlinkedParent(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	store, err := NewWorkspaceStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := store.SessionDir("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rel := range []string{"link/new.txt", "link/sub/new.txt"} {
+		if _, err := store.Resolve("s1", rel); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Resolve(%q) error = %v, want ErrInvalidPath", rel, err)
+		}
+		if _, err := store.Write("s1", rel, strings.NewReader("x"), 1); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Write(%q) error = %v, want ErrInvalidPath", rel, err)
+		}
+	}
+
+	entries, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("files written outside the workspace: %v", entries)
+	}
+}
+
+// TestWorkspaceWriteThroughDanglingSymlink 悬空的符号链接作为父目录时同样拒绝
+func TestWorkspaceWriteThroughDanglingSymlink(t *testing.T) {
+	root := t.TempDir()
+	target := filepath.Join(t.TempDir(), "missing")
+
+	store, err := NewWorkspaceStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := store.SessionDir("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Write("s1", "link/new.txt", strings.NewReader("x"), 1); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Write error = %v, want ErrInvalidPath", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("dangling link target was created: %v", err)
+	}
+}
+
+// TestWorkspaceWriteInsideSymlinkedDir 指向工作区内部的链接和普通的新目录仍然可以写入
+func TestWorkspaceWriteInsideSymlinkedDir(t *testing.T) {
+	store, err := NewWorkspaceStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := store.SessionDir("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "docs"), filepath.Join(dir, "alias")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rel := range []string{"alias/a.txt", "new/dir/b.txt", "c.txt"} {
+		if _, err := store.Write("s1", rel, strings.NewReader("x"), 1); err != nil {
+			t.Errorf("Write(%q) error = %v", rel, err)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/coso/agentdemo/backend/models"
+	"github.com/gorilla/websocket"
+	"github.com/wordflowlab/agentsdk/pkg/agent"
+	"github.com/wordflowlab/agentsdk/pkg/types"
+)
+
+// connection 单个 WebSocket 连接的状态
+type connection struct {
+	h         *Handler
+	conn      *websocket.Conn
+	sessionID string
+	agentID   string // 会话的 Agent ID，切换模板时不变
+
+	writeMu sync.Mutex
+
+	mu             sync.Mutex
+	agent          *agent.Agent
+	forwardMonitor bool
+
+	agentChanged chan *agent.Agent
+}
+
+// newConnection 创建连接状态
+func newConnection(h *Handler, conn *websocket.Conn, session *models.Session, ag *agent.Agent) *connection {
+	return &connection{
+		h:              h,
+		conn:           conn,
+		sessionID:      session.ID,
+		agentID:        session.AgentID,
+		agent:          ag,
+		forwardMonitor: true,
+		agentChanged:   make(chan *agent.Agent, 1),
+	}
+}
+
+// send 发送消息（并发安全）
+func (c *connection) send(msg *models.WSMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.conn.WriteJSON(msg)
+}
+
+// currentAgent 获取当前 Agent
+func (c *connection) currentAgent() *agent.Agent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.agent
+}
+
+// readLoop 读取并处理客户端帧，连接断开时调用 onClose
+func (c *connection) readLoop(onClose func()) {
+	defer onClose()
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var frame models.WSClientFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			c.ack(frame, fmt.Errorf("invalid frame: %w", err))
+			continue
+		}
+
+		result, err := c.handleFrame(frame)
+		c.ackResult(frame, result, err)
+	}
+}
+
+// ack 确认客户端帧
+func (c *connection) ack(frame models.WSClientFrame, err error) {
+	c.ackResult(frame, nil, err)
+}
+
+// ackResult 确认客户端帧并附带处理结果
+func (c *connection) ackResult(frame models.WSClientFrame, result interface{}, err error) {
+	data := models.WSAckData{
+		ID:     frame.ID,
+		Type:   frame.Type,
+		OK:     err == nil,
+		Result: result,
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+
+	if err := c.send(&models.WSMessage{Type: "ack", Data: data}); err != nil {
+		log.Printf("Failed to write ack: %v", err)
+	}
+}
+
+// handleFrame 分发客户端帧，返回需要随 ack 返回的结果
+func (c *connection) handleFrame(frame models.WSClientFrame) (interface{}, error) {
+	switch frame.Type {
+	case models.WSFrameUserMessage:
+		var data models.WSUserMessageData
+		if err := json.Unmarshal(frame.Data, &data); err != nil {
+			return nil, fmt.Errorf("invalid user_message data: %w", err)
+		}
+		return result(c.enqueue(data.Message))
+
+	case models.WSFrameCancel:
+		var data models.WSCancelData
+		if len(frame.Data) > 0 {
+			if err := json.Unmarshal(frame.Data, &data); err != nil {
+				return nil, fmt.Errorf("invalid cancel data: %w", err)
+			}
+		}
+		return result(c.cancel(data))
+
+	case models.WSFrameStop:
+		return result(c.h.queue.Stop(c.sessionID))
+
+	case models.WSFrameToolApproval:
+		var data models.WSToolApprovalData
+		if err := json.Unmarshal(frame.Data, &data); err != nil {
+			return nil, fmt.Errorf("invalid tool_approval data: %w", err)
+		}
+		return nil, c.decideApproval(data)
+
+	case models.WSFrameSettings:
+		var data models.WSSettingsData
+		if err := json.Unmarshal(frame.Data, &data); err != nil {
+			return nil, fmt.Errorf("invalid settings data: %w", err)
+		}
+		return nil, c.applySettings(data)
+
+	default:
+		return nil, fmt.Errorf("unknown frame type: %q", frame.Type)
+	}
+}
+
+// result 将队列操作的结果转换为 ack 结果（没有结果时为 nil）
+func result(item *models.QueuedMessage, err error) (interface{}, error) {
+	if item == nil {
+		return nil, err
+	}
+	return item, err
+}
+
+// enqueue 将用户消息加入会话的消息队列
+func (c *connection) enqueue(message string) (*models.QueuedMessage, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, errors.New("message must not be empty")
+	}
+	return c.h.queue.Enqueue(c.sessionID, message)
+}
+
+// cancel 取消队列中的消息，未指定消息时停止当前轮次
+func (c *connection) cancel(data models.WSCancelData) (*models.QueuedMessage, error) {
+	if data.ItemID != "" {
+		return c.h.queue.Cancel(c.sessionID, data.ItemID)
+	}
+	return c.h.queue.Stop(c.sessionID)
+}
+
+// applySettings 修改设置
+func (c *connection) applySettings(data models.WSSettingsData) error {
+	if data.ForwardMonitor != nil {
+		c.mu.Lock()
+		c.forwardMonitor = *data.ForwardMonitor
+		c.mu.Unlock()
+	}
+
+	if data.AgentType != nil {
+		return c.switchTemplate(*data.AgentType)
+	}
+	return nil
+}
+
+// switchTemplate 切换会话模板并订阅新的 Agent
+func (c *connection) switchTemplate(templateID string) error {
+	if c.h.queue.Busy(c.sessionID) {
+		return errors.New("cannot switch template while messages are being processed")
+	}
+
+	session, err := c.h.sessionStore.Get(c.sessionID)
+	if err != nil {
+		return err
+	}
+	if session.AgentType == templateID {
+		return nil
+	}
+	if err := c.h.agentManager.SwitchSessionTemplate(session, templateID); err != nil {
+		return err
+	}
+	if err := c.h.sessionStore.Update(session); err != nil {
+		return err
+	}
+
+	// 新 Agent 创建后通过 Handler.rebind 切换到本连接
+	_, err = c.h.agentManager.GetOrCreateSessionAgent(context.Background(), session)
+	return err
+}
+
+// setAgent 切换连接使用的 Agent，并通知事件循环改为订阅新 Agent
+// 清空和发送都在锁内完成，并发切换时缓冲区必然有空位，发送不会阻塞
+func (c *connection) setAgent(ag *agent.Agent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.agent = ag
+
+	// 只保留最新的 Agent
+	select {
+	case <-c.agentChanged:
+	default:
+	}
+	c.agentChanged <- ag
+}
+
+// decideApproval 对本会话 Agent 的待审批工具调用做出决定
+func (c *connection) decideApproval(data models.WSToolApprovalData) error {
+	approvals := c.h.agentManager.Approvals()
+
+	request, ok := approvals.Get(data.RequestID)
+	if !ok || request.AgentID != c.agentID {
+		return fmt.Errorf("no pending approval request: %s", data.RequestID)
+	}
+	return approvals.Decide(data.RequestID, data.Decision, data.Note)
+}
+
+// onApproval 推送本会话 Agent 的审批请求及其结果
+func (c *connection) onApproval(request models.ApprovalRequest) {
+	if request.AgentID != c.agentID {
+		return
+	}
+
+	msgType := "approval_resolved"
+	if request.Status == models.ApprovalStatusPending {
+		msgType = "approval_required"
+	}
+	if err := c.send(&models.WSMessage{Type: msgType, Data: request}); err != nil {
+		log.Printf("Failed to write approval message: %v", err)
+	}
+}
+
+// shouldForward 是否向客户端推送该事件
+func (c *connection) shouldForward(event interface{}) bool {
+	switch event.(type) {
+	case *types.MonitorErrorEvent, *types.MonitorStateChangedEvent, *types.MonitorTokenUsageEvent:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.forwardMonitor
+	default:
+		return true
+	}
+}
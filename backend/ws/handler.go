@@ -4,6 +4,8 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	agentmgr "github.com/coso/agentdemo/backend/agent"
@@ -11,6 +13,7 @@ import (
 	"github.com/coso/agentdemo/backend/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/wordflowlab/agentsdk/pkg/agent"
 	"github.com/wordflowlab/agentsdk/pkg/types"
 )
 
@@ -22,19 +25,123 @@ var upgrader = websocket.Upgrader{
 
 // Handler WebSocket 处理器
 type Handler struct {
-	sessionStore *storage.SessionStore
+	sessionStore storage.SessionRepository
+	history      *storage.HistoryStore
 	agentManager *agentmgr.Manager
+	queue        *agentmgr.MessageQueue
+
+	mu    sync.RWMutex
+	conns map[string]map[*connection]struct{} // sessionID -> 连接
 }
 
 // NewHandler 创建 WebSocket 处理器
-func NewHandler(sessionStore *storage.SessionStore, agentManager *agentmgr.Manager) *Handler {
-	return &Handler{
+func NewHandler(sessionStore storage.SessionRepository, history *storage.HistoryStore, agentManager *agentmgr.Manager, titles *agentmgr.TitleGenerator, queue *agentmgr.MessageQueue) *Handler {
+	h := &Handler{
 		sessionStore: sessionStore,
+		history:      history,
 		agentManager: agentManager,
+		queue:        queue,
+		conns:        make(map[string]map[*connection]struct{}),
+	}
+
+	// 自动生成的标题推送给会话的所有连接
+	titles.Listen(func(session *models.Session) {
+		h.Broadcast(session.ID, &models.WSMessage{Type: "session_updated", Data: session})
+	})
+
+	// 会话 Agent 重建后（切换模板、编辑消息、切换分支），已连接的客户端改为订阅新 Agent
+	agentManager.OnSessionAgentCreated(h.rebind)
+
+	// 消息排队位置和处理状态推送给会话的所有连接
+	queue.Listen(h.onQueueUpdate)
+
+	return h
+}
+
+// Broadcast 向会话的所有连接推送消息
+func (h *Handler) Broadcast(sessionID string, msg *models.WSMessage) {
+	h.mu.RLock()
+	conns := make([]*connection, 0, len(h.conns[sessionID]))
+	for conn := range h.conns[sessionID] {
+		conns = append(conns, conn)
+	}
+	h.mu.RUnlock()
+
+	for _, conn := range conns {
+		if err := conn.send(msg); err != nil {
+			log.Printf("Failed to broadcast %s to session %s: %v", msg.Type, sessionID, err)
+		}
+	}
+}
+
+// onQueueUpdate 推送会话消息队列的变化；处理中的消息被停止、取消或出错时同时推送 turn_stopped / turn_cancelled / error
+func (h *Handler) onQueueUpdate(state models.MessageQueueState) {
+	h.Broadcast(state.SessionID, &models.WSMessage{Type: "queue_updated", Data: state})
+
+	changed := state.Changed
+	if changed == nil || changed.StartedAt == nil {
+		return
+	}
+	switch changed.Status {
+	case models.QueueStatusStopped:
+		h.Broadcast(state.SessionID, &models.WSMessage{Type: "turn_stopped", Data: changed})
+	case models.QueueStatusCancelled:
+		h.Broadcast(state.SessionID, &models.WSMessage{Type: "turn_cancelled", Data: changed})
+	case models.QueueStatusFailed:
+		h.Broadcast(state.SessionID, &models.WSMessage{Type: "error", Data: gin.H{"message": changed.Error, "item_id": changed.ID}})
+	}
+}
+
+// rebind 将会话的所有连接切换到新创建的 Agent
+func (h *Handler) rebind(ag *agent.Agent, sessionID string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for conn := range h.conns[sessionID] {
+		conn.setAgent(ag)
+	}
+}
+
+// register 登记连接
+func (h *Handler) register(c *connection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conns[c.sessionID] == nil {
+		h.conns[c.sessionID] = make(map[*connection]struct{})
+	}
+	h.conns[c.sessionID][c] = struct{}{}
+}
+
+// unregister 注销连接
+func (h *Handler) unregister(c *connection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.conns[c.sessionID], c)
+	if len(h.conns[c.sessionID]) == 0 {
+		delete(h.conns, c.sessionID)
 	}
 }
 
 // HandleWebSocket 处理 WebSocket 连接
+//
+// 服务端推送 Agent 事件（text_chunk、tool_start、done 等）；客户端可发送帧：
+//
+//	{"id": "c-1", "type": "user_message", "data": {"message": "..."}}
+//	{"id": "c-2", "type": "stop"}
+//	{"id": "c-2", "type": "cancel", "data": {"item_id": "..."}}
+//	{"id": "c-3", "type": "tool_approval", "data": {"request_id": "...", "decision": "allow"}}
+//	{"id": "c-4", "type": "settings", "data": {"agent_type": "writing-assistant", "forward_monitor": false}}
+//
+// 每个客户端帧都会收到 {"type": "ack", "data": {"id": "c-1", "ok": true}} 形式的确认。
+// user_message 进入会话的消息队列（与 REST 发送的消息共用），ack 的 result 为排队中的消息；
+// cancel 带 item_id 时取消该消息，否则同 stop。队列变化以 queue_updated 推送（含排队位置）。
+// stop 停止当前轮次：已生成的部分回复保存为标记 stopped 的助手消息，Agent 重建后推送 history 和 turn_stopped。
+// 连接建立后先推送 history（最新一页消息，格式同 GET /api/sessions/:id/messages），更早的消息通过 REST 分页加载；
+// 编辑消息或切换分支后会话 Agent 被重建，连接自动切换到新 Agent 并重新推送 history；
+// 需要审批的工具调用以 approval_required 推送，决定或超时后推送 approval_resolved；
+// 自动生成标题后推送 session_updated
 func (h *Handler) HandleWebSocket(c *gin.Context) {
 	sessionID := c.Param("sessionId")
 
@@ -53,33 +160,49 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	// 获取或创建 Agent
-	ag, err := h.agentManager.GetOrCreateAgent(context.Background(), session.AgentID, "writing-assistant")
+	// 获取或创建 Agent（使用 Session 的 AgentType）
+	ag, err := h.agentManager.GetOrCreateSessionAgent(context.Background(), session)
 	if err != nil {
 		log.Printf("Failed to get agent: %v", err)
+		conn.WriteJSON(&models.WSMessage{Type: "error", Data: gin.H{"message": err.Error()}})
 		return
 	}
 
+	client := newConnection(h, conn, session, ag)
+
+	// 初始同步：推送最新一页消息历史和消息队列
+	if err := h.sendHistory(client, ag); err != nil {
+		log.Printf("Failed to write message: %v", err)
+		return
+	}
+	if err := client.send(&models.WSMessage{Type: "queue_updated", Data: h.queue.State(sessionID)}); err != nil {
+		log.Printf("Failed to write message: %v", err)
+		return
+	}
+
+	h.register(client)
+	defer h.unregister(client)
+
+	// 推送工具审批请求，包括连接建立前已挂起的请求
+	removeListener := h.agentManager.Approvals().Listen(client.onApproval)
+	defer removeListener()
+	for _, request := range h.agentManager.Approvals().Pending(session.AgentID, "") {
+		client.onApproval(request)
+	}
+
 	// 订阅 Agent 事件
-	eventCh := ag.Subscribe([]types.AgentChannel{
-		types.ChannelProgress,
-		types.ChannelMonitor,
-	}, nil)
+	current := ag
+	eventCh := subscribe(current)
 
 	// 创建取消上下文
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// 启动消息接收协程
-	go func() {
-		for {
-			_, _, err := conn.ReadMessage()
-			if err != nil {
-				cancel()
-				return
-			}
-		}
-	}()
+	// 启动消息接收协程：处理客户端帧，连接断开时退出
+	go client.readLoop(cancel)
+
+	// 累积本轮回复，用于完成后的规范检查
+	var reply strings.Builder
 
 	// 发送事件到客户端
 	for {
@@ -87,22 +210,94 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 		case <-ctx.Done():
 			return
 
+		case next := <-client.agentChanged:
+			// 会话 Agent 被重建，改为订阅新的 Agent，并推送其历史（分支切换后历史会变化）
+			if next != current {
+				current = next
+				eventCh = subscribe(current)
+				reply.Reset()
+				if err := h.sendHistory(client, current); err != nil {
+					log.Printf("Failed to write message: %v", err)
+					return
+				}
+			}
+
 		case envelope, ok := <-eventCh:
 			if !ok {
-				return
+				// Agent 已关闭，等待重建后的 Agent
+				eventCh = nil
+				continue
 			}
 
-			msg := h.convertEventToWSMessage(envelope.Event)
-			if msg != nil {
-				if err := conn.WriteJSON(msg); err != nil {
-					log.Printf("Failed to write message: %v", err)
-					return
+			if client.shouldForward(envelope.Event) {
+				if msg := h.convertEventToWSMessage(envelope.Event); msg != nil {
+					if err := client.send(msg); err != nil {
+						log.Printf("Failed to write message: %v", err)
+						return
+					}
+				}
+			}
+
+			switch e := envelope.Event.(type) {
+			case *types.ProgressTextChunkEvent:
+				reply.WriteString(e.Delta)
+			case *types.ProgressDoneEvent:
+				if violation := h.checkGuidance(sessionID, reply.String()); violation != nil {
+					if err := client.send(violation); err != nil {
+						log.Printf("Failed to write message: %v", err)
+						return
+					}
 				}
+				reply.Reset()
 			}
 		}
 	}
 }
 
+// sendHistory 推送 Agent 最新一页消息历史
+func (h *Handler) sendHistory(client *connection, ag *agent.Agent) error {
+	page, err := h.history.Page(ag.ID(), models.HistoryQuery{})
+	if err != nil {
+		log.Printf("Failed to load history for session %s: %v", client.sessionID, err)
+		page = &models.MessagePage{Messages: []models.HistoryMessage{}}
+	}
+	return client.send(&models.WSMessage{Type: "history", Data: page})
+}
+
+// subscribe 订阅 Agent 的进度和监控事件
+func subscribe(ag *agent.Agent) <-chan types.AgentEventEnvelope {
+	return ag.Subscribe([]types.AgentChannel{
+		types.ChannelProgress,
+		types.ChannelMonitor,
+	}, nil)
+}
+
+// checkGuidance 检查回复中是否仍包含会话术语表中的禁用词
+func (h *Handler) checkGuidance(sessionID, reply string) *models.WSMessage {
+	session, err := h.sessionStore.Get(sessionID)
+	if err != nil {
+		return nil
+	}
+
+	guidance, err := h.agentManager.LoadGuidance(session.GuideRefs)
+	if err != nil {
+		log.Printf("Failed to load guidance for session %s: %v", sessionID, err)
+		return nil
+	}
+
+	violations := guidance.Check(reply)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return &models.WSMessage{
+		Type: "guide_violation",
+		Data: models.GuideViolationData{
+			Violations: violations,
+		},
+	}
+}
+
 // convertEventToWSMessage 将 Agent 事件转换为 WebSocket 消息
 func (h *Handler) convertEventToWSMessage(event interface{}) *models.WSMessage {
 	switch e := event.(type) {
@@ -200,4 +395,3 @@ func (h *Handler) PingHandler(c *gin.Context) {
 		"timestamp": time.Now().Unix(),
 	})
 }
-